@@ -3,26 +3,60 @@ package main
 import (
 	"context"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/xavesen/search-admin/internal/api"
 	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/jobs"
+	"github.com/xavesen/search-admin/internal/outbox"
 	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/webhooks"
 	log "github.com/sirupsen/logrus"
 )
 
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	config, err := config.LoadConfig()
 	if err != nil {
 		os.Exit(1)
 	}
 
-	ctx := context.TODO()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	mongoStorage, err := storage.NewMongoStorage(ctx, config.DbAddr, config.Db, config.DbUser, config.DbPass)
 	if err != nil {
 		os.Exit(1)
 	}
 
-	server := api.NewServer(config.ListenAddr, mongoStorage, config)
+	go jobs.RunPeriodically(ctx, "archive expired filters", config.FilterSweepInterval, jobs.ArchiveExpiredFilters(mongoStorage))
+	go jobs.RunPeriodically(ctx, "purge trash", config.TrashPurgeInterval, jobs.PurgeTrash(mongoStorage, config.TrashRetention))
+	webhookDispatcher := webhooks.NewDispatcherFromConfig(mongoStorage, config)
+	go jobs.RunPeriodically(ctx, "relay outbox", config.OutboxRelayInterval, jobs.RelayOutbox(outbox.NewRelayFromConfig(mongoStorage, config, webhookDispatcher)))
+	go jobs.RunPeriodically(ctx, "deliver webhooks", config.WebhookDeliveryInterval, jobs.DeliverWebhooks(webhookDispatcher))
+
+	server, err := api.NewServer(config.ListenAddr, mongoStorage, config)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Errorf("Error shutting down server: %s", err)
+		}
+	}()
 
-	log.Fatal(server.Start())
+	if err := server.Start(); err != nil {
+		log.Fatal(err)
+	}
+	<-shutdownDone
+	log.Info("Server stopped")
 }
\ No newline at end of file
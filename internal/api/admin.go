@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (s *Server) Login(w http.ResponseWriter, r *http.Request) {
+	var request *models.LoginRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&request) ; err != nil || request == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	err := s.validator.Struct(request)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warning(logErrorString)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
+		return
+	}
+
+	ctx := context.TODO()
+
+	/*
+	Failed logins are throttled the same way as password grants,
+	with keys of their own, so that failed grants of a user
+	can't lock out an admin with the same login.
+	*/
+	throttleKey := auth.HashToken("admin|" + request.Login + "|" + clientAddress(r))
+	allowed, retryAfter, err := s.passwordThrottle.Allow(ctx, throttleKey, time.Now())
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+	if !allowed {
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"login": request.Login,
+		}).Warning("Throttled login attempt")
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		utils.WriteJSON(w, r, http.StatusTooManyRequests, false, "Too many failed attempts, try again later", nil)
+		return
+	}
+
+	passwordHash := ""
+	admin, err := s.storage.GetAdminByLogin(ctx, request.Login)
+	if err == nil {
+		passwordHash = admin.PasswordHash
+	} else if err != mongo.ErrNoDocuments {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	if !auth.CheckPassword(passwordHash, request.Password) {
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"login": request.Login,
+		}).Warning("Failed login attempt")
+		if err := s.passwordThrottle.Fail(ctx, throttleKey, time.Now()); err != nil {
+			log.Errorf("Error recording failed login attempt: %s", err)
+		}
+		utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Invalid login or password", nil)
+		return
+	}
+	if err := s.passwordThrottle.Reset(ctx, throttleKey); err != nil {
+		log.Errorf("Error resetting failed login attempts: %s", err)
+	}
+
+	token, err := auth.NewSessionToken()
+	if err != nil {
+		log.Errorf("Error generating session token: %s", err)
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	ttl := s.config.SessionTTL
+	if ttl <= 0 {
+		ttl = auth.DefaultSessionTTL
+	}
+
+	now := time.Now().UTC()
+	session := &models.Session{
+		AdminId: 	admin.Id,
+		Login: 		admin.Login,
+		TokenHash: 	auth.HashToken(token),
+		CreatedAt: 	now,
+		ExpiresAt: 	now.Add(ttl),
+	}
+
+	session, err = s.storage.CreateSession(ctx, session)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	principal := &auth.Principal{Subject: admin.Login, Method: auth.MethodSession, SessionId: session.Id}
+	s.recordAudit(r.WithContext(auth.WithPrincipal(r.Context(), principal)), "session.login", models.AuditResourceSession, session.Id, nil, session)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", models.LoginResponse{Token: token, ExpiresAt: session.ExpiresAt})
+}
+
+func (s *Server) Logout(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok || principal.Method != auth.MethodSession {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Request is not authenticated with a session token", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	err := s.storage.RevokeSession(ctx, principal.SessionId, time.Now().UTC())
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	s.recordAudit(r, "session.logout", models.AuditResourceSession, principal.SessionId, nil, nil)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", nil)
+}
+
+func (s *Server) GetAllAdmins(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+	admins, err := s.storage.GetAllAdmins(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", admins)
+}
+
+func (s *Server) GetAdminById(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No admin id provided", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	admin, err := s.storage.GetAdmin(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No admin with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", admin)
+}
+
+func (s *Server) CreateAdmin(w http.ResponseWriter, r *http.Request) {
+	var newAdmin *models.Admin
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&newAdmin) ; err != nil || newAdmin == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	err := s.validator.Struct(newAdmin)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warning(logErrorString)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
+		return
+	}
+
+	newAdmin.PasswordHash, err = auth.HashPassword(newAdmin.Password)
+	if err != nil {
+		log.Errorf("Error hashing password of admin %s: %s", newAdmin.Login, err)
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+	newAdmin.Password = ""
+	newAdmin.Id = ""
+	newAdmin.CreatedAt = time.Now().UTC()
+
+	ctx := context.TODO()
+	newAdmin, err = s.storage.CreateAdmin(ctx, newAdmin)
+	if err != nil {
+		if err == storage.ErrDuplicateLogin {
+			utils.WriteJSON(w, r, http.StatusConflict, false, "Admin with such login already exists", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	s.recordAudit(r, "admin.create", models.AuditResourceAdmin, newAdmin.Id, nil, newAdmin)
+	utils.WriteJSON(w, r, http.StatusCreated, true, "", newAdmin)
+}
+
+func (s *Server) DeleteAdmin(w http.ResponseWriter, r *http.Request) {
+	/*
+	Sessions of deleted admin are revoked,
+	otherwise they would stay valid until they expire.
+	*/
+
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No admin id provided", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	before, _ := s.storage.GetAdmin(ctx, id)
+	err := s.storage.DeleteAdmin(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No admin with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	if _, err = s.storage.RevokeAdminSessions(ctx, id, time.Now().UTC()); err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	s.recordAudit(r, "admin.delete", models.AuditResourceAdmin, id, before, nil)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", nil)
+}
+
+func (s *Server) RevokeAdminSessions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No admin id provided", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	if _, err := s.storage.GetAdmin(ctx, id); err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No admin with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	revoked, err := s.storage.RevokeAdminSessions(ctx, id, time.Now().UTC())
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	s.recordAudit(r, "admin.revoke_sessions", models.AuditResourceAdmin, id, nil, map[string]int64{"revoked": revoked})
+	utils.WriteJSON(w, r, http.StatusOK, true, "", map[string]int64{"revoked": revoked})
+}
@@ -0,0 +1,298 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+const testAdminPassword = "correct horse battery"
+
+var testAdminPasswordHash, _ = auth.HashPassword(testAdminPassword)
+
+var loginTests = []struct {
+	testName				string
+	storage					*storage.StorageMock
+	payload					string
+	expectedCode			int
+	expectedErrorMessage	string
+}{
+	{
+		testName: "Returns 200 and session token with correct password",
+		storage: &storage.StorageMock{
+			Admins: []models.Admin{
+				{Id: "66d8420df6e5311a791e0a08", Login: "alice", PasswordHash: testAdminPasswordHash},
+			},
+		},
+		payload: `{"login": "alice", "password": "correct horse battery"}`,
+		expectedCode: http.StatusOK,
+		expectedErrorMessage: "",
+	},
+	{
+		testName: "Returns 401 with wrong password",
+		storage: &storage.StorageMock{
+			Admins: []models.Admin{
+				{Id: "66d8420df6e5311a791e0a08", Login: "alice", PasswordHash: testAdminPasswordHash},
+			},
+		},
+		payload: `{"login": "alice", "password": "wrong password"}`,
+		expectedCode: http.StatusUnauthorized,
+		expectedErrorMessage: "Invalid login or password",
+	},
+	{
+		testName: "Returns 401 with unknown login",
+		storage: &storage.StorageMock{},
+		payload: `{"login": "mallory", "password": "correct horse battery"}`,
+		expectedCode: http.StatusUnauthorized,
+		expectedErrorMessage: "Invalid login or password",
+	},
+	{
+		testName: "Returns 400 without password",
+		storage: &storage.StorageMock{},
+		payload: `{"login": "alice"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedErrorMessage: "Bad request: password is required",
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		payload: `{"login": "alice", "password": "correct horse battery"}`,
+		expectedCode: http.StatusInternalServerError,
+		expectedErrorMessage: "Internal server error",
+	},
+}
+
+func TestLoginHandler(t *testing.T) {
+	for i, test := range loginTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, authConfig)
+
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		var resp struct {
+			Success			bool					`json:"success"`
+			ErrorMessage	string					`json:"errorMessage"`
+			Data			*models.LoginResponse	`json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Unable to unmarshal response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, resp.ErrorMessage, test.expectedErrorMessage, "wrong error message")
+		if test.expectedCode == http.StatusOK {
+			assert.Equal(t, strings.HasPrefix(resp.Data.Token, "sas_"), true, "wrong session token format")
+		}
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	throttleConfig := *authConfig
+	throttleConfig.PasswordMaxFailures = 2
+	testStorage := &storage.StorageMock{
+		Admins: []models.Admin{
+			{Id: "66d8420df6e5311a791e0a08", Login: "alice", PasswordHash: testAdminPasswordHash},
+		},
+	}
+	server := newTestServer(t, testStorage, &throttleConfig)
+
+	login := func(password string, remoteAddr string) *httptest.ResponseRecorder {
+		payload := fmt.Sprintf(`{"login": "alice", "password": "%s"}`, password)
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		req.RemoteAddr = remoteAddr
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < throttleConfig.PasswordMaxFailures; i++ {
+		assert.Equal(t, login("wrong password", "10.0.0.1:1234").Code, http.StatusUnauthorized, "wrong response code before throttling")
+	}
+
+	rr := login(testAdminPassword, "10.0.0.1:4321")
+	assert.Equal(t, rr.Code, http.StatusTooManyRequests, "correct password must be throttled after failures")
+	assert.Equal(t, rr.Header().Get("Retry-After") != "", true, "no Retry-After header")
+
+	rr = login(testAdminPassword, "10.0.0.2:1234")
+	assert.Equal(t, rr.Code, http.StatusOK, "other client address must not be throttled")
+	assert.Equal(t, len(testStorage.LoginFailures), 1, "successful login must reset only its own failures")
+}
+
+var revokedAt = time.Now().Add(-time.Minute)
+
+var testSessions = []models.Session{
+	{Id: "1", Login: "alice", TokenHash: auth.HashToken("sas_valid"), ExpiresAt: time.Now().Add(time.Hour)},
+	{Id: "2", Login: "alice", TokenHash: auth.HashToken("sas_expired"), ExpiresAt: time.Now().Add(-time.Hour)},
+	{Id: "3", Login: "alice", TokenHash: auth.HashToken("sas_revoked"), ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt},
+}
+
+var adminSessionTests = []struct {
+	testName			string
+	token				string
+	method				string
+	path				string
+	payload				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 when superadmin lists admins with session token",
+		token: "sas_valid",
+		method: http.MethodGet,
+		path: "/admins",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: []models.Admin{},
+		},
+	},
+	{
+		testName: "Returns 401 with expired session token",
+		token: "sas_expired",
+		method: http.MethodGet,
+		path: "/admins",
+		expectedCode: http.StatusUnauthorized,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "unauthorized",
+			ErrorMessage: "Invalid credentials",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 401 with revoked session token",
+		token: "sas_revoked",
+		method: http.MethodGet,
+		path: "/admins",
+		expectedCode: http.StatusUnauthorized,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "unauthorized",
+			ErrorMessage: "Invalid credentials",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 200 on logout with session token",
+		token: "sas_valid",
+		method: http.MethodPost,
+		path: "/logout",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 on logout with static token",
+		token: "static-token",
+		method: http.MethodPost,
+		path: "/logout",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "bad_request",
+			ErrorMessage: "Request is not authenticated with a session token",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 when creating admin with short password",
+		token: "static-token",
+		method: http.MethodPost,
+		path: "/admin",
+		payload: `{"login": "bob", "password": "short"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: password must be at least 8 characters in length",
+			FieldErrors: []utils.FieldError{
+				{Field: "password", Rule: "min", Message: "password must be at least 8 characters in length"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 200 and revoked sessions count",
+		token: "static-token",
+		method: http.MethodPost,
+		path: "/admin/66d8420df6e5311a791e0a08/revoke-sessions",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: map[string]int64{"revoked": 3},
+		},
+	},
+}
+
+func TestAdminSessionHandlers(t *testing.T) {
+	for i, test := range adminSessionTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		testStorage := &storage.StorageMock{Admins: []models.Admin{}, Sessions: testSessions}
+		server := newTestServer(t, testStorage, authConfig)
+
+		req, err := http.NewRequest(test.method, test.path, bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		req.Header.Set("Authorization", "Bearer " + test.token)
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
+
+func TestCreateAdminHandler(t *testing.T) {
+	server := newTestServer(t, &storage.StorageMock{}, authConfig)
+
+	payload := `{"login": "bob", "password": "long enough password"}`
+	req, err := http.NewRequest(http.MethodPost, "/admin", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatalf("Unable to create request, error: %s\n", err)
+	}
+	req.Header.Set("Authorization", "Bearer static-token")
+
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusCreated, "wrong response code")
+	assert.Equal(t, strings.Contains(rr.Body.String(), "password"), false, "password leaked in response")
+}
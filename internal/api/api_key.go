@@ -0,0 +1,319 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	APIKeyInvalidReasonUnknown			= "unknown_key"
+	APIKeyInvalidReasonRevoked			= "revoked_or_expired"
+	APIKeyInvalidReasonIndexNotInScope	= "index_not_in_scope"
+)
+
+func (s *Server) getKeyOwner(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No user id provided", nil)
+		return nil, false
+	}
+
+	ctx := context.TODO()
+	user, err := s.storage.GetUser(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No user with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return nil, false
+	}
+	user.Id = id
+
+	return user, true
+}
+
+func newAPIKey(user *models.User, name string, scopes []string, expiresAt *time.Time) (*models.APIKey, string, error) {
+	key, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		log.Errorf("Error generating api key for user %s: %s", user.Id, err)
+		return nil, "", err
+	}
+
+	return &models.APIKey{
+		UserId: 	user.Id,
+		Name: 		name,
+		Prefix: 	prefix,
+		KeyHash: 	auth.HashToken(key),
+		Scopes: 	scopes,
+		CreatedAt: 	time.Now().UTC(),
+		ExpiresAt: 	expiresAt,
+	}, key, nil
+}
+
+func (s *Server) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var request *models.APIKeyRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&request) ; err != nil || request == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	err := s.validator.Struct(request)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warning(logErrorString)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
+		return
+	}
+
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: expires_at must be in the future", nil)
+		return
+	}
+
+	user, ok := s.getKeyOwner(w, r)
+	if !ok {
+		return
+	}
+
+	/*
+	Key can only be scoped to indexes that belong to the user,
+	otherwise it would grant access the user doesn't have.
+	*/
+	userIndexes := map[string]bool{}
+	for _, index := range user.Indexes {
+		userIndexes[index] = true
+	}
+	for _, scope := range request.Scopes {
+		if !userIndexes[scope] {
+			utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: " + utils.Translate(utils.RequestTranslator(r), "scope {0} is not an index of the user", scope), nil)
+			return
+		}
+	}
+
+	key, plainKey, err := newAPIKey(user, request.Name, request.Scopes, request.ExpiresAt)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	key, err = s.storage.CreateAPIKey(ctx, key)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	s.recordAudit(r, "api_key.create", models.AuditResourceAPIKey, key.Id, nil, key)
+	utils.WriteJSON(w, r, http.StatusCreated, true, "", models.CreatedAPIKey{APIKey: *key, Key: plainKey})
+}
+
+func (s *Server) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.getKeyOwner(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := context.TODO()
+	keys, err := s.storage.GetAPIKeys(ctx, user.Id)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", keys)
+}
+
+func (s *Server) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId, keyId := vars["id"], vars["keyId"]
+
+	ctx := context.TODO()
+	before, _ := s.storage.GetAPIKey(ctx, userId, keyId)
+	err := s.storage.RevokeAPIKey(ctx, userId, keyId, time.Now().UTC())
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No active api key with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	s.recordAudit(r, "api_key.revoke", models.AuditResourceAPIKey, keyId, before, nil)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", nil)
+}
+
+func (s *Server) RotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	/*
+	Rotated key keeps name, scopes and expiration of the old one,
+	scopes the user no longer has indexes for are dropped.
+	*/
+
+	user, ok := s.getKeyOwner(w, r)
+	if !ok {
+		return
+	}
+	keyId := mux.Vars(r)["keyId"]
+
+	ctx := context.TODO()
+	oldKey, err := s.storage.GetAPIKey(ctx, user.Id, keyId)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No active api key with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+	if !oldKey.IsValid(time.Now()) {
+		utils.WriteJSON(w, r, http.StatusNotFound, false, "No active api key with such id", nil)
+		return
+	}
+
+	scopes := effectiveScopes(oldKey.Scopes, user.Indexes)
+	if len(scopes) == 0 {
+		utils.WriteJSON(w, r, http.StatusConflict, false, "User no longer has any of the key's indexes", nil)
+		return
+	}
+
+	newKey, plainKey, err := newAPIKey(user, oldKey.Name, scopes, oldKey.ExpiresAt)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	newKey, err = s.storage.RotateAPIKey(ctx, oldKey, newKey, time.Now().UTC())
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No active api key with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	s.recordAudit(r, "api_key.rotate", models.AuditResourceAPIKey, oldKey.Id, oldKey, newKey)
+	utils.WriteJSON(w, r, http.StatusCreated, true, "", models.CreatedAPIKey{APIKey: *newKey, Key: plainKey})
+}
+
+func (s *Server) VerifyAPIKey(w http.ResponseWriter, r *http.Request) {
+	/*
+	Invalid keys are not an error of the request, so verification
+	always responds 200 and tells search service why key is invalid.
+	*/
+
+	var request *models.APIKeyVerifyRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&request) ; err != nil || request == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	err := s.validator.Struct(request)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warning(logErrorString)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
+		return
+	}
+
+	invalid := func(reason string) {
+		utils.WriteJSON(w, r, http.StatusOK, true, "", models.APIKeyVerifyResponse{Valid: false, Reason: reason})
+	}
+
+	prefix, ok := auth.ParseAPIKey(request.Key)
+	if !ok {
+		invalid(APIKeyInvalidReasonUnknown)
+		return
+	}
+
+	ctx := context.TODO()
+	key, err := s.storage.GetAPIKeyByPrefix(ctx, prefix)
+	if err == mongo.ErrNoDocuments {
+		invalid(APIKeyInvalidReasonUnknown)
+		return
+	} else if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	if !auth.CheckAPIKey(key.KeyHash, request.Key) {
+		invalid(APIKeyInvalidReasonUnknown)
+		return
+	}
+	if !key.IsValid(time.Now()) {
+		invalid(APIKeyInvalidReasonRevoked)
+		return
+	}
+
+	user, err := s.storage.GetUser(ctx, key.UserId)
+	if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+		invalid(APIKeyInvalidReasonRevoked)
+		return
+	} else if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	scopes := effectiveScopes(key.Scopes, user.Indexes)
+	if request.Index != "" && !contains(scopes, request.Index) {
+		invalid(APIKeyInvalidReasonIndexNotInScope)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", models.APIKeyVerifyResponse{
+		Valid: 	true,
+		KeyId: 	key.Id,
+		UserId: key.UserId,
+		Scopes: scopes,
+	})
+}
+
+func effectiveScopes(scopes []string, indexes []string) []string {
+	/*
+	User may lose indexes after key is created,
+	key never grants more than user currently has.
+	*/
+
+	effective := []string{}
+	for _, scope := range scopes {
+		if contains(indexes, scope) {
+			effective = append(effective, scope)
+		}
+	}
+
+	return effective
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const testAPIKey = "sak_lookup.secret"
+
+var keyOwner = models.User{Id: "66d8420df6e5311a791e0a08", Login: "tenant", IndexLimit: 3, Indexes: []string{"products", "orders"}}
+
+var testAPIKeys = []models.APIKey{
+	{Id: "66d8420df6e5311a791e0a10", UserId: keyOwner.Id, Name: "ingest", Prefix: "lookup", KeyHash: auth.HashToken(testAPIKey), Scopes: []string{"products", "logs"}},
+	{Id: "66d8420df6e5311a791e0a11", UserId: keyOwner.Id, Name: "old", Prefix: "revoked", KeyHash: auth.HashToken("sak_revoked.secret"), Scopes: []string{"orders"}, RevokedAt: &revokedAt},
+}
+
+var apiKeyTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	method				string
+	path				string
+	payload				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 400 when scope is not an index of the user",
+		storage: &storage.StorageMock{User: keyOwner},
+		method: http.MethodPost,
+		path: "/user/66d8420df6e5311a791e0a08/keys",
+		payload: `{"name": "ingest", "scopes": ["products", "payments"]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "bad_request",
+			ErrorMessage: "Bad request: scope payments is not an index of the user",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 without scopes",
+		storage: &storage.StorageMock{User: keyOwner},
+		method: http.MethodPost,
+		path: "/user/66d8420df6e5311a791e0a08/keys",
+		payload: `{"name": "ingest"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: scopes is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "scopes", Rule: "required", Message: "scopes is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 404 when creating key for non-existent user",
+		storage: &storage.StorageMock{Error: mongo.ErrNoDocuments},
+		method: http.MethodPost,
+		path: "/user/66d8420df6e5311a791e0a08/keys",
+		payload: `{"name": "ingest", "scopes": ["products"]}`,
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No user with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 200 and keys of the user without hashes",
+		storage: &storage.StorageMock{User: keyOwner, APIKeys: testAPIKeys},
+		method: http.MethodGet,
+		path: "/user/66d8420df6e5311a791e0a08/keys",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: testAPIKeys,
+		},
+	},
+	{
+		testName: "Returns 200 on revoking key",
+		storage: &storage.StorageMock{APIKeys: testAPIKeys},
+		method: http.MethodDelete,
+		path: "/user/66d8420df6e5311a791e0a08/keys/66d8420df6e5311a791e0a10",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 404 on revoking key of another user",
+		storage: &storage.StorageMock{APIKeys: testAPIKeys},
+		method: http.MethodDelete,
+		path: "/user/66d8420df6e5311a791e0a09/keys/66d8420df6e5311a791e0a10",
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No active api key with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 404 on rotating revoked key",
+		storage: &storage.StorageMock{User: keyOwner, APIKeys: testAPIKeys},
+		method: http.MethodPost,
+		path: "/user/66d8420df6e5311a791e0a08/keys/66d8420df6e5311a791e0a11/rotate",
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No active api key with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns valid key with scopes limited to current user indexes",
+		storage: &storage.StorageMock{User: keyOwner, APIKeys: testAPIKeys},
+		method: http.MethodPost,
+		path: "/keys/verify",
+		payload: `{"key": "sak_lookup.secret", "index": "products"}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.APIKeyVerifyResponse{
+				Valid: true,
+				KeyId: "66d8420df6e5311a791e0a10",
+				UserId: keyOwner.Id,
+				Scopes: []string{"products"},
+			},
+		},
+	},
+	{
+		testName: "Returns invalid key when index is out of scope",
+		storage: &storage.StorageMock{User: keyOwner, APIKeys: testAPIKeys},
+		method: http.MethodPost,
+		path: "/keys/verify",
+		payload: `{"key": "sak_lookup.secret", "index": "logs"}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.APIKeyVerifyResponse{Valid: false, Reason: APIKeyInvalidReasonIndexNotInScope},
+		},
+	},
+	{
+		testName: "Returns invalid key with wrong secret",
+		storage: &storage.StorageMock{User: keyOwner, APIKeys: testAPIKeys},
+		method: http.MethodPost,
+		path: "/keys/verify",
+		payload: `{"key": "sak_lookup.guessed"}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.APIKeyVerifyResponse{Valid: false, Reason: APIKeyInvalidReasonUnknown},
+		},
+	},
+	{
+		testName: "Returns invalid key when key is revoked",
+		storage: &storage.StorageMock{User: keyOwner, APIKeys: testAPIKeys},
+		method: http.MethodPost,
+		path: "/keys/verify",
+		payload: `{"key": "sak_revoked.secret"}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.APIKeyVerifyResponse{Valid: false, Reason: APIKeyInvalidReasonRevoked},
+		},
+	},
+}
+
+func TestAPIKeyHandlers(t *testing.T) {
+	for i, test := range apiKeyTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(test.method, test.path, bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
+
+func TestCreateAPIKeyHandler(t *testing.T) {
+	server := newTestServer(t, &storage.StorageMock{User: keyOwner}, nil)
+
+	expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	payload := `{"name": "ingest", "scopes": ["products"], "expires_at": "` + expiresAt + `"}`
+	req, err := http.NewRequest(http.MethodPost, "/user/66d8420df6e5311a791e0a08/keys", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatalf("Unable to create request, error: %s\n", err)
+	}
+
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+
+	var resp struct {
+		Data	models.CreatedAPIKey	`json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unable to unmarshal response, error: %s\n", err)
+	}
+
+	prefix, ok := auth.ParseAPIKey(resp.Data.Key)
+	assert.Equal(t, rr.Code, http.StatusCreated, "wrong response code")
+	assert.Equal(t, ok, true, "wrong api key format")
+	assert.Equal(t, prefix, resp.Data.Prefix, "wrong api key prefix")
+	assert.Equal(t, strings.Contains(rr.Body.String(), "keyhash"), false, "key hash leaked in response")
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/audit"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+const (
+	auditActorAnonymous	= "anonymous"
+	defaultAuditLimit	= 100
+	maxAuditLimit		= 1000
+)
+
+func auditOrigin(r *http.Request) audit.Origin {
+	origin := audit.Origin{Actor: auditActorAnonymous}
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		origin.Actor = principal.QualifiedSubject()
+		origin.ActorMethod = principal.Method
+	}
+	if requestId, ok := r.Context().Value(utils.ContextKeyReqId).(string); ok {
+		origin.RequestId = requestId
+	}
+
+	return origin
+}
+
+func auditContext(r *http.Request) context.Context {
+	/*
+	Users and filters are audited by storage in the same transaction
+	as their change is written, so a change is never left unaudited.
+	*/
+
+	return audit.WithOrigin(context.TODO(), auditOrigin(r))
+}
+
+func (s *Server) recordAudit(r *http.Request, action string, resourceType string, resourceId string, before any, after any) {
+	/*
+	Resources without change feed are audited after mutation succeeded,
+	failing to record it is logged but doesn't fail the request,
+	as the change is already made.
+	*/
+
+	event := auditOrigin(r).Event(action, resourceType, resourceId, before, after)
+
+	ctx := context.TODO()
+	if err := s.storage.RecordAuditEvent(ctx, &event); err != nil {
+		log.WithFields(log.Fields{
+			"request_id": event.RequestId,
+			"action": event.Action,
+			"resource_type": event.ResourceType,
+			"resource_id": event.ResourceId,
+			"actor": event.Actor,
+		}).Errorf("Error recording audit event: %s", err)
+	}
+}
+
+func (s *Server) GetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	from, err := utils.ParseTimeQuery(r, "from")
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: from must be a RFC3339 timestamp", nil)
+		return
+	}
+	to, err := utils.ParseTimeQuery(r, "to")
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: to must be a RFC3339 timestamp", nil)
+		return
+	}
+
+	limit := int64(defaultAuditLimit)
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxAuditLimit {
+			utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: " + utils.Translate(utils.RequestTranslator(r), "limit must be between 1 and {0}", strconv.Itoa(maxAuditLimit)), nil)
+			return
+		}
+	}
+
+	query := models.AuditQuery{
+		ResourceType: 	r.URL.Query().Get("resource_type"),
+		ResourceId: 	r.URL.Query().Get("resource_id"),
+		Actor: 			r.URL.Query().Get("actor"),
+		From: 			from,
+		To: 			to,
+		Limit: 			limit,
+	}
+
+	ctx := context.TODO()
+	events, err := s.storage.GetAuditEvents(ctx, query)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", events)
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+var auditedUser = models.User{Id: "66d8420df6e5311a791e0a08", Login: "mary", Password: "12345", IndexLimit: 5, Indexes: []string{}}
+
+var recordAuditTests = []struct {
+	testName		string
+	storage			*storage.StorageMock
+	method			string
+	path			string
+	payload			string
+	expectedEvents	[]models.AuditEvent
+}{
+	{
+		testName: "Records user update with redacted password change",
+		storage: &storage.StorageMock{User: auditedUser},
+		method: http.MethodPut,
+		path: "/user/66d8420df6e5311a791e0a08",
+		payload: `{"login": "mary", "password": "new-password", "index_limit": 7}`,
+		expectedEvents: []models.AuditEvent{
+			{
+				Actor: "token:deploy-bot",
+				ActorMethod: "static_token",
+				Action: "user.update",
+				ResourceType: models.AuditResourceUser,
+				ResourceId: "66d8420df6e5311a791e0a08",
+				Before: map[string]any{"id": "66d8420df6e5311a791e0a08", "login": "mary", "password": "***", "index_limit": float64(5)},
+				After: map[string]any{"id": "66d8420df6e5311a791e0a08", "login": "mary", "password": "***", "index_limit": float64(7)},
+				Changes: []models.AuditChange{
+					{Field: "index_limit", Before: float64(5), After: float64(7)},
+					{Field: "password", Before: "***", After: "***"},
+				},
+			},
+		},
+	},
+	{
+		testName: "Records role binding deletion with state before it",
+		storage: &storage.StorageMock{
+			RoleBindings: []models.RoleBinding{{Subject: "bob", Roles: []string{"viewer"}}},
+		},
+		method: http.MethodDelete,
+		path: "/role-binding/bob",
+		expectedEvents: []models.AuditEvent{
+			{
+				Actor: "token:deploy-bot",
+				ActorMethod: "static_token",
+				Action: "role_binding.delete",
+				ResourceType: models.AuditResourceRoleBinding,
+				ResourceId: "bob",
+				Before: map[string]any{"subject": "bob", "roles": []any{"viewer"}},
+				Changes: []models.AuditChange{
+					{Field: "roles", Before: []any{"viewer"}, After: nil},
+					{Field: "subject", Before: "bob", After: nil},
+				},
+			},
+		},
+	},
+	{
+		testName: "Records webhook redelivery",
+		storage: &storage.StorageMock{
+			Webhooks: []models.Webhook{testWebhook},
+			WebhookDeliveries: []models.WebhookDelivery{testDelivery},
+		},
+		method: http.MethodPost,
+		path: "/webhook/66d8420df6e5311a791e0a0a/deliveries/66d8420df6e5311a791e0a0b/redeliver",
+		expectedEvents: []models.AuditEvent{
+			{
+				Actor: "token:deploy-bot",
+				ActorMethod: "static_token",
+				Action: "webhook.redeliver",
+				ResourceType: models.AuditResourceWebhook,
+				ResourceId: "66d8420df6e5311a791e0a0a",
+				After: map[string]any{"delivery_id": "66d8420df6e5311a791e0a0b"},
+				Changes: []models.AuditChange{
+					{Field: "delivery_id", Before: nil, After: "66d8420df6e5311a791e0a0b"},
+				},
+			},
+		},
+	},
+	{
+		testName: "Records filter hits report",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{{Id: "66d8420df6e5311a791e0a08"}},
+		},
+		method: http.MethodPost,
+		path: "/filters/stats",
+		payload: `{"hits": [{"filter_id": "66d8420df6e5311a791e0a08", "bucket": "2024-09-01T10:15:00Z", "count": 3}]}`,
+		expectedEvents: []models.AuditEvent{
+			{
+				Actor: "token:deploy-bot",
+				ActorMethod: "static_token",
+				Action: "filter.hits",
+				ResourceType: models.AuditResourceFilters,
+				After: map[string]any{"hits": []any{
+					map[string]any{"filter_id": "66d8420df6e5311a791e0a08", "bucket": "2024-09-01T10:00:00Z", "count": float64(3), "last_hit": "2024-09-01T10:00:00Z"},
+				}},
+				Changes: []models.AuditChange{
+					{Field: "hits", Before: nil, After: []any{
+						map[string]any{"filter_id": "66d8420df6e5311a791e0a08", "bucket": "2024-09-01T10:00:00Z", "count": float64(3), "last_hit": "2024-09-01T10:00:00Z"},
+					}},
+				},
+			},
+		},
+	},
+	{
+		testName: "Records nothing when mutation fails validation",
+		storage: &storage.StorageMock{User: auditedUser},
+		method: http.MethodPut,
+		path: "/user/66d8420df6e5311a791e0a08",
+		payload: `{"login": "mary"}`,
+		expectedEvents: nil,
+	},
+}
+
+func TestRecordAudit(t *testing.T) {
+	for i, test := range recordAuditTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, authConfig)
+
+		req, err := http.NewRequest(test.method, test.path, bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		req.Header.Set("Authorization", "Bearer static-token")
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		for i := range test.storage.AuditEvents {
+			assert.Equal(t, test.storage.AuditEvents[i].RequestId != "", true, "audit event without request id")
+			assert.Equal(t, test.storage.AuditEvents[i].Time.IsZero(), false, "audit event without time")
+			test.storage.AuditEvents[i].RequestId = ""
+			test.storage.AuditEvents[i].Time = test.expectedEvents[i].Time
+		}
+
+		assert.Equal(t, test.storage.AuditEvents, test.expectedEvents, "wrong audit events")
+	}
+}
+
+var getAuditEventsTests = []struct {
+	testName			string
+	query				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and audit events",
+		query: "?resource_type=user&actor=token:deploy-bot",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: []models.AuditEvent{
+				{Actor: "token:deploy-bot", Action: "user.delete", ResourceType: models.AuditResourceUser, ResourceId: "1", Changes: []models.AuditChange{}},
+			},
+		},
+	},
+	{
+		testName: "Returns 400 with invalid time range",
+		query: "?from=yesterday",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: from must be a RFC3339 timestamp",
+			FieldErrors: []utils.FieldError{
+				{Field: "from", Rule: "date-time", Message: "from must be a RFC3339 timestamp"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with too big limit",
+		query: "?limit=5000",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: limit must be between 1 and 1000",
+			FieldErrors: []utils.FieldError{
+				{Field: "limit", Rule: "max", Message: "limit must be between 1 and 1000"},
+			},
+			Data: nil,
+		},
+	},
+}
+
+func TestGetAuditEventsHandler(t *testing.T) {
+	for i, test := range getAuditEventsTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		testStorage := &storage.StorageMock{
+			AuditEvents: []models.AuditEvent{
+				{Actor: "token:deploy-bot", Action: "user.delete", ResourceType: models.AuditResourceUser, ResourceId: "1", Changes: []models.AuditChange{}},
+			},
+		}
+		server := newTestServer(t, testStorage, nil)
+
+		req, err := http.NewRequest(http.MethodGet, "/audit" + test.query, nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ut "github.com/go-playground/universal-translator"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	ErrorCodeTooManyOperations	= "too_many_operations"
+
+	defaultBulkMaxOperations	= 1000
+)
+
+type BulkItemResult struct {
+	Index			int					`json:"index"`
+	Op				string				`json:"op"`
+	Id				string				`json:"id,omitempty"`
+	Status			int					`json:"status"`
+	ErrorCode		string				`json:"errorCode,omitempty"`
+	ErrorMessage	string				`json:"errorMessage,omitempty"`
+	FieldErrors		[]utils.FieldError	`json:"fieldErrors,omitempty"`
+	Data			any					`json:"data,omitempty"`
+}
+
+type BulkResult struct {
+	Ordered		bool				`json:"ordered"`
+	Atomic		bool				`json:"atomic"`
+	Succeeded	int					`json:"succeeded"`
+	Failed		int					`json:"failed"`
+	Skipped		int					`json:"skipped"`
+	Results		[]BulkItemResult	`json:"results"`
+}
+
+func (s *Server) BulkUsers(w http.ResponseWriter, r *http.Request) {
+	items, result, ok := s.decodeBulkRequest(w, r)
+	if !ok {
+		return
+	}
+
+	canDelete, err := s.hasPermission(r, auth.PermissionUsersDelete)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	translator := utils.RequestTranslator(r)
+	operations := []models.UserBulkOperation{}
+	indexes := []int{}
+	seenIds := map[string]bool{}
+	for i, item := range items {
+		var operation models.UserBulkOperation
+		if err := json.Unmarshal(item, &operation); err != nil {
+			result.fail(i, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, utils.Translate(translator, "Invalid request payload"), nil)
+			continue
+		}
+		var exempt func(error) error
+		if operation.Op == models.BulkOperationUpdate {
+			exempt = s.exemptStoredUser(operation.Id)
+		}
+		if !s.checkBulkOperation(r, result, i, operation, operation.Op, operation.Id, seenIds, canDelete, exempt) {
+			continue
+		}
+
+		if operation.User != nil && operation.User.Indexes == nil {
+			operation.User.Indexes = []string{}
+		}
+		operations = append(operations, operation)
+		indexes = append(indexes, i)
+	}
+
+	if count := result.executable(indexes); count > 0 {
+		ctx := auditContext(r)
+		results, err := s.storage.BulkWriteUsers(ctx, operations[:count], result.Ordered, result.Atomic)
+		if err != nil {
+			writeBulkStorageError(w, r, err)
+			return
+		}
+
+		for j, operationResult := range results {
+			i := indexes[j]
+			if operationResult.Err != nil {
+				result.storageError(i, operationResult.Err, "No user with such id", translator)
+				continue
+			}
+
+			op := operations[j].Op
+			var data any
+			if op != models.BulkOperationDelete {
+				data = userData{User: operationResult.After}
+			}
+			result.succeed(i, operationResult.After.Id, data)
+		}
+	}
+
+	writeBulkResult(w, r, result, translator)
+}
+
+func (s *Server) BulkFilters(w http.ResponseWriter, r *http.Request) {
+	items, result, ok := s.decodeBulkRequest(w, r)
+	if !ok {
+		return
+	}
+
+	canDelete, err := s.hasPermission(r, auth.PermissionFiltersDelete)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	translator := utils.RequestTranslator(r)
+	operations := []models.FilterBulkOperation{}
+	indexes := []int{}
+	seenIds := map[string]bool{}
+	for i, item := range items {
+		var operation models.FilterBulkOperation
+		if err := json.Unmarshal(item, &operation); err != nil {
+			result.fail(i, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, utils.Translate(translator, "Invalid request payload"), nil)
+			continue
+		}
+		if !s.checkBulkOperation(r, result, i, operation, operation.Op, operation.Id, seenIds, canDelete, nil) {
+			continue
+		}
+
+		operations = append(operations, operation)
+		indexes = append(indexes, i)
+	}
+
+	if count := result.executable(indexes); count > 0 {
+		ctx := auditContext(r)
+		results, err := s.storage.BulkWriteFilters(ctx, operations[:count], result.Ordered, result.Atomic)
+		if err != nil {
+			writeBulkStorageError(w, r, err)
+			return
+		}
+
+		for j, operationResult := range results {
+			i := indexes[j]
+			if operationResult.Err != nil {
+				result.storageError(i, operationResult.Err, "No filter with such id", translator)
+				continue
+			}
+
+			op := operations[j].Op
+			var after any
+			if op != models.BulkOperationDelete {
+				after = operationResult.After
+			}
+			result.succeed(i, operationResult.After.Id, after)
+		}
+	}
+
+	writeBulkResult(w, r, result, translator)
+}
+
+func (s *Server) decodeBulkRequest(w http.ResponseWriter, r *http.Request) ([]json.RawMessage, *BulkResult, bool) {
+	/*
+	Operations are decoded one by one, so an operation that
+	can't be decoded fails alone instead of the whole request.
+	*/
+
+	var items []json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&items); err != nil || items == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return nil, nil, false
+	}
+
+	maxOperations := s.config.BulkMaxOperations
+	if maxOperations <= 0 {
+		maxOperations = defaultBulkMaxOperations
+	}
+	if len(items) > maxOperations {
+		utils.WriteError(w, r, http.StatusBadRequest, ErrorCodeTooManyOperations, "Bad request: " + utils.Translate(utils.RequestTranslator(r), "at most {0} operations are allowed in one request", strconv.Itoa(maxOperations)), nil)
+		return nil, nil, false
+	}
+
+	result := &BulkResult{
+		Ordered: 	r.URL.Query().Get("ordered") != "false",
+		Atomic: 	r.URL.Query().Get("atomic") == "true",
+		Results: 	make([]BulkItemResult, len(items)),
+	}
+	for i := range result.Results {
+		result.Results[i].Index = i
+	}
+
+	return items, result, true
+}
+
+func (s *Server) checkBulkOperation(r *http.Request, result *BulkResult, i int, operation any, op string, id string, seenIds map[string]bool, canDelete bool, exempt func(error) error) bool {
+	/*
+	Every resource may only be changed once per request,
+	otherwise results of its operations would depend on each other.
+	Exempt, when given, drops validation errors the operation is excused from.
+	*/
+
+	result.Results[i].Op = op
+	result.Results[i].Id = id
+	translator := utils.RequestTranslator(r)
+
+	err := s.validator.Struct(operation)
+	if err != nil && exempt != nil {
+		err = exempt(err)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+			"operation": i,
+		}).Warning(utils.FormatErrorString(err))
+		fieldErrors := utils.FieldErrors(err, translator)
+		messages := []string{}
+		for _, fieldError := range fieldErrors {
+			messages = append(messages, fieldError.Message)
+		}
+		result.fail(i, http.StatusBadRequest, utils.ErrorCodeValidationFailed, strings.Join(messages, ", "), fieldErrors)
+		return false
+	}
+	if id != "" && seenIds[id] {
+		result.fail(i, http.StatusBadRequest, utils.StatusErrorCode(http.StatusBadRequest), utils.Translate(translator, "{0} is duplicated in request", "id"), nil)
+		return false
+	}
+	seenIds[id] = true
+
+	if op == models.BulkOperationDelete && !canDelete {
+		result.fail(i, http.StatusForbidden, utils.StatusErrorCode(http.StatusForbidden), utils.Translate(translator, "Forbidden"), nil)
+		return false
+	}
+
+	return true
+}
+
+func (s *Server) exemptStoredUser(id string) func(error) error {
+	/*
+	Stored user is only looked up when its update fails validation,
+	when it can't be found errors are reported as they are and
+	the update itself fails on the missing user.
+	*/
+
+	return func(err error) error {
+		stored, getErr := s.storage.GetUser(context.TODO(), id)
+		if getErr != nil {
+			return err
+		}
+
+		return utils.ExemptStoredUser(err, stored)
+	}
+}
+
+func (result *BulkResult) executable(indexes []int) int {
+	/*
+	Returns how many of the valid operations are executed: none of them
+	in atomic mode if any operation is invalid, ones preceding the first
+	invalid operation in ordered mode and all of them otherwise.
+	*/
+
+	firstFailed := -1
+	for i, item := range result.Results {
+		if item.Status != 0 {
+			firstFailed = i
+			break
+		}
+	}
+	if firstFailed < 0 || !(result.Ordered || result.Atomic) {
+		return len(indexes)
+	}
+	if result.Atomic {
+		return 0
+	}
+
+	count := 0
+	for count < len(indexes) && indexes[count] < firstFailed {
+		count++
+	}
+
+	return count
+}
+
+func (result *BulkResult) succeed(i int, id string, data any) {
+	status := http.StatusOK
+	if result.Results[i].Op == models.BulkOperationCreate {
+		status = http.StatusCreated
+	}
+
+	result.Results[i].Id = id
+	result.Results[i].Status = status
+	result.Results[i].Data = data
+}
+
+func (result *BulkResult) fail(i int, status int, errorCode string, errorMessage string, fieldErrors []utils.FieldError) {
+	result.Results[i].Status = status
+	result.Results[i].ErrorCode = errorCode
+	result.Results[i].ErrorMessage = errorMessage
+	result.Results[i].FieldErrors = fieldErrors
+}
+
+func (result *BulkResult) storageError(i int, err error, notFoundMessage string, translator ut.Translator) {
+	switch {
+	case errors.Is(err, storage.ErrBulkOperationSkipped):
+		result.skip(i, translator)
+	case err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex:
+		result.fail(i, http.StatusNotFound, utils.StatusErrorCode(http.StatusNotFound), utils.Translate(translator, notFoundMessage), nil)
+	case errors.Is(err, storage.ErrDuplicateLogin):
+		result.fail(i, http.StatusConflict, utils.StatusErrorCode(http.StatusConflict), utils.Translate(translator, "User with such login already exists"), nil)
+	default:
+		result.fail(i, http.StatusInternalServerError, utils.StatusErrorCode(http.StatusInternalServerError), utils.Translate(translator, "Internal server error"), nil)
+	}
+}
+
+func (result *BulkResult) skip(i int, translator ut.Translator) {
+	result.fail(i, http.StatusFailedDependency, utils.StatusErrorCode(http.StatusFailedDependency), utils.Translate(translator, "Operation was not applied because another operation failed"), nil)
+}
+
+func writeBulkStorageError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, storage.ErrTransactionsUnsupported) {
+		utils.WriteJSON(w, r, http.StatusNotImplemented, false, "Atomic bulk operations are not supported by db deployment", nil)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+}
+
+func writeBulkResult(w http.ResponseWriter, r *http.Request, result *BulkResult, translator ut.Translator) {
+	/*
+	Operations that got no result were not executed
+	because operations before them failed.
+	*/
+
+	for i, item := range result.Results {
+		switch {
+		case item.Status == 0:
+			result.skip(i, translator)
+			result.Skipped++
+		case item.Status == http.StatusFailedDependency:
+			result.Skipped++
+		case item.Status >= http.StatusBadRequest:
+			result.Failed++
+		default:
+			result.Succeeded++
+		}
+	}
+
+	if result.Failed > 0 && result.Atomic {
+		utils.WriteJSON(w, r, http.StatusMultiStatus, false, "No operations were applied because some of them failed", result)
+		return
+	} else if result.Failed > 0 {
+		utils.WriteJSON(w, r, http.StatusMultiStatus, false, "Some operations failed", result)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", result)
+}
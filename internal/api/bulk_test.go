@@ -0,0 +1,426 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+var bulkUsers = []models.User{
+	{Id: "66d8420df6e5311a791e0a08", Login: "mary", Password: "12345", IndexLimit: 5, Indexes: []string{}},
+	{Id: "66d8420df6e5311a791e0a09", Login: "bob", Password: "qwerty", IndexLimit: 2, Indexes: []string{}},
+}
+
+func bulkUsersStorage(noTransactions bool) *storage.StorageMock {
+	return &storage.StorageMock{
+		Users: 			append([]models.User{}, bulkUsers...),
+		NoTransactions: noTransactions,
+	}
+}
+
+var bulkTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	config				*config.Config
+	path				string
+	payload				string
+	expectedCode		int
+	expectedResponse	utils.Response
+	expectedUsers		[]models.User
+	expectedFilters		[]models.Filter
+}{
+	{
+		testName: "Applies all operations and leaves passwords out of results",
+		storage: bulkUsersStorage(false),
+		path: "/users/bulk",
+		payload: `[
+			{"op": "create", "user": {"login": "john", "password": "secret", "index_limit": 3}},
+			{"op": "update", "id": "66d8420df6e5311a791e0a08", "user": {"login": "mary", "password": "54321", "index_limit": 10}},
+			{"op": "delete", "id": "66d8420df6e5311a791e0a09"}
+		]`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			Data: BulkResult{
+				Ordered: true,
+				Succeeded: 3,
+				Results: []BulkItemResult{
+					{Index: 0, Op: "create", Id: "000000000000000000000003", Status: http.StatusCreated, Data: userData{User: &models.User{Id: "000000000000000000000003", Login: "john", IndexLimit: 3, Indexes: []string{}}}},
+					{Index: 1, Op: "update", Id: "66d8420df6e5311a791e0a08", Status: http.StatusOK, Data: userData{User: &models.User{Id: "66d8420df6e5311a791e0a08", Login: "mary", IndexLimit: 10, Indexes: []string{}}}},
+					{Index: 2, Op: "delete", Id: "66d8420df6e5311a791e0a09", Status: http.StatusOK},
+				},
+			},
+		},
+		expectedUsers: []models.User{
+			{Id: "66d8420df6e5311a791e0a08", Login: "mary", Password: "54321", IndexLimit: 10, Indexes: []string{}},
+			{Id: "000000000000000000000003", Login: "john", Password: "secret", IndexLimit: 3, Indexes: []string{}},
+		},
+	},
+	{
+		testName: "Skips operations after failed one in ordered mode",
+		storage: bulkUsersStorage(false),
+		path: "/users/bulk",
+		payload: `[
+			{"op": "delete", "id": "66d8420df6e5311a791e0a08"},
+			{"op": "delete", "id": "66d8420df6e5311a791e0a0a"},
+			{"op": "delete", "id": "66d8420df6e5311a791e0a09"}
+		]`,
+		expectedCode: http.StatusMultiStatus,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "multi-status",
+			ErrorMessage: "Some operations failed",
+			Data: BulkResult{
+				Ordered: true,
+				Succeeded: 1,
+				Failed: 1,
+				Skipped: 1,
+				Results: []BulkItemResult{
+					{Index: 0, Op: "delete", Id: "66d8420df6e5311a791e0a08", Status: http.StatusOK},
+					{Index: 1, Op: "delete", Id: "66d8420df6e5311a791e0a0a", Status: http.StatusNotFound, ErrorCode: "not_found", ErrorMessage: "No user with such id"},
+					{Index: 2, Op: "delete", Id: "66d8420df6e5311a791e0a09", Status: http.StatusFailedDependency, ErrorCode: "failed_dependency", ErrorMessage: "Operation was not applied because another operation failed"},
+				},
+			},
+		},
+		expectedUsers: []models.User{bulkUsers[1]},
+	},
+	{
+		testName: "Returns 409 for operations with taken logins",
+		storage: bulkUsersStorage(false),
+		path: "/users/bulk?ordered=false",
+		payload: `[
+			{"op": "create", "user": {"login": "bob", "password": "secret", "index_limit": 3}},
+			{"op": "update", "id": "66d8420df6e5311a791e0a08", "user": {"login": "bob", "password": "54321", "index_limit": 10}},
+			{"op": "create", "user": {"login": "john", "password": "secret", "index_limit": 3}}
+		]`,
+		expectedCode: http.StatusMultiStatus,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "multi-status",
+			ErrorMessage: "Some operations failed",
+			Data: BulkResult{
+				Succeeded: 1,
+				Failed: 2,
+				Results: []BulkItemResult{
+					{Index: 0, Op: "create", Status: http.StatusConflict, ErrorCode: "conflict", ErrorMessage: "User with such login already exists"},
+					{Index: 1, Op: "update", Id: "66d8420df6e5311a791e0a08", Status: http.StatusConflict, ErrorCode: "conflict", ErrorMessage: "User with such login already exists"},
+					{Index: 2, Op: "create", Id: "000000000000000000000003", Status: http.StatusCreated, Data: userData{User: &models.User{Id: "000000000000000000000003", Login: "john", IndexLimit: 3, Indexes: []string{}}}},
+				},
+			},
+		},
+		expectedUsers: append(append([]models.User{}, bulkUsers...), models.User{Id: "000000000000000000000003", Login: "john", Password: "secret", IndexLimit: 3, Indexes: []string{}}),
+	},
+	{
+		testName: "Continues after failed operation in unordered mode",
+		storage: bulkUsersStorage(false),
+		path: "/users/bulk?ordered=false",
+		payload: `[
+			{"op": "delete", "id": "66d8420df6e5311a791e0a08"},
+			{"op": "delete", "id": "66d8420df6e5311a791e0a0a"},
+			{"op": "delete", "id": "66d8420df6e5311a791e0a09"}
+		]`,
+		expectedCode: http.StatusMultiStatus,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "multi-status",
+			ErrorMessage: "Some operations failed",
+			Data: BulkResult{
+				Succeeded: 2,
+				Failed: 1,
+				Results: []BulkItemResult{
+					{Index: 0, Op: "delete", Id: "66d8420df6e5311a791e0a08", Status: http.StatusOK},
+					{Index: 1, Op: "delete", Id: "66d8420df6e5311a791e0a0a", Status: http.StatusNotFound, ErrorCode: "not_found", ErrorMessage: "No user with such id"},
+					{Index: 2, Op: "delete", Id: "66d8420df6e5311a791e0a09", Status: http.StatusOK},
+				},
+			},
+		},
+		expectedUsers: []models.User{},
+	},
+	{
+		testName: "Reports every invalid operation and applies valid ones in unordered mode",
+		storage: bulkUsersStorage(false),
+		path: "/users/bulk?ordered=false",
+		payload: `[
+			{"op": "create", "user": {"login": "john smith", "password": "secret", "index_limit": 3}},
+			{"op": "create", "user": {"login": "john", "password": "secret", "index_limit": "three"}},
+			{"op": "rename", "id": "66d8420df6e5311a791e0a08"},
+			{"op": "update", "user": {"login": "mary", "password": "54321", "index_limit": 10}},
+			{"op": "delete", "id": "66d8420df6e5311a791e0a09"},
+			{"op": "update", "id": "66d8420df6e5311a791e0a09", "user": {"login": "bob", "password": "54321", "index_limit": 10}}
+		]`,
+		expectedCode: http.StatusMultiStatus,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "multi-status",
+			ErrorMessage: "Some operations failed",
+			Data: BulkResult{
+				Succeeded: 1,
+				Failed: 5,
+				Results: []BulkItemResult{
+					{
+						Index: 0,
+						Op: "create",
+						Status: http.StatusBadRequest,
+						ErrorCode: utils.ErrorCodeValidationFailed,
+						ErrorMessage: "login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes",
+						FieldErrors: []utils.FieldError{
+							{Field: "user.login", Rule: "login", Message: "login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes"},
+						},
+					},
+					{Index: 1, Status: http.StatusBadRequest, ErrorCode: utils.ErrorCodeInvalidPayload, ErrorMessage: "Invalid request payload"},
+					{
+						Index: 2,
+						Op: "rename",
+						Id: "66d8420df6e5311a791e0a08",
+						Status: http.StatusBadRequest,
+						ErrorCode: utils.ErrorCodeValidationFailed,
+						ErrorMessage: "op must be one of [create update delete], user is required",
+						FieldErrors: []utils.FieldError{
+							{Field: "op", Rule: "oneof", Message: "op must be one of [create update delete]"},
+							{Field: "user", Rule: "required_unless", Message: "user is required"},
+						},
+					},
+					{
+						Index: 3,
+						Op: "update",
+						Status: http.StatusBadRequest,
+						ErrorCode: utils.ErrorCodeValidationFailed,
+						ErrorMessage: "id is required",
+						FieldErrors: []utils.FieldError{
+							{Field: "id", Rule: "required_unless", Message: "id is required"},
+						},
+					},
+					{Index: 4, Op: "delete", Id: "66d8420df6e5311a791e0a09", Status: http.StatusOK},
+					{Index: 5, Op: "update", Id: "66d8420df6e5311a791e0a09", Status: http.StatusBadRequest, ErrorCode: "bad_request", ErrorMessage: "id is duplicated in request"},
+				},
+			},
+		},
+		expectedUsers: []models.User{bulkUsers[0]},
+	},
+	{
+		testName: "Applies nothing when operation is invalid in atomic mode",
+		storage: bulkUsersStorage(false),
+		path: "/users/bulk?atomic=true",
+		payload: `[
+			{"op": "delete", "id": "66d8420df6e5311a791e0a08"},
+			{"op": "create", "user": {"login": "john", "password": "secret"}}
+		]`,
+		expectedCode: http.StatusMultiStatus,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "multi-status",
+			ErrorMessage: "No operations were applied because some of them failed",
+			Data: BulkResult{
+				Ordered: true,
+				Atomic: true,
+				Failed: 1,
+				Skipped: 1,
+				Results: []BulkItemResult{
+					{Index: 0, Op: "delete", Id: "66d8420df6e5311a791e0a08", Status: http.StatusFailedDependency, ErrorCode: "failed_dependency", ErrorMessage: "Operation was not applied because another operation failed"},
+					{
+						Index: 1,
+						Op: "create",
+						Status: http.StatusBadRequest,
+						ErrorCode: utils.ErrorCodeValidationFailed,
+						ErrorMessage: "index_limit is required",
+						FieldErrors: []utils.FieldError{
+							{Field: "user.index_limit", Rule: "required", Message: "index_limit is required"},
+						},
+					},
+				},
+			},
+		},
+		expectedUsers: bulkUsers,
+	},
+	{
+		testName: "Rolls back applied operations when operation fails in atomic mode",
+		storage: bulkUsersStorage(false),
+		path: "/users/bulk?ordered=false&atomic=true",
+		payload: `[
+			{"op": "delete", "id": "66d8420df6e5311a791e0a08"},
+			{"op": "delete", "id": "66d8420df6e5311a791e0a0a"},
+			{"op": "create", "user": {"login": "john", "password": "secret", "index_limit": 3}}
+		]`,
+		expectedCode: http.StatusMultiStatus,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "multi-status",
+			ErrorMessage: "No operations were applied because some of them failed",
+			Data: BulkResult{
+				Atomic: true,
+				Failed: 1,
+				Skipped: 2,
+				Results: []BulkItemResult{
+					{Index: 0, Op: "delete", Id: "66d8420df6e5311a791e0a08", Status: http.StatusFailedDependency, ErrorCode: "failed_dependency", ErrorMessage: "Operation was not applied because another operation failed"},
+					{Index: 1, Op: "delete", Id: "66d8420df6e5311a791e0a0a", Status: http.StatusNotFound, ErrorCode: "not_found", ErrorMessage: "No user with such id"},
+					{Index: 2, Op: "create", Status: http.StatusFailedDependency, ErrorCode: "failed_dependency", ErrorMessage: "Operation was not applied because another operation failed"},
+				},
+			},
+		},
+		expectedUsers: bulkUsers,
+	},
+	{
+		testName: "Returns 501 for atomic mode without transactions",
+		storage: bulkUsersStorage(true),
+		path: "/users/bulk?atomic=true",
+		payload: `[{"op": "delete", "id": "66d8420df6e5311a791e0a08"}]`,
+		expectedCode: http.StatusNotImplemented,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_implemented",
+			ErrorMessage: "Atomic bulk operations are not supported by db deployment",
+		},
+		expectedUsers: bulkUsers,
+	},
+	{
+		testName: "Returns 400 with too many operations",
+		storage: bulkUsersStorage(false),
+		config: &config.Config{AuthDisabled: true, BulkMaxOperations: 1},
+		path: "/users/bulk",
+		payload: `[{"op": "delete", "id": "66d8420df6e5311a791e0a08"}, {"op": "delete", "id": "66d8420df6e5311a791e0a09"}]`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "too_many_operations",
+			ErrorMessage: "Bad request: at most 1 operations are allowed in one request",
+		},
+		expectedUsers: bulkUsers,
+	},
+	{
+		testName: "Returns 400 with empty operations",
+		storage: bulkUsersStorage(false),
+		path: "/users/bulk",
+		payload: `[]`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeInvalidPayload,
+			ErrorMessage: "Invalid request payload",
+		},
+		expectedUsers: bulkUsers,
+	},
+	{
+		testName: "Returns 500 on storage error",
+		storage: &storage.StorageMock{Error: errors.New("db is down")},
+		path: "/users/bulk",
+		payload: `[{"op": "delete", "id": "66d8420df6e5311a791e0a08"}]`,
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+		},
+	},
+	{
+		testName: "Applies filter operations",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]+$"}},
+		},
+		path: "/filters/bulk",
+		payload: `[
+			{"op": "create", "filter": {"regex": "^[0-9]+$", "action": "tag", "tag": "digits"}},
+			{"op": "create", "filter": {"regex": "[a-z"}},
+			{"op": "update", "id": "66d8420df6e5311a791e0a08", "filter": {"regex": "^[a-z]*$"}}
+		]`,
+		expectedCode: http.StatusMultiStatus,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "multi-status",
+			ErrorMessage: "Some operations failed",
+			Data: BulkResult{
+				Ordered: true,
+				Succeeded: 1,
+				Failed: 1,
+				Skipped: 1,
+				Results: []BulkItemResult{
+					{Index: 0, Op: "create", Id: "000000000000000000000002", Status: http.StatusCreated, Data: &models.Filter{Id: "000000000000000000000002", Regex: "^[0-9]+$", Action: "tag", Tag: "digits"}},
+					{
+						Index: 1,
+						Op: "create",
+						Status: http.StatusBadRequest,
+						ErrorCode: utils.ErrorCodeValidationFailed,
+						ErrorMessage: "regex must be a regular expression accepted by RE2",
+						FieldErrors: []utils.FieldError{
+							{Field: "filter.regex", Rule: "re2", Message: "regex must be a regular expression accepted by RE2"},
+						},
+					},
+					{Index: 2, Op: "update", Id: "66d8420df6e5311a791e0a08", Status: http.StatusFailedDependency, ErrorCode: "failed_dependency", ErrorMessage: "Operation was not applied because another operation failed"},
+				},
+			},
+		},
+		expectedFilters: []models.Filter{
+			{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]+$"},
+			{Id: "000000000000000000000002", Regex: "^[0-9]+$", Action: "tag", Tag: "digits"},
+		},
+	},	{
+		testName: "Keeps expired filters archived unless update moves their end into the future",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]+$", ActiveUntil: &pastTime, ArchivedAt: &pastTime},
+				{Id: "66d8420df6e5311a791e0a09", Regex: "^[0-9]+$", ActiveUntil: &pastTime, ArchivedAt: &pastTime},
+			},
+		},
+		path: "/filters/bulk",
+		payload: `[
+			{"op": "update", "id": "66d8420df6e5311a791e0a08", "filter": {"regex": "^[a-z]*$", "active_until": "2020-01-01T00:00:00Z"}},
+			{"op": "update", "id": "66d8420df6e5311a791e0a09", "filter": {"regex": "^[0-9]*$", "active_until": "2100-01-01T00:00:00Z"}}
+		]`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			Data: BulkResult{
+				Ordered: true,
+				Succeeded: 2,
+				Results: []BulkItemResult{
+					{Index: 0, Op: "update", Id: "66d8420df6e5311a791e0a08", Status: http.StatusOK, Data: &models.Filter{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]*$", ActiveUntil: &pastTime, ArchivedAt: &pastTime}},
+					{Index: 1, Op: "update", Id: "66d8420df6e5311a791e0a09", Status: http.StatusOK, Data: &models.Filter{Id: "66d8420df6e5311a791e0a09", Regex: "^[0-9]*$", ActiveUntil: &futureTime}},
+				},
+			},
+		},
+		expectedFilters: []models.Filter{
+			{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]*$", ActiveUntil: &pastTime, ArchivedAt: &pastTime},
+			{Id: "66d8420df6e5311a791e0a09", Regex: "^[0-9]*$", ActiveUntil: &futureTime},
+		},
+	},
+}
+
+func TestBulkHandlers(t *testing.T) {
+	for i, test := range bulkTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, test.config)
+
+		req, err := http.NewRequest(http.MethodPost, test.path, bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+		if test.expectedUsers != nil {
+			assert.Equal(t, test.storage.Users, test.expectedUsers, "wrong users in storage")
+		}
+		if test.expectedFilters != nil {
+			assert.Equal(t, test.storage.Filters, test.expectedFilters, "wrong filters in storage")
+		}
+	}
+}
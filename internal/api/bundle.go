@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+func (s *Server) ExportFilters(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "yaml" {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: format must be one of [json yaml]", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	filters, err := s.storage.GetAllFilters(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	bundle := models.FilterBundle{
+		Version: 	models.FilterBundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Filters: 	filters,
+	}
+
+	var body []byte
+	var contentType string
+	if format == "yaml" {
+		body, err = yaml.Marshal(&bundle)
+		contentType = "application/yaml"
+	} else {
+		body, err = json.MarshalIndent(&bundle, "", "  ")
+		contentType = "application/json"
+	}
+	if err != nil {
+		log.Errorf("Error encoding filters bundle to %s: %s", format, err)
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"request_id": r.Context().Value(utils.ContextKeyReqId),
+		"status_code": http.StatusOK,
+		"filters": len(filters),
+	}).Info("Responding to request with filters bundle")
+
+	w.Header().Add("Content-Type", contentType)
+	w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=\"filters.%s\"", format))
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+func (s *Server) ImportFilters(w http.ResponseWriter, r *http.Request) {
+	/*
+	Import is all or nothing: if any filter in the bundle is invalid
+	nothing is applied and errors are reported for every invalid entry.
+	*/
+
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = models.FilterImportModeMerge
+	}
+	if mode != models.FilterImportModeMerge && mode != models.FilterImportModeReplace {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: mode must be one of [merge replace]", nil)
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	var bundle *models.FilterBundle
+	var err error
+	if strings.Contains(r.Header.Get("Content-Type"), "yaml") {
+		err = yaml.NewDecoder(r.Body).Decode(&bundle)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&bundle)
+	}
+	if err != nil || bundle == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	if bundle.Version != models.FilterBundleVersion {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: " + utils.Translate(utils.RequestTranslator(r), "unsupported bundle version {0}", strconv.Itoa(bundle.Version)), nil)
+		return
+	}
+
+	result := models.FilterImportResult{
+		Mode: 	mode,
+		DryRun: dryRun,
+	}
+
+	translator := utils.RequestTranslator(r)
+	seenIds := map[string]bool{}
+	for i, filter := range bundle.Filters {
+		entryErrors := []string{}
+
+		if err := s.validator.Struct(filter); err != nil {
+			entryErrors = append(entryErrors, utils.TranslateErrors(err, translator)...)
+		}
+		if filter.Id != "" && seenIds[filter.Id] {
+			entryErrors = append(entryErrors, utils.Translate(translator, "{0} is duplicated in bundle", "id"))
+		}
+		seenIds[filter.Id] = true
+
+		if len(entryErrors) > 0 {
+			result.Errors = append(result.Errors, models.FilterImportEntryError{
+				Index: 	i,
+				Id: 	filter.Id,
+				Errors: entryErrors,
+			})
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warningf("Filters bundle contains %d invalid filters", len(result.Errors))
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: bundle contains invalid filters", result)
+		return
+	}
+
+	ctx := auditContext(r)
+	existing, err := s.storage.GetAllFilters(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	existingIds := map[string]bool{}
+	for _, filter := range existing {
+		existingIds[filter.Id] = true
+	}
+	for _, filter := range bundle.Filters {
+		if existingIds[filter.Id] {
+			result.Updated++
+		} else {
+			result.Created++
+		}
+	}
+	if mode == models.FilterImportModeReplace {
+		for _, filter := range existing {
+			if !seenIds[filter.Id] {
+				result.Deleted++
+			}
+		}
+	}
+
+	if !dryRun {
+		err = s.storage.ImportFilters(ctx, bundle.Filters, mode == models.FilterImportModeReplace)
+		if errors.Is(err, storage.ErrTransactionsUnsupported) {
+			utils.WriteJSON(w, r, http.StatusNotImplemented, false, "Filter import is not supported by db deployment", nil)
+			return
+		}
+		if err != nil {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+			return
+		}
+
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", result)
+}
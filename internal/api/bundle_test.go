@@ -0,0 +1,277 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+var exportFiltersTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	format				string
+	expectedCode		int
+	expectedContentType	string
+	expectedFilters		[]models.Filter
+}{
+	{
+		testName: "Returns 200 and json bundle by default",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]+$", ActiveUntil: &pastTime},
+				{Id: "66d8420df6e5311a791e0a09", Regex: "[0-9]+", Action: models.FilterActionRedact},
+			},
+		},
+		format: "",
+		expectedCode: http.StatusOK,
+		expectedContentType: "application/json",
+		expectedFilters: []models.Filter{
+			{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]+$", ActiveUntil: &pastTime},
+			{Id: "66d8420df6e5311a791e0a09", Regex: "[0-9]+", Action: models.FilterActionRedact},
+		},
+	},
+	{
+		testName: "Returns 200 and yaml bundle",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]+$", Fields: []string{"title"}},
+			},
+		},
+		format: "yaml",
+		expectedCode: http.StatusOK,
+		expectedContentType: "application/yaml",
+		expectedFilters: []models.Filter{
+			{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]+$", Fields: []string{"title"}},
+		},
+	},
+	{
+		testName: "Returns 400 with unknown format",
+		storage: &storage.StorageMock{},
+		format: "xml",
+		expectedCode: http.StatusBadRequest,
+		expectedContentType: "application/json",
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		format: "json",
+		expectedCode: http.StatusInternalServerError,
+		expectedContentType: "application/json",
+	},
+}
+
+func TestExportFiltersHandler(t *testing.T) {
+	for i, test := range exportFiltersTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(http.MethodGet, "/filters/export?format=" + test.format, nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, rr.Header().Get("Content-Type"), test.expectedContentType, "wrong content type")
+		if test.expectedCode != http.StatusOK {
+			continue
+		}
+
+		var bundle models.FilterBundle
+		if test.format == "yaml" {
+			err = yaml.Unmarshal(rr.Body.Bytes(), &bundle)
+		} else {
+			err = json.Unmarshal(rr.Body.Bytes(), &bundle)
+		}
+		if err != nil {
+			t.Fatalf("Unable to unmarshal bundle, error: %s\n", err)
+		}
+
+		expectedFilters, _ := json.Marshal(test.expectedFilters)
+		gotFilters, _ := json.Marshal(bundle.Filters)
+		assert.Equal(t, bundle.Version, models.FilterBundleVersion, "wrong bundle version")
+		assert.Equal(t, string(gotFilters), string(expectedFilters), "wrong bundle filters")
+	}
+}
+
+var importFiltersTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	query				string
+	contentType			string
+	payload				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and merge plan in dry run",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "66d8420df6e5311a791e0a08", Regex: "a"},
+				{Id: "66d8420df6e5311a791e0a09", Regex: "b"},
+			},
+		},
+		query: "?dry_run=true",
+		payload: `{"version": 1, "filters": [{"id": "66d8420df6e5311a791e0a08", "regex": "c"}, {"regex": "d"}]}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.FilterImportResult{
+				Mode: models.FilterImportModeMerge,
+				DryRun: true,
+				Created: 1,
+				Updated: 1,
+			},
+		},
+	},
+	{
+		testName: "Returns 200 and replaces filters from yaml bundle",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "66d8420df6e5311a791e0a08", Regex: "a"},
+				{Id: "66d8420df6e5311a791e0a09", Regex: "b"},
+			},
+		},
+		query: "?mode=replace",
+		contentType: "application/yaml",
+		payload: "version: 1\nfilters:\n  - id: 66d8420df6e5311a791e0a0a\n    regex: c\n    action: tag\n",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.FilterImportResult{
+				Mode: models.FilterImportModeReplace,
+				Created: 1,
+				Deleted: 2,
+			},
+		},
+	},
+	{
+		testName: "Returns 400 and errors for every invalid entry",
+		storage: &storage.StorageMock{},
+		payload: `{"version": 1, "filters": [{"regex": "+++"}, {"regex": "ok"}, {"id": "66d8420df6e5311a791e0a08", "action": "drop"}, {"id": "filter-1", "regex": "a"}]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "bad_request",
+			ErrorMessage: "Bad request: bundle contains invalid filters",
+			Data: models.FilterImportResult{
+				Mode: models.FilterImportModeMerge,
+				Errors: []models.FilterImportEntryError{
+					{
+						Index: 0,
+						Errors: []string{"regex must be a regular expression accepted by RE2"},
+					},
+					{
+						Index: 2,
+						Id: "66d8420df6e5311a791e0a08",
+						Errors: []string{"regex is required", "action must be one of [block redact tag]"},
+					},
+					{
+						Index: 3,
+						Id: "filter-1",
+						Errors: []string{"id must be a mongodb ObjectId"},
+					},
+				},
+			},
+		},
+	},
+	{
+		testName: "Returns 400 with unsupported bundle version",
+		storage: &storage.StorageMock{},
+		payload: `{"version": 2, "filters": []}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "bad_request",
+			ErrorMessage: "Bad request: unsupported bundle version 2",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with unknown mode",
+		storage: &storage.StorageMock{},
+		query: "?mode=append",
+		payload: `{"version": 1, "filters": []}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: mode must be one of [merge replace]",
+			FieldErrors: []utils.FieldError{
+				{Field: "mode", Rule: "oneof", Message: "mode must be one of [merge replace]"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 501 when db deployment does not support transactions",
+		storage: &storage.StorageMock{
+			NoTransactions: true,
+		},
+		payload: `{"version": 1, "filters": [{"regex": "a"}]}`,
+		expectedCode: http.StatusNotImplemented,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_implemented",
+			ErrorMessage: "Filter import is not supported by db deployment",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		payload: `{"version": 1, "filters": [{"regex": "a"}]}`,
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestImportFiltersHandler(t *testing.T) {
+	for i, test := range importFiltersTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(http.MethodPost, "/filters/import" + test.query, bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		req.Header.Set("Content-Type", test.contentType)
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+const (
+	ErrorCodeCursorExpired	= "cursor_expired"
+
+	defaultChangesLimit	= 100
+	maxChangesLimit		= 1000
+)
+
+func (s *Server) GetChanges(w http.ResponseWriter, r *http.Request) {
+	/*
+	Cursor is the sequence number of the last change seen, consumers
+	start without it and pass next_cursor of every response to the next
+	request. Deletions come as changes with delete or purge operation.
+	*/
+
+	since := int64(0)
+	if value := r.URL.Query().Get("since"); value != "" {
+		var err error
+		since, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || since < 0 {
+			utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: since must be a cursor returned by previous request", nil)
+			return
+		}
+	}
+
+	limit := int64(defaultChangesLimit)
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxChangesLimit {
+			utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: " + utils.Translate(utils.RequestTranslator(r), "limit must be between 1 and {0}", strconv.Itoa(maxChangesLimit)), nil)
+			return
+		}
+	}
+
+	ctx := context.TODO()
+	changes, err := s.storage.GetChanges(ctx, since, limit + 1)
+	if errors.Is(err, storage.ErrChangesCursorExpired) {
+		utils.WriteError(w, r, http.StatusGone, ErrorCodeCursorExpired, "Changes after cursor are no longer retained, start over without since", nil)
+		return
+	} else if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	feed := models.ChangeFeed{Changes: changes, NextCursor: strconv.FormatInt(since, 10)}
+	if int64(len(changes)) > limit {
+		feed.Changes = changes[:limit]
+		feed.HasMore = true
+	}
+	if len(feed.Changes) > 0 {
+		feed.NextCursor = strconv.FormatInt(feed.Changes[len(feed.Changes) - 1].Seq, 10)
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", feed)
+}
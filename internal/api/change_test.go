@@ -0,0 +1,143 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+var changeTime = time.Date(2024, 9, 4, 12, 0, 0, 0, time.UTC)
+
+var testChanges = []models.ChangeRecord{
+	{Seq: 1, ResourceType: models.AuditResourceUser, ResourceId: "1", Operation: "create", State: map[string]any{"login": "mary"}, Time: changeTime},
+	{Seq: 2, ResourceType: models.AuditResourceFilter, ResourceId: "2", Operation: "create", State: map[string]any{"regex": "^a"}, Time: changeTime},
+	{Seq: 3, ResourceType: models.AuditResourceUser, ResourceId: "1", Operation: "delete", State: map[string]any{"login": "mary"}, Time: changeTime},
+	{Seq: 4, ResourceType: models.AuditResourceUser, ResourceId: "1", Operation: "purge", Time: changeTime},
+}
+
+var changesTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	query				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and changes from the beginning",
+		storage: &storage.StorageMock{Changes: testChanges},
+		query: "?limit=2",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.ChangeFeed{Changes: testChanges[:2], NextCursor: "2", HasMore: true},
+		},
+	},
+	{
+		testName: "Returns 200 and changes after cursor",
+		storage: &storage.StorageMock{Changes: testChanges},
+		query: "?since=2&limit=2",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.ChangeFeed{Changes: testChanges[2:], NextCursor: "4", HasMore: false},
+		},
+	},
+	{
+		testName: "Returns 200 and same cursor when there are no new changes",
+		storage: &storage.StorageMock{Changes: testChanges},
+		query: "?since=4",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.ChangeFeed{Changes: []models.ChangeRecord{}, NextCursor: "4", HasMore: false},
+		},
+	},
+	{
+		testName: "Returns 410 when changes after cursor are no longer retained",
+		storage: &storage.StorageMock{Changes: testChanges[2:]},
+		query: "?since=1",
+		expectedCode: http.StatusGone,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "cursor_expired",
+			ErrorMessage: "Changes after cursor are no longer retained, start over without since",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 on invalid cursor",
+		storage: &storage.StorageMock{Changes: testChanges},
+		query: "?since=abc",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "bad_request",
+			ErrorMessage: "Bad request: since must be a cursor returned by previous request",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 on invalid limit",
+		storage: &storage.StorageMock{Changes: testChanges},
+		query: "?limit=1001",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: limit must be between 1 and 1000",
+			FieldErrors: []utils.FieldError{
+				{Field: "limit", Rule: "max", Message: "limit must be between 1 and 1000"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 500 on storage error",
+		storage: &storage.StorageMock{Error: errors.New("test error")},
+		query: "",
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestGetChangesHandler(t *testing.T) {
+	for i, test := range changesTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(http.MethodGet, "/changes" + test.query, nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/evaluation"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+type EvaluateRequest struct {
+	Document	map[string]any	`json:"document" validate:"required"`
+	DocumentKey	string			`json:"document_key,omitempty"`
+}
+
+func (s *Server) EvaluateDocument(w http.ResponseWriter, r *http.Request) {
+	var request *EvaluateRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&request) ; err != nil || request == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	err := s.validator.Struct(request)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warning(logErrorString)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
+		return
+	}
+
+	ctx := context.TODO()
+	filters, err := s.storage.GetAllFilters(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	filters = models.ActiveFilters(filters, time.Now())
+
+	result, err := evaluation.Evaluate(filters, request.Document, request.DocumentKey, s.config.EvaluateFields)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", result)
+}
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/evaluation"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+var evaluateDocumentTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	config				*config.Config
+	payload				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and none action when nothing matches",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "1", Regex: "forbidden"},
+			},
+		},
+		payload: `{"document": {"title": "hello", "body": "world"}}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: evaluation.Result{
+				Action: evaluation.ActionNone,
+				Matches: map[string][]evaluation.Match{},
+				Tags: []string{},
+				Document: map[string]any{"title": "hello", "body": "world"},
+			},
+		},
+	},
+	{
+		testName: "Returns 200 and applies filters in priority order to their fields",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "1", Regex: "secret", Fields: []string{"body"}, Action: models.FilterActionTag, Tag: "sensitive"},
+				{Id: "2", Regex: "[0-9]{4}", Fields: []string{"body", "comments.text"}, Action: models.FilterActionRedact, Priority: 10},
+			},
+		},
+		payload: `{"document": {"body": "secret 1234", "comments": [{"text": "pin 0000"}, {"text": "ok"}]}}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: evaluation.Result{
+				Action: models.FilterActionRedact,
+				Matches: map[string][]evaluation.Match{
+					"body": {
+						{FilterId: "2", Action: models.FilterActionRedact, Matches: []string{"1234"}},
+						{FilterId: "1", Action: models.FilterActionTag, Matches: []string{"secret"}},
+					},
+					"comments.0.text": {
+						{FilterId: "2", Action: models.FilterActionRedact, Matches: []string{"0000"}},
+					},
+				},
+				Tags: []string{"sensitive"},
+				Document: map[string]any{
+					"body": "secret ***",
+					"comments": []any{
+						map[string]any{"text": "pin ***"},
+						map[string]any{"text": "ok"},
+					},
+				},
+			},
+		},
+	},
+	{
+		testName: "Returns 200 and stops processing after matching filter",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "1", Regex: "spam", Action: models.FilterActionTag, StopProcessing: true, Priority: 1},
+				{Id: "2", Regex: "spam"},
+			},
+		},
+		config: &config.Config{
+			AuthDisabled: true,
+			EvaluateFields: []string{"title"},
+		},
+		payload: `{"document": {"title": "spam", "body": "spam"}}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: evaluation.Result{
+				Action: models.FilterActionTag,
+				Matches: map[string][]evaluation.Match{
+					"title": {
+						{FilterId: "1", Action: models.FilterActionTag, Matches: []string{"spam"}},
+					},
+				},
+				Tags: []string{"1"},
+				Document: map[string]any{"title": "spam", "body": "spam"},
+			},
+		},
+	},
+	{
+		testName: "Returns 200 and block action overrides other actions",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "1", Regex: "a+", Action: models.FilterActionRedact, Replacement: "-"},
+				{Id: "2", Regex: "b+"},
+			},
+		},
+		payload: `{"document": {"text": "aab"}}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: evaluation.Result{
+				Action: models.FilterActionBlock,
+				Matches: map[string][]evaluation.Match{
+					"text": {
+						{FilterId: "1", Action: models.FilterActionRedact, Matches: []string{"aa"}},
+						{FilterId: "2", Action: models.FilterActionBlock, Matches: []string{"b"}},
+					},
+				},
+				Tags: []string{},
+				Document: map[string]any{"text": "-b"},
+			},
+		},
+	},
+	{
+		testName: "Returns 200 and reports shadow filter matches without acting on them",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "1", Regex: "[0-9]+", Action: models.FilterActionRedact, Mode: models.FilterModeShadow, StopProcessing: true},
+				{Id: "2", Regex: "[0-9]+", Action: models.FilterActionTag},
+			},
+		},
+		payload: `{"document": {"text": "call 911"}}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: evaluation.Result{
+				Action: models.FilterActionTag,
+				Matches: map[string][]evaluation.Match{
+					"text": {
+						{FilterId: "1", Action: models.FilterActionRedact, Matches: []string{"911"}, Shadow: true},
+						{FilterId: "2", Action: models.FilterActionTag, Matches: []string{"911"}},
+					},
+				},
+				Tags: []string{"2"},
+				Document: map[string]any{"text": "call 911"},
+			},
+		},
+	},
+	{
+		testName: "Returns 200 and skips filters with zero rollout",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "1", Regex: "[0-9]+", RolloutPercentage: intPointer(0)},
+			},
+		},
+		payload: `{"document": {"text": "call 911"}, "document_key": "42"}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: evaluation.Result{
+				Action: evaluation.ActionNone,
+				Matches: map[string][]evaluation.Match{},
+				Tags: []string{},
+				Document: map[string]any{"text": "call 911"},
+			},
+		},
+	},
+	{
+		testName: "Returns 200 and reports filter with invalid regex while applying the others",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "1", Regex: "([0-9]+", Action: models.FilterActionBlock, Mode: models.FilterModeShadow, Priority: 10},
+				{Id: "2", Regex: "[0-9]+", Action: models.FilterActionTag, Tag: "digits"},
+			},
+		},
+		payload: `{"document": {"text": "call 911"}}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: evaluation.Result{
+				Action: models.FilterActionTag,
+				Matches: map[string][]evaluation.Match{
+					"text": {
+						{FilterId: "2", Action: models.FilterActionTag, Matches: []string{"911"}},
+					},
+				},
+				Tags: []string{"digits"},
+				Document: map[string]any{"text": "call 911"},
+				Skipped: []string{"1"},
+			},
+		},
+	},
+	{
+		testName: "Returns 500 when enforced block filter has invalid regex",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{
+				{Id: "1", Regex: "([0-9]+", Action: models.FilterActionBlock, Priority: 10},
+				{Id: "2", Regex: "[0-9]+", Action: models.FilterActionTag, Tag: "digits"},
+			},
+		},
+		payload: `{"document": {"text": "call 911"}}`,
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 without document",
+		storage: &storage.StorageMock{},
+		payload: `{}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: document is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "document", Rule: "required", Message: "document is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with invalid payload",
+		storage: &storage.StorageMock{},
+		payload: `{"document": `,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeInvalidPayload,
+			ErrorMessage: "Invalid request payload",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		payload: `{"document": {"text": "aab"}}`,
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestEvaluateDocumentHandler(t *testing.T) {
+	for i, test := range evaluateDocumentTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, test.config)
+
+		req, err := http.NewRequest(http.MethodPost, "/evaluate", bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
+
+func TestDocumentKeyCanonicalForm(t *testing.T) {
+	document := map[string]any{"text": "<b>fish & chips</b>", "lang": "en"}
+	sum := sha256.Sum256([]byte(`{"lang":"en","text":"<b>fish & chips</b>"}`))
+
+	assert.Equal(t, evaluation.DocumentKey(document), hex.EncodeToString(sum[:]), "wrong document key")
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/utils"
+	"github.com/xavesen/search-admin/internal/webhooks"
+)
+
+const (
+	defaultHeartbeatInterval	= 15 * time.Second
+	eventReset					= "reset"
+)
+
+func (s *Server) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	/*
+	Event id is the change sequence number, so a reconnecting client
+	resumes with Last-Event-ID. When changes it missed already left
+	the replay buffer, reset event is sent and the client is expected
+	to resync through /changes.
+	*/
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error("Response writer doesn't support flushing, unable to stream events")
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	selectors := []string{}
+	for _, value := range r.URL.Query()["type"] {
+		for _, selector := range strings.Split(value, ",") {
+			if selector = strings.TrimSpace(selector); selector == "" {
+				continue
+			}
+			if !webhooks.ValidSelector(selector) {
+				utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: " + utils.Translate(utils.RequestTranslator(r), "unknown event type {0}", selector), nil)
+				return
+			}
+			selectors = append(selectors, selector)
+		}
+	}
+
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("last_event_id")
+	}
+	lastSeq := int64(0)
+	if lastEventId != "" {
+		var err error
+		lastSeq, err = strconv.ParseInt(lastEventId, 10, 64)
+		if err != nil || lastSeq < 0 {
+			utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: Last-Event-ID must be an id of previously received event", nil)
+			return
+		}
+	}
+
+	subscription, replay, complete := s.events.Subscribe(lastSeq, lastEventId != "")
+	defer s.events.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventReset)
+	}
+	for _, change := range replay {
+		writeChangeEvent(w, change, selectors)
+	}
+	flusher.Flush()
+
+	heartbeatInterval := s.config.EventsHeartbeatInterval
+	if heartbeatInterval <= 0 {
+		heartbeatInterval = defaultHeartbeatInterval
+	}
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case change, ok := <-subscription.Changes:
+			if !ok {
+				return
+			}
+			writeChangeEvent(w, change, selectors)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+func writeChangeEvent(w http.ResponseWriter, change models.ChangeRecord, selectors []string) {
+	eventType := change.ResourceType + "." + change.Operation
+	if len(selectors) > 0 && !webhooks.Matches(selectors, eventType) {
+		return
+	}
+
+	data, err := json.Marshal(change)
+	if err != nil {
+		log.Errorf("Error marshalling change %d for event stream: %s", change.Seq, err)
+		return
+	}
+
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.Seq, eventType, data)
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+)
+
+var streamedChanges = []models.ChangeRecord{
+	{Seq: 1, ResourceType: models.AuditResourceUser, ResourceId: "1", Operation: "create", Time: changeTime},
+	{Seq: 2, ResourceType: models.AuditResourceFilter, ResourceId: "2", Operation: "create", Time: changeTime},
+	{Seq: 3, ResourceType: models.AuditResourceUser, ResourceId: "1", Operation: "delete", Time: changeTime},
+}
+
+var eventStreamTests = []struct {
+	testName		string
+	bufferSize		int
+	query			string
+	lastEventId		string
+	expectedCode	int
+	expectedEvents	[]string
+}{
+	{
+		testName: "Replays changes after last event id matching type",
+		bufferSize: 10,
+		query: "?type=user.*",
+		lastEventId: "1",
+		expectedCode: http.StatusOK,
+		expectedEvents: []string{
+			`id: 3` + "\n" + `event: user.delete` + "\n" + `data: {"seq":3,"resource_type":"user","resource_id":"1","operation":"delete","time":"2024-09-04T12:00:00Z"}`,
+			`: heartbeat`,
+		},
+	},
+	{
+		testName: "Sends reset when missed changes left replay buffer",
+		bufferSize: 1,
+		query: "?type=filter.create,user.delete",
+		lastEventId: "0",
+		expectedCode: http.StatusOK,
+		expectedEvents: []string{
+			`event: reset` + "\n" + `data: {}`,
+			`id: 3` + "\n" + `event: user.delete` + "\n" + `data: {"seq":3,"resource_type":"user","resource_id":"1","operation":"delete","time":"2024-09-04T12:00:00Z"}`,
+			`: heartbeat`,
+		},
+	},
+	{
+		testName: "Doesn't replay without last event id",
+		bufferSize: 10,
+		query: "",
+		lastEventId: "",
+		expectedCode: http.StatusOK,
+		expectedEvents: []string{
+			`: heartbeat`,
+		},
+	},
+	{
+		testName: "Returns 400 on unknown event type",
+		bufferSize: 10,
+		query: "?type=user.create&type=admin.*",
+		lastEventId: "",
+		expectedCode: http.StatusBadRequest,
+		expectedEvents: []string{},
+	},
+	{
+		testName: "Returns 400 on invalid last event id",
+		bufferSize: 10,
+		query: "",
+		lastEventId: "abc",
+		expectedCode: http.StatusBadRequest,
+		expectedEvents: []string{},
+	},
+}
+
+func readStreamEvent(reader *bufio.Reader) (string, error) {
+	lines := []string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	for i, test := range eventStreamTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, &storage.StorageMock{Changes: streamedChanges}, &config.Config{
+			AuthDisabled: 				true,
+			EventsPollInterval: 		time.Hour,
+			EventsBufferSize: 			test.bufferSize,
+			EventsHeartbeatInterval: 	50 * time.Millisecond,
+		})
+		httpServer := httptest.NewServer(server.router)
+
+		req, err := http.NewRequest(http.MethodGet, httpServer.URL + "/events" + test.query, nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		if test.lastEventId != "" {
+			req.Header.Set("Last-Event-ID", test.lastEventId)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Unable to send request, error: %s\n", err)
+		}
+		assert.Equal(t, resp.StatusCode, test.expectedCode, "wrong response code")
+
+		reader := bufio.NewReader(resp.Body)
+		for _, expectedEvent := range test.expectedEvents {
+			event, err := readStreamEvent(reader)
+			if err != nil {
+				t.Fatalf("Unable to read event, error: %s\n", err)
+			}
+			assert.Equal(t, event, expectedEvent, "wrong event")
+		}
+
+		if test.expectedCode == http.StatusOK {
+			assert.Equal(t, resp.Header.Get("Content-Type"), "text/event-stream", "wrong content type")
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			server.Shutdown(ctx)
+			cancel()
+
+			for {
+				if _, err := readStreamEvent(reader); err != nil {
+					assert.Equal(t, err, io.EOF, "stream is not closed on shutdown")
+					break
+				}
+			}
+		}
+
+		resp.Body.Close()
+		httpServer.Close()
+	}
+}
@@ -6,12 +6,13 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/xavesen/search-admin/internal/evaluation"
 	"github.com/xavesen/search-admin/internal/models"
 	"github.com/xavesen/search-admin/internal/utils"
 	log "github.com/sirupsen/logrus"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"regexp"
+	"time"
 )
 
 func (s *Server) CreateFilter(w http.ResponseWriter, r *http.Request) {
@@ -19,34 +20,26 @@ func (s *Server) CreateFilter(w http.ResponseWriter, r *http.Request) {
 
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&newFilter) ; err != nil {
-		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Invalid request payload", nil)
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
 		return
 	}
 
 	err := s.validator.Struct(newFilter)
 	if err != nil {
-		logErrorString, errorString := utils.FormatErrorString(err, s.translator)
+		logErrorString := utils.FormatErrorString(err)
 		log.WithFields(log.Fields{
 			"request_id": r.Context().Value(utils.ContextKeyReqId),
 			"method": r.Method,
 			"url_path": r.URL.Path,
 		}).Warning(logErrorString)
-		utils.WriteJSON(w, r, http.StatusBadRequest, false, errorString, nil)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
 		return
 	}
 
-	_, err = regexp.Compile(newFilter.Regex)
-	if err != nil {
-		log.WithFields(log.Fields{
-			"request_id": r.Context().Value(utils.ContextKeyReqId),
-			"method": r.Method,
-			"url_path": r.URL.Path,
-		}).Warningf("Error parsing regular expression '%s' passed by user: %s", newFilter.Regex, err)
-		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: regex must be a regular expression accepted by RE2", nil)
-		return
-	}
+	newFilter.ArchivedAt = nil
+	newFilter.DeletedAt = nil
 
-	ctx := context.TODO()
+	ctx := auditContext(r)
 	newFilter, err = s.storage.CreateFilter(ctx, newFilter)
 	if err != nil {
 		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
@@ -64,6 +57,10 @@ func (s *Server) GetAllFilters(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.URL.Query().Get("include_inactive") != "true" {
+		filters = models.ActiveFilters(filters, time.Now())
+	}
+
 	utils.WriteJSON(w, r, http.StatusOK, true, "", filters)
 }
 
@@ -75,7 +72,7 @@ func (s *Server) DeleteFilter(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.TODO()
+	ctx := auditContext(r)
 	err := s.storage.DeleteFilter(ctx, id)
 	if err != nil {
 		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
@@ -109,4 +106,65 @@ func (s *Server) GetFilterById(w http.ResponseWriter, r *http.Request) {
 	}
 
 	utils.WriteJSON(w, r, http.StatusOK, true, "", filter)
+}
+
+func (s *Server) UpdateFilter(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No filter id provided", nil)
+		return
+	}
+
+	var updatedFilter *models.Filter
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&updatedFilter) ; err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	err := s.validator.Struct(updatedFilter)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warning(logErrorString)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
+		return
+	}
+
+	updatedFilter.Id = id
+	updatedFilter.ArchivedAt = nil
+	updatedFilter.DeletedAt = nil
+
+	ctx := auditContext(r)
+	err = s.storage.UpdateFilter(ctx, updatedFilter)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No filter with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", updatedFilter)
+}
+
+func (s *Server) GetCompiledFilters(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+	filters, err := s.storage.GetAllFilters(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	if r.URL.Query().Get("include_inactive") != "true" {
+		filters = models.ActiveFilters(filters, time.Now())
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", evaluation.Compile(filters, s.config.EvaluateFields))
 }
\ No newline at end of file
@@ -9,8 +9,10 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/evaluation"
 	"github.com/xavesen/search-admin/internal/models"
 	"github.com/xavesen/search-admin/internal/storage"
 	"github.com/xavesen/search-admin/internal/utils"
@@ -53,7 +55,32 @@ var createFilterTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: regex is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "regex", Rule: "required", Message: "regex is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 when filter expires before it becomes active",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		payload: &models.Filter{
+			Regex: "^[a-zA-Z]+$",
+			ActiveFrom: &futureTime,
+			ActiveUntil: &pastTime,
+		},
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: active_until must be after active_from",
+			FieldErrors: []utils.FieldError{
+				{Field: "active_until", Rule: "after_active_from", Message: "active_until must be after active_from"},
+			},
 			Data: nil,
 		},
 	},
@@ -68,7 +95,11 @@ var createFilterTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: regex must be a regular expression accepted by RE2",
+			FieldErrors: []utils.FieldError{
+				{Field: "regex", Rule: "regex", Message: "regex must be a regular expression accepted by RE2"},
+			},
 			Data: nil,
 		},
 	},
@@ -83,6 +114,7 @@ var createFilterTests = []struct {
 		expectedCode: http.StatusInternalServerError,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "internal_server_error",
 			ErrorMessage: "Internal server error",
 			Data: nil,
 		},
@@ -93,7 +125,7 @@ func TestCreateFilterHandler(t *testing.T) {
 	for i, test := range createFilterTests {
 		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
 
-		server := NewServer("", test.storage, nil)
+		server := newTestServer(t, test.storage, nil)
 
 		marshaledPayload, err := json.Marshal(test.payload)
 		if err != nil {
@@ -118,9 +150,15 @@ func TestCreateFilterHandler(t *testing.T) {
 	}
 }
 
+var (
+	pastTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	futureTime = time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
 var getAllFiltersTests = []struct {
 	testName			string
 	storage				*storage.StorageMock
+	query				string
 	expectedCode		int
 	expectedResponse	utils.Response
 }{
@@ -176,6 +214,71 @@ var getAllFiltersTests = []struct {
 			Data: []models.Filter{},
 		},
 	},
+	{
+		testName: "Return 200 and only active filters",
+		storage: &storage.StorageMock{
+			Error: 		nil,
+			Filters:	[]models.Filter{
+				{
+					Id:	"1",
+					Regex: "^[a-zA-Z]+$",
+					ActiveUntil: &pastTime,
+				},
+				{
+					Id:	"2",
+					Regex: "^[a-zA-Z0-9]+$",
+					ActiveFrom: &pastTime,
+					ActiveUntil: &futureTime,
+				},
+				{
+					Id:	"3",
+					Regex: "^[\\p{L}]+$",
+					ActiveFrom: &futureTime,
+				},
+			},
+		},
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: []models.Filter{
+				{
+					Id:	"2",
+					Regex: "^[a-zA-Z0-9]+$",
+					ActiveFrom: &pastTime,
+					ActiveUntil: &futureTime,
+				},
+			},
+		},
+	},
+	{
+		testName: "Return 200 and inactive filters when asked to",
+		storage: &storage.StorageMock{
+			Error: 		nil,
+			Filters:	[]models.Filter{
+				{
+					Id:	"1",
+					Regex: "^[a-zA-Z]+$",
+					ActiveUntil: &pastTime,
+					ArchivedAt: &pastTime,
+				},
+			},
+		},
+		query: "?include_inactive=true",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: []models.Filter{
+				{
+					Id:	"1",
+					Regex: "^[a-zA-Z]+$",
+					ActiveUntil: &pastTime,
+					ArchivedAt: &pastTime,
+				},
+			},
+		},
+	},
 	{
 		testName: "Return 500 when DB returns an error",
 		storage: &storage.StorageMock{
@@ -198,6 +301,7 @@ var getAllFiltersTests = []struct {
 		expectedCode: http.StatusInternalServerError,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "internal_server_error",
 			ErrorMessage: "Internal server error",
 			Data: nil,
 		},
@@ -208,9 +312,9 @@ func TestGetAllFiltersHandler(t *testing.T) {
 	for i, test := range getAllFiltersTests {
 		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
 
-		server := NewServer("", test.storage, nil)
+		server := newTestServer(t, test.storage, nil)
 
-		req, err := http.NewRequest(http.MethodGet, "/filters", nil)
+		req, err := http.NewRequest(http.MethodGet, "/filters" + test.query, nil)
 		if err != nil {
 			t.Fatalf("Unable to create request, error: %s\n", err)
 		}
@@ -257,6 +361,7 @@ var deleteFilterTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No filter with such id",
 			Data: nil,
 		},
@@ -270,6 +375,7 @@ var deleteFilterTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No filter with such id",
 			Data: nil,
 		},
@@ -283,6 +389,7 @@ var deleteFilterTests = []struct {
 		expectedCode: http.StatusInternalServerError,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "internal_server_error",
 			ErrorMessage: "Internal server error",
 			Data: nil,
 		},
@@ -293,7 +400,7 @@ func TestDeleteFilterHandler(t *testing.T) {
 	for i, test := range deleteFilterTests {
 		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
 
-		server := NewServer("", test.storage, nil)
+		server := newTestServer(t, test.storage, nil)
 
 		path := fmt.Sprintf("/filter/%s", test.filterId)
 		req, err := http.NewRequest(http.MethodDelete, path, nil)
@@ -350,6 +457,7 @@ var getFilterByIdTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No filter with such id",
 			Data: nil,
 		},
@@ -363,6 +471,7 @@ var getFilterByIdTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No filter with such id",
 			Data: nil,
 		},
@@ -376,6 +485,7 @@ var getFilterByIdTests = []struct {
 		expectedCode: http.StatusInternalServerError,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "internal_server_error",
 			ErrorMessage: "Internal server error",
 			Data: nil,
 		},
@@ -386,7 +496,7 @@ func TestGetFilterByIdHandler(t *testing.T) {
 	for i, test := range getFilterByIdTests {
 		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
 
-		server := NewServer("", test.storage, nil)
+		server := newTestServer(t, test.storage, nil)
 
 		path := fmt.Sprintf("/filter/%s", test.filterId)
 		req, err := http.NewRequest(http.MethodGet, path, nil)
@@ -405,4 +515,305 @@ func TestGetFilterByIdHandler(t *testing.T) {
 		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
 		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
 	}
-}
\ No newline at end of file
+}
+
+var updateFilterTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	filterId			string
+	payload				*models.Filter
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and updated filter",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		filterId: "66d8420df6e5311a791e0a08",
+		payload: &models.Filter{
+			Regex: "^[a-zA-Z]+$",
+			Mode: models.FilterModeShadow,
+			RolloutPercentage: intPointer(25),
+		},
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.Filter{
+				Id:	"66d8420df6e5311a791e0a08",
+				Regex: "^[a-zA-Z]+$",
+				Mode: models.FilterModeShadow,
+				RolloutPercentage: intPointer(25),
+			},
+		},
+	},
+	{
+		testName: "Returns 200 and keeps filter archived when it stays expired",
+		storage: &storage.StorageMock{
+			Filter: models.Filter{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]+$", ActiveUntil: &pastTime, ArchivedAt: &pastTime},
+		},
+		filterId: "66d8420df6e5311a791e0a08",
+		payload: &models.Filter{
+			Regex: "^[a-zA-Z]+$",
+			ActiveUntil: &pastTime,
+		},
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.Filter{
+				Id:	"66d8420df6e5311a791e0a08",
+				Regex: "^[a-zA-Z]+$",
+				ActiveUntil: &pastTime,
+				ArchivedAt: &pastTime,
+			},
+		},
+	},
+	{
+		testName: "Returns 200 and unarchives filter when its end moves into the future",
+		storage: &storage.StorageMock{
+			Filter: models.Filter{Id: "66d8420df6e5311a791e0a08", Regex: "^[a-z]+$", ActiveUntil: &pastTime, ArchivedAt: &pastTime},
+		},
+		filterId: "66d8420df6e5311a791e0a08",
+		payload: &models.Filter{
+			Regex: "^[a-zA-Z]+$",
+			ActiveUntil: &futureTime,
+		},
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.Filter{
+				Id:	"66d8420df6e5311a791e0a08",
+				Regex: "^[a-zA-Z]+$",
+				ActiveUntil: &futureTime,
+			},
+		},
+	},
+	{
+		testName: "Returns 400 with unknown mode",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		filterId: "66d8420df6e5311a791e0a08",
+		payload: &models.Filter{
+			Regex: "^[a-zA-Z]+$",
+			Mode: "sometimes",
+		},
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: mode must be one of [enforce shadow]",
+			FieldErrors: []utils.FieldError{
+				{Field: "mode", Rule: "oneof", Message: "mode must be one of [enforce shadow]"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with rollout percentage above 100",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		filterId: "66d8420df6e5311a791e0a08",
+		payload: &models.Filter{
+			Regex: "^[a-zA-Z]+$",
+			RolloutPercentage: intPointer(101),
+		},
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: rollout_percentage must be between 0 and 100",
+			FieldErrors: []utils.FieldError{
+				{Field: "rollout_percentage", Rule: "max", Message: "rollout_percentage must be between 0 and 100"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with wrong regex",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		filterId: "66d8420df6e5311a791e0a08",
+		payload: &models.Filter{
+			Regex: "+++",
+		},
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: regex must be a regular expression accepted by RE2",
+			FieldErrors: []utils.FieldError{
+				{Field: "regex", Rule: "regex", Message: "regex must be a regular expression accepted by RE2"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 404 when no such id in db",
+		storage: &storage.StorageMock{
+			Error: 	mongo.ErrNoDocuments,
+		},
+		filterId: "66d8420df6e5311a791e0a08",
+		payload: &models.Filter{
+			Regex: "^[a-zA-Z]+$",
+		},
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No filter with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		filterId: "66d8420df6e5311a791e0a08",
+		payload: &models.Filter{
+			Regex: "^[a-zA-Z]+$",
+		},
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func intPointer(value int) *int {
+	return &value
+}
+
+func TestUpdateFilterHandler(t *testing.T) {
+	for i, test := range updateFilterTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		marshaledPayload, err := json.Marshal(test.payload)
+		if err != nil {
+			t.Fatalf("Unable to marshal payload, error: %s\n", err)
+		}
+
+		path := fmt.Sprintf("/filter/%s", test.filterId)
+		req, err := http.NewRequest(http.MethodPut, path, bytes.NewBuffer(marshaledPayload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
+
+var getCompiledFiltersTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and filters ordered with resolved defaults",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+			Filters:	[]models.Filter{
+				{
+					Id:	"1",
+					Regex: "^[a-zA-Z]+$",
+				},
+				{
+					Id:	"2",
+					Regex: "[0-9]+",
+					Fields: []string{"body"},
+					Action: models.FilterActionRedact,
+					Priority: 5,
+					Mode: models.FilterModeShadow,
+					RolloutPercentage: intPointer(10),
+				},
+			},
+		},
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: evaluation.CompiledSet{
+				Version: "d95609690027c208",
+				Rollout: evaluation.NewRolloutSpec(),
+				Filters: []evaluation.CompiledFilter{
+					{
+						Id: "2",
+						Regex: "[0-9]+",
+						Fields: []string{"body"},
+						Action: models.FilterActionRedact,
+						Replacement: "***",
+						Priority: 5,
+						Mode: models.FilterModeShadow,
+						RolloutPercentage: 10,
+					},
+					{
+						Id: "1",
+						Regex: "^[a-zA-Z]+$",
+						Fields: []string{},
+						Action: models.FilterActionBlock,
+						Mode: models.FilterModeEnforce,
+						RolloutPercentage: 100,
+					},
+				},
+			},
+		},
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestGetCompiledFiltersHandler(t *testing.T) {
+	for i, test := range getCompiledFiltersTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(http.MethodGet, "/filters/compiled", nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
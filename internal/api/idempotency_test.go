@@ -0,0 +1,309 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+var idempotencyConfig = &config.Config{
+	AuthTokens: 	[]string{"bot-a:token-a", "bot-b:token-b"},
+	Superadmins: 	[]string{"token:bot-a", "token:bot-b"},
+}
+
+var idempotentUser = models.User{Id: "1", Login: "mary", Password: "12345", IndexLimit: 5}
+
+var replayedIdempotentUser = models.User{Id: "1", Login: "mary", Password: "***", IndexLimit: 5}
+
+type idempotentRequest struct {
+	path				string
+	token				string
+	idempotencyKey		string
+	payload				string
+	expectedCode		int
+	expectedReplayed	string
+	expectedResponse	utils.Response
+}
+
+var idempotencyTests = []struct {
+	testName	string
+	storage		*storage.StorageMock
+	requests	[]idempotentRequest
+}{
+	{
+		testName: "Replays stored response with redacted password for repeated key",
+		storage: &storage.StorageMock{},
+		requests: []idempotentRequest{
+			{
+				path: "/user",
+				token: "token-a",
+				idempotencyKey: "create-mary",
+				payload: `{"login": "mary", "password": "12345", "index_limit": 5}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: idempotentUser},
+			},
+			{
+				path: "/user",
+				token: "token-a",
+				idempotencyKey: "create-mary",
+				payload: `{"index_limit": 5, "password": "12345",   "login": "mary"}`,
+				expectedCode: http.StatusCreated,
+				expectedReplayed: "true",
+				expectedResponse: utils.Response{Success: true, Data: replayedIdempotentUser},
+			},
+		},
+	},
+	{
+		testName: "Returns 422 when key is reused with different body",
+		storage: &storage.StorageMock{},
+		requests: []idempotentRequest{
+			{
+				path: "/user",
+				token: "token-a",
+				idempotencyKey: "create-mary",
+				payload: `{"login": "mary", "password": "12345", "index_limit": 5}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: idempotentUser},
+			},
+			{
+				path: "/user",
+				token: "token-a",
+				idempotencyKey: "create-mary",
+				payload: `{"login": "mary", "password": "12345", "index_limit": 6}`,
+				expectedCode: http.StatusUnprocessableEntity,
+				expectedResponse: utils.Response{
+					Success: false,
+					ErrorCode: "idempotency_key_reused",
+					ErrorMessage: "Idempotency key is already used for a different request",
+				},
+			},
+		},
+	},
+	{
+		testName: "Returns 422 when key is reused on different endpoint",
+		storage: &storage.StorageMock{},
+		requests: []idempotentRequest{
+			{
+				path: "/filter",
+				token: "token-a",
+				idempotencyKey: "create",
+				payload: `{"regex": "^[a-z]+$"}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: models.Filter{Id: "1", Regex: "^[a-z]+$"}},
+			},
+			{
+				path: "/user",
+				token: "token-a",
+				idempotencyKey: "create",
+				payload: `{"login": "mary", "password": "12345", "index_limit": 5}`,
+				expectedCode: http.StatusUnprocessableEntity,
+				expectedResponse: utils.Response{
+					Success: false,
+					ErrorCode: "idempotency_key_reused",
+					ErrorMessage: "Idempotency key is already used for a different request",
+				},
+			},
+		},
+	},
+	{
+		testName: "Handles requests without key or with different keys every time",
+		storage: &storage.StorageMock{},
+		requests: []idempotentRequest{
+			{
+				path: "/filter",
+				token: "token-a",
+				payload: `{"regex": "^[a-z]+$"}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: models.Filter{Id: "1", Regex: "^[a-z]+$"}},
+			},
+			{
+				path: "/filter",
+				token: "token-a",
+				payload: `{"regex": "^[a-z]+$"}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: models.Filter{Id: "1", Regex: "^[a-z]+$"}},
+			},
+			{
+				path: "/filter",
+				token: "token-a",
+				idempotencyKey: "first",
+				payload: `{"regex": "^[a-z]+$"}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: models.Filter{Id: "1", Regex: "^[a-z]+$"}},
+			},
+			{
+				path: "/filter",
+				token: "token-a",
+				idempotencyKey: "second",
+				payload: `{"regex": "^[a-z]+$"}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: models.Filter{Id: "1", Regex: "^[a-z]+$"}},
+			},
+		},
+	},
+	{
+		testName: "Scopes keys to principal",
+		storage: &storage.StorageMock{},
+		requests: []idempotentRequest{
+			{
+				path: "/filter",
+				token: "token-a",
+				idempotencyKey: "create",
+				payload: `{"regex": "^[a-z]+$"}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: models.Filter{Id: "1", Regex: "^[a-z]+$"}},
+			},
+			{
+				path: "/filter",
+				token: "token-b",
+				idempotencyKey: "create",
+				payload: `{"regex": "^[0-9]+$"}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: models.Filter{Id: "1", Regex: "^[0-9]+$"}},
+			},
+		},
+	},
+	{
+		testName: "Replays stored validation error",
+		storage: &storage.StorageMock{},
+		requests: []idempotentRequest{
+			{
+				path: "/user",
+				token: "token-a",
+				idempotencyKey: "create-mary",
+				payload: `{"login": "mary smith", "password": "12345", "index_limit": 5}`,
+				expectedCode: http.StatusBadRequest,
+				expectedResponse: utils.Response{
+					Success: false,
+					ErrorCode: utils.ErrorCodeValidationFailed,
+					ErrorMessage: "Bad request: login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes",
+					FieldErrors: []utils.FieldError{
+						{Field: "login", Rule: "login", Message: "login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes"},
+					},
+				},
+			},
+			{
+				path: "/user",
+				token: "token-a",
+				idempotencyKey: "create-mary",
+				payload: `{"login": "mary smith", "password": "12345", "index_limit": 5}`,
+				expectedCode: http.StatusBadRequest,
+				expectedReplayed: "true",
+				expectedResponse: utils.Response{
+					Success: false,
+					ErrorCode: utils.ErrorCodeValidationFailed,
+					ErrorMessage: "Bad request: login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes",
+					FieldErrors: []utils.FieldError{
+						{Field: "login", Rule: "login", Message: "login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes"},
+					},
+				},
+			},
+		},
+	},
+	{
+		testName: "Handles request again when stored key has expired",
+		storage: &storage.StorageMock{
+			IdempotencyRecords: []models.IdempotencyRecord{
+				{
+					Key: "bot-a:create-mary",
+					Fingerprint: "stale",
+					Status: models.IdempotencyStatusCompleted,
+					StatusCode: http.StatusCreated,
+					ExpiresAt: time.Now().Add(-time.Minute),
+				},
+			},
+		},
+		requests: []idempotentRequest{
+			{
+				path: "/user",
+				token: "token-a",
+				idempotencyKey: "create-mary",
+				payload: `{"login": "mary", "password": "12345", "index_limit": 5}`,
+				expectedCode: http.StatusCreated,
+				expectedResponse: utils.Response{Success: true, Data: idempotentUser},
+			},
+		},
+	},
+	{
+		testName: "Returns 400 with too long key",
+		storage: &storage.StorageMock{},
+		requests: []idempotentRequest{
+			{
+				path: "/filter",
+				token: "token-a",
+				idempotencyKey: strings.Repeat("k", 256),
+				payload: `{"regex": "^[a-z]+$"}`,
+				expectedCode: http.StatusBadRequest,
+				expectedResponse: utils.Response{
+					Success: false,
+					ErrorCode: utils.ErrorCodeValidationFailed,
+					ErrorMessage: "Bad request: Idempotency-Key must be at most 255 characters in length",
+					FieldErrors: []utils.FieldError{
+						{Field: "Idempotency-Key", Rule: "max", Message: "Idempotency-Key must be at most 255 characters in length"},
+					},
+				},
+			},
+		},
+	},
+	{
+		testName: "Returns 500 when key can't be stored",
+		storage: &storage.StorageMock{Error: errors.New("db is down")},
+		requests: []idempotentRequest{
+			{
+				path: "/filter",
+				token: "token-a",
+				idempotencyKey: "create",
+				payload: `{"regex": "^[a-z]+$"}`,
+				expectedCode: http.StatusInternalServerError,
+				expectedResponse: utils.Response{
+					Success: false,
+					ErrorCode: "internal_server_error",
+					ErrorMessage: "Internal server error",
+				},
+			},
+		},
+	},
+}
+
+func TestIdempotency(t *testing.T) {
+	for i, test := range idempotencyTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, idempotencyConfig)
+
+		for _, request := range test.requests {
+			req, err := http.NewRequest(http.MethodPost, request.path, bytes.NewBufferString(request.payload))
+			if err != nil {
+				t.Fatalf("Unable to create request, error: %s\n", err)
+			}
+			req.Header.Set("Authorization", "Bearer " + request.token)
+			if request.idempotencyKey != "" {
+				req.Header.Set("Idempotency-Key", request.idempotencyKey)
+			}
+
+			rr := httptest.NewRecorder()
+			server.router.ServeHTTP(rr, req)
+
+			expectedResp, err := json.Marshal(request.expectedResponse)
+			if err != nil {
+				t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+			}
+
+			assert.Equal(t, rr.Code, request.expectedCode, "wrong response code")
+			assert.Equal(t, rr.Header().Get("Idempotent-Replayed"), request.expectedReplayed, "wrong replayed header")
+			assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+		}
+	}
+}
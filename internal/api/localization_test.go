@@ -0,0 +1,201 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var localizationTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	method				string
+	path				string
+	acceptLanguage		string
+	payload				string
+	expectedCode		int
+	expectedLanguage	string
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns english message without Accept-Language",
+		storage: &storage.StorageMock{Error: mongo.ErrNoDocuments},
+		method: http.MethodGet,
+		path: "/user/66d8420df6e5311a791e0a08",
+		expectedCode: http.StatusNotFound,
+		expectedLanguage: "en",
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No user with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns russian handler message",
+		storage: &storage.StorageMock{Error: mongo.ErrNoDocuments},
+		method: http.MethodGet,
+		path: "/user/66d8420df6e5311a791e0a08",
+		acceptLanguage: "ru",
+		expectedCode: http.StatusNotFound,
+		expectedLanguage: "ru",
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "Нет пользователя с таким id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns russian for regional tag",
+		storage: &storage.StorageMock{Error: mongo.ErrNoDocuments},
+		method: http.MethodGet,
+		path: "/user/66d8420df6e5311a791e0a08",
+		acceptLanguage: "ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7",
+		expectedCode: http.StatusNotFound,
+		expectedLanguage: "ru",
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "Нет пользователя с таким id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns most preferred supported language",
+		storage: &storage.StorageMock{Error: mongo.ErrNoDocuments},
+		method: http.MethodGet,
+		path: "/user/66d8420df6e5311a791e0a08",
+		acceptLanguage: "de;q=1, ru;q=0.5, en;q=0.8",
+		expectedCode: http.StatusNotFound,
+		expectedLanguage: "en",
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No user with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns english when no accepted language is supported",
+		storage: &storage.StorageMock{Error: mongo.ErrNoDocuments},
+		method: http.MethodGet,
+		path: "/user/66d8420df6e5311a791e0a08",
+		acceptLanguage: "de, ru;q=0",
+		expectedCode: http.StatusNotFound,
+		expectedLanguage: "en",
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No user with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns russian schema validation messages",
+		storage: &storage.StorageMock{},
+		method: http.MethodPost,
+		path: "/user",
+		acceptLanguage: "ru",
+		payload: `{"login": "tenant", "index_limit": "ten"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedLanguage: "ru",
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Неверный запрос: index_limit должен быть целым числом, password обязательное поле",
+			FieldErrors: []utils.FieldError{
+				{Field: "index_limit", Rule: "type", Message: "index_limit должен быть целым числом"},
+				{Field: "password", Rule: "required", Message: "password обязательное поле"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns russian validator messages",
+		storage: &storage.StorageMock{},
+		method: http.MethodPost,
+		path: "/filter",
+		acceptLanguage: "ru",
+		payload: `{"regex": "^[a-z]+$", "active_from": "2030-01-01T00:00:00Z", "active_until": "2020-01-01T00:00:00Z"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedLanguage: "ru",
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Неверный запрос: active_until должен быть позже active_from",
+			FieldErrors: []utils.FieldError{
+				{Field: "active_until", Rule: "after_active_from", Message: "active_until должен быть позже active_from"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns russian handler message with parameters",
+		storage: &storage.StorageMock{User: keyOwner},
+		method: http.MethodPost,
+		path: "/user/66d8420df6e5311a791e0a08/keys",
+		acceptLanguage: "ru",
+		payload: `{"name": "ingest", "scopes": ["products", "payments"]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedLanguage: "ru",
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "bad_request",
+			ErrorMessage: "Неверный запрос: область payments не является индексом пользователя",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns russian invalid payload message",
+		storage: &storage.StorageMock{},
+		method: http.MethodPost,
+		path: "/filter",
+		acceptLanguage: "ru",
+		expectedCode: http.StatusBadRequest,
+		expectedLanguage: "ru",
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeInvalidPayload,
+			ErrorMessage: "Некорректное тело запроса",
+			Data: nil,
+		},
+	},
+}
+
+func TestLocalization(t *testing.T) {
+	for i, test := range localizationTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(test.method, test.path, bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		if test.acceptLanguage != "" {
+			req.Header.Set("Accept-Language", test.acceptLanguage)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, rr.Header().Get("Content-Language"), test.expectedLanguage, "wrong content language")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
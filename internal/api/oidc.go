@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+const (
+	oidcStateCookie			= "oidc_state"
+	oidcStateCookieMaxAge	= 600
+	oidcStateBytes			= 32
+)
+
+func (s *Server) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	/*
+	State, nonce and pkce verifier are kept in a short-lived cookie,
+	so callback can be checked without keeping login attempts in db.
+	*/
+
+	values := make([]string, 3)
+	for i := range values {
+		value, err := auth.RandomToken(oidcStateBytes)
+		if err != nil {
+			log.Errorf("Error generating oidc login state: %s", err)
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+			return
+		}
+		values[i] = value
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	ctx := context.TODO()
+	authURL, err := s.oidc.AuthCodeURL(ctx, state, nonce, verifier)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusBadGateway, false, "Identity provider is unavailable", nil)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name: 		oidcStateCookie,
+		Value: 		strings.Join(values, "."),
+		Path: 		"/oidc",
+		MaxAge: 	oidcStateCookieMaxAge,
+		HttpOnly: 	true,
+		Secure: 	strings.HasPrefix(s.config.OIDCRedirectURL, "https://"),
+		SameSite: 	http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+func (s *Server) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"error": providerError,
+			"error_description": query.Get("error_description"),
+		}).Warning("Identity provider returned error to oidc callback")
+		utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Identity provider rejected login", nil)
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No oidc login in progress", nil)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/oidc", MaxAge: -1})
+
+	values := strings.Split(cookie.Value, ".")
+	if len(values) != 3 || query.Get("state") == "" || query.Get("state") != values[0] {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Invalid oidc login state", nil)
+		return
+	}
+	nonce, verifier := values[1], values[2]
+
+	code := query.Get("code")
+	if code == "" {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No authorization code provided", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	idToken, err := s.oidc.Exchange(ctx, code, verifier)
+	if err == auth.ErrInvalidCredentials {
+		utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Invalid credentials", nil)
+		return
+	} else if err != nil {
+		utils.WriteJSON(w, r, http.StatusBadGateway, false, "Identity provider is unavailable", nil)
+		return
+	}
+
+	principal, expiresAt, err := s.oidc.VerifyIDToken(ctx, idToken, nonce)
+	if err == auth.ErrInvalidCredentials {
+		utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Invalid credentials", nil)
+		return
+	} else if err != nil {
+		utils.WriteJSON(w, r, http.StatusBadGateway, false, "Identity provider is unavailable", nil)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"request_id": r.Context().Value(utils.ContextKeyReqId),
+		"subject": principal.Subject,
+		"roles": principal.Roles,
+	}).Info("Successful oidc login")
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", models.LoginResponse{Token: idToken, ExpiresAt: expiresAt})
+}
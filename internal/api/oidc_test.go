@@ -0,0 +1,380 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/middleware"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+const testOIDCClientId = "search-admin"
+
+type stubIssuer struct {
+	server	*httptest.Server
+	mu		sync.Mutex
+	keys	map[string]*rsa.PrivateKey
+	nonce	string
+
+	jwksFetches	int
+	jwksDelay	time.Duration
+}
+
+func newStubIssuer() *stubIssuer {
+	/*
+	Minimal oidc issuer with discovery, jwks and token endpoints,
+	token endpoint issues id token for code "good-code".
+	*/
+
+	issuer := &stubIssuer{keys: map[string]*rsa.PrivateKey{}}
+	issuer.rotateKey("key-1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer": issuer.server.URL,
+			"authorization_endpoint": issuer.server.URL + "/authorize",
+			"token_endpoint": issuer.server.URL + "/token",
+			"jwks_uri": issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+
+		issuer.jwksFetches++
+		time.Sleep(issuer.jwksDelay)
+
+		keys := []map[string]string{}
+		for kid, key := range issuer.keys {
+			keys = append(keys, map[string]string{
+				"kid": kid,
+				"kty": "RSA",
+				"use": "sig",
+				"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != "good-code" || r.Form.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idToken := issuer.sign("key-1", jwt.MapClaims{
+			"iss": issuer.server.URL,
+			"aud": testOIDCClientId,
+			"sub": "carol",
+			"groups": []string{"search-editors"},
+			"nonce": issuer.nonce,
+			"exp": time.Now().Add(time.Hour).Unix(),
+		})
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+	issuer.server = httptest.NewServer(mux)
+
+	return issuer
+}
+
+func (i *stubIssuer) rotateKey(kid string) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys[kid] = key
+}
+
+func (i *stubIssuer) sign(kid string, claims jwt.MapClaims) string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, _ := token.SignedString(i.keys[kid])
+	return signed
+}
+
+func (i *stubIssuer) claims(subject string, groups []string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss": i.server.URL,
+		"aud": testOIDCClientId,
+		"sub": subject,
+		"groups": groups,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func oidcTestConfig(issuer *stubIssuer) *config.Config {
+	return &config.Config{
+		OIDCIssuer: 		issuer.server.URL,
+		OIDCClientId: 		testOIDCClientId,
+		OIDCRedirectURL: 	"http://search-admin.local/oidc/callback",
+		OIDCGroupRoles: 	[]string{"search-viewers:viewer", "search-editors:filter-editor"},
+	}
+}
+
+func TestOIDCBearerTokens(t *testing.T) {
+	issuer := newStubIssuer()
+	defer issuer.server.Close()
+
+	wrongAudience := issuer.claims("carol", []string{"search-viewers"})
+	wrongAudience["aud"] = "someone-else"
+	expired := issuer.claims("carol", []string{"search-viewers"})
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	server := newTestServer(t, &storage.StorageMock{Filters: []models.Filter{}}, oidcTestConfig(issuer))
+
+	var oidcBearerTests = []struct {
+		testName			string
+		token				func() string
+		expectedCode		int
+		expectedResponse	utils.Response
+	}{
+		{
+			testName: "Returns 200 when group maps to role with permission",
+			token: func() string { return issuer.sign("key-1", issuer.claims("carol", []string{"search-viewers"})) },
+			expectedCode: http.StatusOK,
+			expectedResponse: utils.Response{
+				Success: true,
+				ErrorMessage: "",
+				Data: []models.Filter{},
+			},
+		},
+		{
+			testName: "Returns 403 when groups map to no roles",
+			token: func() string { return issuer.sign("key-1", issuer.claims("dave", []string{"marketing"})) },
+			expectedCode: http.StatusForbidden,
+			expectedResponse: utils.Response{
+				Success: false,
+				ErrorCode: "forbidden",
+				ErrorMessage: "Forbidden",
+				Data: middleware.ForbiddenDetails{
+					Reason: middleware.ForbiddenReasonMissingPermission,
+					Permission: auth.PermissionFiltersRead,
+					Roles: []string{},
+				},
+			},
+		},
+		{
+			testName: "Returns 401 with wrong audience",
+			token: func() string { return issuer.sign("key-1", wrongAudience) },
+			expectedCode: http.StatusUnauthorized,
+			expectedResponse: utils.Response{
+				Success: false,
+				ErrorCode: "unauthorized",
+				ErrorMessage: "Invalid credentials",
+				Data: nil,
+			},
+		},
+		{
+			testName: "Returns 401 with expired token",
+			token: func() string { return issuer.sign("key-1", expired) },
+			expectedCode: http.StatusUnauthorized,
+			expectedResponse: utils.Response{
+				Success: false,
+				ErrorCode: "unauthorized",
+				ErrorMessage: "Invalid credentials",
+				Data: nil,
+			},
+		},
+		{
+			testName: "Returns 200 with token signed by rotated key",
+			token: func() string {
+				issuer.rotateKey("key-2")
+				return issuer.sign("key-2", issuer.claims("carol", []string{"search-viewers"}))
+			},
+			expectedCode: http.StatusOK,
+			expectedResponse: utils.Response{
+				Success: true,
+				ErrorMessage: "",
+				Data: []models.Filter{},
+			},
+		},
+	}
+
+	for i, test := range oidcBearerTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		req, err := http.NewRequest(http.MethodGet, "/filters", nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		req.Header.Set("Authorization", "Bearer " + test.token())
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
+
+func TestOIDCBearerTokenIdentityProviderUnavailable(t *testing.T) {
+	issuer := newStubIssuer()
+	token := issuer.sign("key-1", issuer.claims("carol", []string{"search-viewers"}))
+	server := newTestServer(t, &storage.StorageMock{Filters: []models.Filter{}}, oidcTestConfig(issuer))
+	issuer.server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, "/filters", nil)
+	if err != nil {
+		t.Fatalf("Unable to create request, error: %s\n", err)
+	}
+	req.Header.Set("Authorization", "Bearer " + token)
+
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusBadGateway, "identity provider outage must not be reported as invalid credentials")
+}
+
+func TestOIDCBearerTokensFetchJWKSOnce(t *testing.T) {
+	issuer := newStubIssuer()
+	defer issuer.server.Close()
+	issuer.jwksDelay = 100 * time.Millisecond
+	token := issuer.sign("key-1", issuer.claims("carol", []string{"search-viewers"}))
+	config := oidcTestConfig(issuer)
+	config.OIDCJWKSCacheTTL = time.Millisecond
+	server := newTestServer(t, &storage.StorageMock{Filters: []models.Filter{}}, config)
+
+	codes := make([]int, 10)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			req, _ := http.NewRequest(http.MethodGet, "/filters", nil)
+			req.Header.Set("Authorization", "Bearer " + token)
+			rr := httptest.NewRecorder()
+			server.router.ServeHTTP(rr, req)
+			codes[i] = rr.Code
+		}(i)
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		assert.Equal(t, code, http.StatusOK, "wrong response code")
+	}
+	issuer.mu.Lock()
+	assert.Equal(t, issuer.jwksFetches, 1, "concurrent requests must share one jwks fetch")
+	issuer.mu.Unlock()
+
+	// Cache is stale by now, keys fetched before outage are still served
+	issuer.server.Close()
+	time.Sleep(2 * time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodGet, "/filters", nil)
+	req.Header.Set("Authorization", "Bearer " + token)
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusOK, "keys fetched before outage must be served")
+}
+
+func TestOIDCAuthorizationCodeLogin(t *testing.T) {
+	issuer := newStubIssuer()
+	defer issuer.server.Close()
+
+	server := newTestServer(t, &storage.StorageMock{}, oidcTestConfig(issuer))
+
+	req, _ := http.NewRequest(http.MethodGet, "/oidc/login", nil)
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusFound, "wrong response code")
+
+	location, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Unable to parse redirect location, error: %s\n", err)
+	}
+	assert.Equal(t, location.Path, "/authorize", "wrong authorization endpoint")
+	assert.Equal(t, location.Query().Get("client_id"), testOIDCClientId, "wrong client id")
+	assert.Equal(t, location.Query().Get("code_challenge_method"), "S256", "wrong code challenge method")
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected state cookie, got %d cookies\n", len(cookies))
+	}
+	state := location.Query().Get("state")
+	issuer.nonce = location.Query().Get("nonce")
+
+	var callbackTests = []struct {
+		testName				string
+		query					string
+		expectedCode			int
+		expectedErrorMessage	string
+	}{
+		{
+			testName: "Returns 400 with wrong state",
+			query: "code=good-code&state=forged",
+			expectedCode: http.StatusBadRequest,
+			expectedErrorMessage: "Invalid oidc login state",
+		},
+		{
+			testName: "Returns 401 when code is rejected",
+			query: "code=bad-code&state=" + state,
+			expectedCode: http.StatusUnauthorized,
+			expectedErrorMessage: "Invalid credentials",
+		},
+		{
+			testName: "Returns 200 and id token with valid code",
+			query: "code=good-code&state=" + state,
+			expectedCode: http.StatusOK,
+			expectedErrorMessage: "",
+		},
+	}
+
+	for i, test := range callbackTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		req, _ := http.NewRequest(http.MethodGet, "/oidc/callback?" + test.query, nil)
+		req.AddCookie(cookies[0])
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		var resp struct {
+			ErrorMessage	string					`json:"errorMessage"`
+			Data			*models.LoginResponse	`json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Unable to unmarshal response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, resp.ErrorMessage, test.expectedErrorMessage, "wrong error message")
+
+		if test.expectedCode == http.StatusOK {
+			req, _ := http.NewRequest(http.MethodPost, "/filters/stats", strings.NewReader(`{}`))
+			req.Header.Set("Authorization", "Bearer " + resp.Data.Token)
+			rr := httptest.NewRecorder()
+			server.router.ServeHTTP(rr, req)
+
+			assert.Equal(t, rr.Code, http.StatusBadRequest, "id token from login was not accepted")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	swaggerFiles "github.com/swaggo/files/v2"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+/*
+Spec url is relative so the ui keeps working when server
+is mounted under a prefix behind a proxy.
+*/
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "../openapi.json",
+    dom_id: '#swagger-ui',
+    deepLinking: true,
+    presets: [
+      SwaggerUIBundle.presets.apis,
+      SwaggerUIStandalonePreset
+    ],
+    plugins: [
+      SwaggerUIBundle.plugins.DownloadUrl
+    ],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+var swaggerUI = http.FileServer(http.FS(swaggerFiles.FS))
+
+func newOpenAPIRouter(rules utils.DomainRules) (routers.Router, []byte, error) {
+	/*
+	Bounds of user fields in the embedded spec are defaults,
+	they are replaced with configured ones so that served spec
+	documents the bounds handlers actually enforce.
+	*/
+
+	spec, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := applyDomainRules(spec, rules); err != nil {
+		return nil, nil, err
+	}
+	if err := spec.Validate(context.TODO()); err != nil {
+		return nil, nil, err
+	}
+
+	document, err := spec.MarshalJSON()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	router, err := gorillamux.NewRouter(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return router, document, nil
+}
+
+func applyDomainRules(spec *openapi3.T, rules utils.DomainRules) error {
+	user := spec.Components.Schemas["User"]
+	if user == nil || user.Value == nil {
+		return errors.New("user schema is missing from openapi spec")
+	}
+
+	login := user.Value.Properties["login"]
+	indexLimit := user.Value.Properties["index_limit"]
+	indexes := user.Value.Properties["indexes"]
+	if login == nil || indexLimit == nil || indexes == nil || indexes.Value.Items == nil {
+		return errors.New("user schema in openapi spec is missing bounded fields")
+	}
+
+	loginMaxLength := uint64(rules.LoginMaxLength)
+	indexLimitMax := float64(rules.IndexLimitMax)
+	indexNameMaxLength := uint64(rules.IndexNameMaxLength)
+
+	login.Value.MinLength = uint64(rules.LoginMinLength)
+	login.Value.MaxLength = &loginMaxLength
+	indexLimit.Value.Max = &indexLimitMax
+	indexes.Value.Items.Value.MaxLength = &indexNameMaxLength
+
+	return nil
+}
+
+func (s *Server) GetOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	/*
+	Spec is served as is rather than wrapped in the usual
+	response, openapi tooling expects the document itself.
+	*/
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.openAPISpec)
+}
+
+func (s *Server) GetDocs(w http.ResponseWriter, r *http.Request) {
+	/*
+	Swagger ui bundle points to the petstore example by default,
+	its initializer is replaced with one loading our spec.
+	*/
+
+	prefix := r.URL.Path[:strings.Index(r.URL.Path, "/docs/") + len("/docs/")]
+	if strings.TrimPrefix(r.URL.Path, prefix) == "swagger-initializer.js" {
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Write([]byte(swaggerInitializer))
+		return
+	}
+
+	http.StripPrefix(prefix, swaggerUI).ServeHTTP(w, r)
+}
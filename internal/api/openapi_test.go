@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/gorilla/mux"
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/storage"
+)
+
+var pathVariableRegexp = regexp.MustCompile(`\{([^:}]+):[^}]*\}`)
+
+func TestOpenAPISpecMatchesRoutes(t *testing.T) {
+	/*
+	Server is configured with access tokens and oidc so that
+	routes registered only for those are checked as well.
+	*/
+
+	issuer := newStubIssuer()
+	defer issuer.server.Close()
+
+	serverConfig := oidcTestConfig(issuer)
+	serverConfig.TokenEncryptionKey = tokenConfig.TokenEncryptionKey
+	serverConfig.TokenSigningAlgorithm = tokenConfig.TokenSigningAlgorithm
+	serverConfig.TokenIssuer = tokenConfig.TokenIssuer
+	serverConfig.TokenTTL = tokenConfig.TokenTTL
+	serverConfig.TokenKeyRotationInterval = tokenConfig.TokenKeyRotationInterval
+	server := newTestServer(t, &storage.StorageMock{}, serverConfig)
+
+	spec, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		t.Fatalf("Unable to load openapi spec, error: %s\n", err)
+	}
+	if err := spec.Validate(context.TODO()); err != nil {
+		t.Fatalf("Openapi spec is invalid, error: %s\n", err)
+	}
+
+	registered := []string{}
+	err = server.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			registered = append(registered, method + " " + pathVariableRegexp.ReplaceAllString(template, "{$1}"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unable to walk routes, error: %s\n", err)
+	}
+
+	documented := []string{}
+	for path, item := range spec.Paths.Map() {
+		servers := spec.Servers
+		if len(item.Servers) > 0 {
+			servers = item.Servers
+		}
+		for _, server := range servers {
+			for method := range item.Operations() {
+				documented = append(documented, strings.ToUpper(method) + " " + strings.TrimSuffix(server.URL, "/") + path)
+			}
+		}
+	}
+
+	sort.Strings(registered)
+	sort.Strings(documented)
+	assert.Equal(t, documented, registered, "openapi spec does not match registered routes")
+}
+
+func TestOpenAPIHandlers(t *testing.T) {
+	server := newTestServer(t, &storage.StorageMock{}, &config.Config{AuthDisabled: true, LoginMaxLength: 32, IndexLimitMax: 3})
+
+	req, err := http.NewRequest(http.MethodGet, "/openapi.json", nil)
+	if err != nil {
+		t.Fatalf("Unable to create request, error: %s\n", err)
+	}
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+
+	assert.Equal(t, rr.Code, http.StatusOK, "wrong response code")
+	assert.Equal(t, rr.Header().Get("Content-Type"), "application/json", "wrong content type")
+
+	spec, err := openapi3.NewLoader().LoadFromData(rr.Body.Bytes())
+	if err != nil {
+		t.Fatalf("Unable to load served openapi spec, error: %s\n", err)
+	}
+	user := spec.Components.Schemas["User"].Value
+	assert.Equal(t, user.Properties["login"].Value.MinLength, uint64(3), "wrong login min length")
+	assert.Equal(t, *user.Properties["login"].Value.MaxLength, uint64(32), "wrong login max length")
+	assert.Equal(t, *user.Properties["index_limit"].Value.Max, float64(3), "wrong index limit maximum")
+	assert.Equal(t, *user.Properties["indexes"].Value.Items.Value.MaxLength, uint64(255), "wrong index name max length")
+
+	for _, file := range []string{"", "swagger-ui-bundle.js", "swagger-initializer.js"} {
+		req, err := http.NewRequest(http.MethodGet, "/docs/" + file, nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusOK, "wrong response code for " + file)
+	}
+
+	req, err = http.NewRequest(http.MethodGet, "/docs/swagger-initializer.js", nil)
+	if err != nil {
+		t.Fatalf("Unable to create request, error: %s\n", err)
+	}
+	rr = httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+
+	assert.Equal(t, strings.Contains(rr.Body.String(), `url: "../openapi.json"`), true, "swagger ui does not load served spec")
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/outbox"
+	"github.com/xavesen/search-admin/internal/storage"
+)
+
+func TestOutboxRelay(t *testing.T) {
+	requests := 0
+	receivedIds := []string{}
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		receivedIds = append(receivedIds, r.Header.Get(outbox.EventIdHeader))
+		if requests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer endpoint.Close()
+
+	sinkPath := filepath.Join(t.TempDir(), "events.jsonl")
+	testStorage := &storage.StorageMock{
+		OutboxEvents: []models.OutboxEvent{
+			{Id: "1", Type: "user.delete", ResourceType: models.AuditResourceUser, ResourceId: "3", Status: models.OutboxEventPending},
+		},
+	}
+	relay := outbox.NewRelay(testStorage, time.Minute, outbox.NewFilePublisher(sinkPath), outbox.NewHTTPPublisher(endpoint.URL, time.Second))
+
+	ctx := context.Background()
+	if err := relay.RelayDue(ctx); err != nil {
+		t.Fatalf("Unable to relay outbox, error: %s\n", err)
+	}
+	event := testStorage.OutboxEvents[0]
+	assert.Equal(t, event.Status, models.OutboxEventPending, "failed event is not retried")
+	assert.Equal(t, event.Attempts, 1, "wrong number of attempts")
+	assert.Equal(t, event.LastError, "http: endpoint responded with status 500", "wrong last error")
+	assert.Equal(t, event.NextAttemptAt.After(time.Now().Add(50 * time.Second)), true, "retry is not backed off")
+
+	if err := relay.RelayDue(ctx); err != nil {
+		t.Fatalf("Unable to relay outbox, error: %s\n", err)
+	}
+	assert.Equal(t, requests, 1, "event relayed before retry is due")
+
+	testStorage.OutboxEvents[0].NextAttemptAt = time.Now().UTC()
+	if err := relay.RelayDue(ctx); err != nil {
+		t.Fatalf("Unable to relay outbox, error: %s\n", err)
+	}
+	event = testStorage.OutboxEvents[0]
+	assert.Equal(t, event.Status, models.OutboxEventDelivered, "event is not delivered")
+	assert.Equal(t, event.DeliveredAt != nil, true, "delivered event without delivery time")
+	assert.Equal(t, receivedIds, []string{"1", "1"}, "wrong event ids received")
+
+	sink, err := os.Open(sinkPath)
+	if err != nil {
+		t.Fatalf("Unable to open file sink, error: %s\n", err)
+	}
+	defer sink.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(sink)
+	for scanner.Scan() {
+		var sinkEvent models.OutboxEvent
+		if err := json.Unmarshal(scanner.Bytes(), &sinkEvent); err != nil {
+			t.Fatalf("Unable to unmarshal file sink line, error: %s\n", err)
+		}
+		assert.Equal(t, sinkEvent.Id, "1", "wrong event in file sink")
+		lines++
+	}
+	assert.Equal(t, lines, 2, "event is not delivered at least once to file sink")
+}
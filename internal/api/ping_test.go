@@ -13,7 +13,7 @@ import (
 )
 
 func TestPingHandler(t *testing.T) {
-	server := NewServer("", &storage.StorageMock{}, nil)
+	server := newTestServer(t, &storage.StorageMock{}, nil)
 
 	req, err := http.NewRequest(http.MethodGet, "/ping", nil)
 	if err != nil {
@@ -0,0 +1,190 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/middleware"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+var rbacConfig = &config.Config{
+	AuthTokens: 	[]string{
+		"root:root-token",
+		"viewer:viewer-token",
+		"editor:editor-token",
+		"admin:admin-token",
+		"nobody:nobody-token",
+	},
+	Superadmins: 	[]string{"token:root"},
+}
+
+var rbacRoleBindings = []models.RoleBinding{
+	{Subject: "token:viewer", Roles: []string{auth.RoleViewer}},
+	{Subject: "token:editor", Roles: []string{auth.RoleFilterEditor}},
+	{Subject: "token:admin", Roles: []string{auth.RoleUserAdmin}},
+}
+
+var rbacTests = []struct {
+	testName			string
+	token				string
+	method				string
+	path				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 when viewer lists users",
+		token: "viewer-token",
+		method: http.MethodGet,
+		path: "/users",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: []models.User{},
+		},
+	},
+	{
+		testName: "Returns 403 when viewer deletes user",
+		token: "viewer-token",
+		method: http.MethodDelete,
+		path: "/user/66d8420df6e5311a791e0a08",
+		expectedCode: http.StatusForbidden,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "forbidden",
+			ErrorMessage: "Forbidden",
+			Data: middleware.ForbiddenDetails{
+				Reason: middleware.ForbiddenReasonMissingPermission,
+				Permission: auth.PermissionUsersDelete,
+				Roles: []string{auth.RoleViewer},
+			},
+		},
+	},
+	{
+		testName: "Returns 403 when filter editor deletes user",
+		token: "editor-token",
+		method: http.MethodDelete,
+		path: "/user/66d8420df6e5311a791e0a08",
+		expectedCode: http.StatusForbidden,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "forbidden",
+			ErrorMessage: "Forbidden",
+			Data: middleware.ForbiddenDetails{
+				Reason: middleware.ForbiddenReasonMissingPermission,
+				Permission: auth.PermissionUsersDelete,
+				Roles: []string{auth.RoleFilterEditor},
+			},
+		},
+	},
+	{
+		testName: "Returns 200 when filter editor deletes filter",
+		token: "editor-token",
+		method: http.MethodDelete,
+		path: "/filter/66d8420df6e5311a791e0a08",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 200 when user admin deletes user",
+		token: "admin-token",
+		method: http.MethodDelete,
+		path: "/user/66d8420df6e5311a791e0a08",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 403 when user admin manages role bindings",
+		token: "admin-token",
+		method: http.MethodGet,
+		path: "/role-bindings",
+		expectedCode: http.StatusForbidden,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "forbidden",
+			ErrorMessage: "Forbidden",
+			Data: middleware.ForbiddenDetails{
+				Reason: middleware.ForbiddenReasonMissingPermission,
+				Permission: auth.PermissionRolesManage,
+				Roles: []string{auth.RoleUserAdmin},
+			},
+		},
+	},
+	{
+		testName: "Returns 403 when subject has no roles",
+		token: "nobody-token",
+		method: http.MethodGet,
+		path: "/filters",
+		expectedCode: http.StatusForbidden,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "forbidden",
+			ErrorMessage: "Forbidden",
+			Data: middleware.ForbiddenDetails{
+				Reason: middleware.ForbiddenReasonMissingPermission,
+				Permission: auth.PermissionFiltersRead,
+				Roles: []string{},
+			},
+		},
+	},
+	{
+		testName: "Returns 200 when superadmin from config manages role bindings",
+		token: "root-token",
+		method: http.MethodGet,
+		path: "/role-bindings",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: rbacRoleBindings,
+		},
+	},
+}
+
+func TestRoleBasedAccessControl(t *testing.T) {
+	for i, test := range rbacTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		storage := &storage.StorageMock{
+			Users: 			[]models.User{},
+			RoleBindings: 	rbacRoleBindings,
+		}
+		server := newTestServer(t, storage, rbacConfig)
+
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		req.Header.Set("Authorization", "Bearer " + test.token)
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (s *Server) GetAllRoleBindings(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+	bindings, err := s.storage.GetAllRoleBindings(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", bindings)
+}
+
+func (s *Server) GetRoleBinding(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subject, ok := vars["subject"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No subject provided", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	binding, err := s.storage.GetRoleBinding(ctx, subject)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No role binding for such subject", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", binding)
+}
+
+func (s *Server) SetRoleBinding(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subject, ok := vars["subject"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No subject provided", nil)
+		return
+	}
+
+	var binding *models.RoleBinding
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&binding) ; err != nil || binding == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	err := s.validator.Struct(binding)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warning(logErrorString)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
+		return
+	}
+
+	binding.Subject = subject
+
+	ctx := context.TODO()
+	before, _ := s.storage.GetRoleBinding(ctx, subject)
+	err = s.storage.SetRoleBinding(ctx, binding)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	s.recordAudit(r, "role_binding.set", models.AuditResourceRoleBinding, subject, before, binding)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", binding)
+}
+
+func (s *Server) DeleteRoleBinding(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	subject, ok := vars["subject"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No subject provided", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	before, _ := s.storage.GetRoleBinding(ctx, subject)
+	err := s.storage.DeleteRoleBinding(ctx, subject)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No role binding for such subject", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	s.recordAudit(r, "role_binding.delete", models.AuditResourceRoleBinding, subject, before, nil)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", nil)
+}
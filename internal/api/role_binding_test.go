@@ -0,0 +1,191 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var setRoleBindingTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	subject				string
+	payload				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and role binding",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		subject: "alice",
+		payload: `{"roles": ["viewer", "filter-editor"]}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.RoleBinding{
+				Subject: "alice",
+				Roles: []string{"viewer", "filter-editor"},
+			},
+		},
+	},
+	{
+		testName: "Returns 400 without roles",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		subject: "alice",
+		payload: `{}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: roles is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "roles", Rule: "required", Message: "roles is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with unknown role",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		subject: "alice",
+		payload: `{"roles": ["owner"]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: roles[0] must be one of [viewer filter-editor user-admin search-service superadmin]",
+			FieldErrors: []utils.FieldError{
+				{Field: "roles[0]", Rule: "oneof", Message: "roles[0] must be one of [viewer filter-editor user-admin search-service superadmin]"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		subject: "alice",
+		payload: `{"roles": ["viewer"]}`,
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestSetRoleBindingHandler(t *testing.T) {
+	for i, test := range setRoleBindingTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		path := fmt.Sprintf("/role-binding/%s", test.subject)
+		req, err := http.NewRequest(http.MethodPut, path, bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
+
+var deleteRoleBindingTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 404 when no role binding for subject in db",
+		storage: &storage.StorageMock{
+			Error: 	mongo.ErrNoDocuments,
+		},
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No role binding for such subject",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestDeleteRoleBindingHandler(t *testing.T) {
+	for i, test := range deleteRoleBindingTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(http.MethodDelete, "/role-binding/alice", nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
@@ -1,31 +1,73 @@
 package api
 
 import (
+	"context"
 	"net/http"
 
+	"github.com/getkin/kin-openapi/routers"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"github.com/go-playground/validator/v10"
-	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/events"
+	cfg "github.com/xavesen/search-admin/internal/config"
 	"github.com/xavesen/search-admin/internal/middleware"
 	"github.com/xavesen/search-admin/internal/utils"
 	"github.com/xavesen/search-admin/internal/storage"
-	ut "github.com/go-playground/universal-translator"
+	"github.com/xavesen/search-admin/internal/tokens"
 )
 
 type Server struct {
-	listenAddr	string
-	storage 	storage.Storage
-	config		*config.Config
-	router 		*mux.Router
-	validator	*validator.Validate
-	translator	*ut.Translator
+	listenAddr		string
+	storage			storage.Storage
+	config			*cfg.Config
+	router			*mux.Router
+	validator		*validator.Validate
+	translators		*utils.Translators
+	authenticator	auth.Authenticator
+	roleResolver	*auth.RoleResolver
+	oidc			*auth.OIDCProvider
+	tokens			*tokens.Manager
+	events			*events.Broker
+	openAPIRouter	routers.Router
+	openAPISpec		[]byte
+	passwordThrottle	*auth.Throttle
+	httpServer		*http.Server
 }
 
-func NewServer(listenAddr string, storage storage.Storage, config *config.Config) *Server {
+func NewServer(listenAddr string, storage storage.Storage, config *cfg.Config) (*Server, error) {
 	log.Debug("Initializing server")
 
-	validate, translator := utils.NewValidator()
+	if config == nil {
+		log.Warning("Initializing server without config, authentication is disabled")
+		config = &cfg.Config{AuthDisabled: true}
+	}
+
+	validate, translators := utils.NewValidator(config)
+
+	oidcProvider, err := auth.NewOIDCProviderFromConfig(config)
+	if err != nil {
+		log.Errorf("Error initializing oidc authentication: %s", err)
+		return nil, err
+	}
+
+	tokenManager, err := tokens.NewManagerFromConfig(storage, config)
+	if err != nil {
+		log.Errorf("Error initializing access tokens: %s", err)
+		return nil, err
+	}
+
+	openAPIRouter, openAPIDocument, err := newOpenAPIRouter(utils.NewDomainRules(config))
+	if err != nil {
+		log.Errorf("Error loading openapi spec: %s", err)
+		return nil, err
+	}
+
+	authenticator, err := auth.NewAuthenticatorFromConfig(config, storage, oidcProvider)
+	if err != nil {
+		log.Errorf("Error initializing authentication: %s", err)
+		return nil, err
+	}
 
 	server := Server{
 		listenAddr: listenAddr,
@@ -33,31 +75,190 @@ func NewServer(listenAddr string, storage storage.Storage, config *config.Config
 		config: 	config,
 		router: 	mux.NewRouter(),
 		validator:	validate,
-		translator: translator,
+		translators: translators,
+		authenticator: authenticator,
+		roleResolver: auth.NewRoleResolver(storage, config.Superadmins),
+		oidc: oidcProvider,
+		tokens: tokenManager,
+		events: events.NewBrokerFromConfig(storage, config),
+		openAPIRouter: openAPIRouter,
+		openAPISpec: openAPIDocument,
+		passwordThrottle: auth.NewPasswordThrottleFromConfig(config, storage),
 	}
-	
+	server.httpServer = &http.Server{Addr: listenAddr, Handler: server.router}
+
 	server.initialiseRoutes()
-	return &server
+	return &server, nil
 }
 
 func (s *Server) initialiseRoutes() {
 	log.Debug("Initializing routes")
 
 	s.router.Use(middleware.Logging)
+	s.router.Use(middleware.Localization(s.translators))
+
+	/*
+	Jwks and oidc urls are registered with token consumers and
+	identity providers, they stay the same across api versions.
+	*/
+	unversioned := s.router.NewRoute().Subrouter()
+	unversioned.Use(middleware.RequestValidation(s.openAPIRouter))
+	if s.tokens != nil {
+		unversioned.HandleFunc("/.well-known/jwks.json", s.GetJWKS).Methods("GET")
+	}
+	if s.oidc != nil {
+		unversioned.HandleFunc("/oidc/login", s.OIDCLogin).Methods("GET")
+		unversioned.HandleFunc("/oidc/callback", s.OIDCCallback).Methods("GET")
+	}
+
+	/*
+	Every api version gets its own routes and handlers for the
+	representations it changes, while all of them share storage.
+	Unversioned paths predate /v1 and are kept as its aliases until sunset.
+	*/
+	s.initialiseV1Routes(s.router.PathPrefix("/v1").Subrouter())
+
+	sunset := s.config.LegacyAPISunset
+	if sunset.IsZero() {
+		sunset = cfg.DefaultLegacyAPISunset
+	}
+	legacy := s.router.NewRoute().Subrouter()
+	legacy.Use(middleware.Deprecation(s.config.LegacyAPIDeprecatedAt, sunset, "/v1"))
+	s.initialiseV1Routes(legacy)
+}
+
+func (s *Server) initialiseV1Routes(router *mux.Router) {
+	/*
+	Requests are validated against openapi spec after authentication,
+	so unauthenticated clients are rejected before their input is looked at.
+	*/
+	public := router.NewRoute().Subrouter()
+	public.Use(middleware.RequestValidation(s.openAPIRouter))
+
+	public.HandleFunc("/ping", s.Ping).Methods("GET")
+	public.HandleFunc("/openapi.json", s.GetOpenAPISpec).Methods("GET")
+	public.PathPrefix("/docs/").HandlerFunc(s.GetDocs).Methods("GET")
+	public.HandleFunc("/login", s.Login).Methods("POST")
+	if s.tokens != nil {
+		public.HandleFunc("/token", s.IssueAccessToken).Methods("POST")
+	}
+
+	api := router.NewRoute().Subrouter()
+	if s.authenticator != nil {
+		api.Use(middleware.Authentication(s.authenticator))
+	}
+	api.Use(middleware.RequestValidation(s.openAPIRouter))
 
-	s.router.HandleFunc("/ping", s.Ping).Methods("GET")
-	s.router.HandleFunc("/user", s.CreateUser).Methods("POST")
-	s.router.HandleFunc("/users", s.GetAllUsers).Methods("GET")
-	s.router.HandleFunc("/user/{id:[0-9a-z]+}", s.GetUserById).Methods("GET")
-	s.router.HandleFunc("/user/{id:[0-9a-z]+}", s.DeleteUser).Methods("DELETE")
-	s.router.HandleFunc("/user/{id:[0-9a-z]+}", s.UpdateUser).Methods("PUT")
-	s.router.HandleFunc("/filter", s.CreateFilter).Methods("POST")
-	s.router.HandleFunc("/filters", s.GetAllFilters).Methods("GET")
-	s.router.HandleFunc("/filter/{id:[0-9a-z]+}", s.DeleteFilter).Methods("DELETE")
-	s.router.HandleFunc("/filter/{id:[0-9a-z]+}", s.GetFilterById).Methods("GET")
+	api.HandleFunc("/logout", s.Logout).Methods("POST")
+	api.Handle("/user", s.authorize(auth.PermissionUsersWrite, s.idempotent(s.CreateUser))).Methods("POST")
+	api.Handle("/users", s.authorize(auth.PermissionUsersRead, s.GetAllUsers)).Methods("GET")
+	api.Handle("/users/bulk", s.authorize(auth.PermissionUsersWrite, s.idempotent(s.BulkUsers))).Methods("POST")
+	api.Handle("/user/{id:[0-9a-z]+}", s.authorize(auth.PermissionUsersRead, s.GetUserById)).Methods("GET")
+	api.Handle("/user/{id:[0-9a-z]+}", s.authorize(auth.PermissionUsersDelete, s.DeleteUser)).Methods("DELETE")
+	api.Handle("/user/{id:[0-9a-z]+}", s.authorize(auth.PermissionUsersWrite, s.UpdateUser)).Methods("PUT")
+	api.Handle("/user/{id:[0-9a-z]+}/restore", s.authorize(auth.PermissionUsersDelete, s.RestoreUser)).Methods("POST")
+	api.Handle("/user/{id:[0-9a-z]+}/keys", s.authorize(auth.PermissionUsersWrite, s.CreateAPIKey)).Methods("POST")
+	api.Handle("/user/{id:[0-9a-z]+}/keys", s.authorize(auth.PermissionUsersRead, s.GetAPIKeys)).Methods("GET")
+	api.Handle("/user/{id:[0-9a-z]+}/keys/{keyId:[0-9a-z]+}", s.authorize(auth.PermissionUsersWrite, s.RevokeAPIKey)).Methods("DELETE")
+	api.Handle("/user/{id:[0-9a-z]+}/keys/{keyId:[0-9a-z]+}/rotate", s.authorize(auth.PermissionUsersWrite, s.RotateAPIKey)).Methods("POST")
+	api.Handle("/keys/verify", s.authorize(auth.PermissionKeysVerify, s.VerifyAPIKey)).Methods("POST")
+	api.Handle("/filter", s.authorize(auth.PermissionFiltersWrite, s.idempotent(s.CreateFilter))).Methods("POST")
+	api.Handle("/filters", s.authorize(auth.PermissionFiltersRead, s.GetAllFilters)).Methods("GET")
+	api.Handle("/filters/bulk", s.authorize(auth.PermissionFiltersWrite, s.idempotent(s.BulkFilters))).Methods("POST")
+	api.Handle("/filter/{id:[0-9a-z]+}", s.authorize(auth.PermissionFiltersDelete, s.DeleteFilter)).Methods("DELETE")
+	api.Handle("/filter/{id:[0-9a-z]+}", s.authorize(auth.PermissionFiltersRead, s.GetFilterById)).Methods("GET")
+	api.Handle("/filter/{id:[0-9a-z]+}", s.authorize(auth.PermissionFiltersWrite, s.UpdateFilter)).Methods("PUT")
+	api.Handle("/filter/{id:[0-9a-z]+}/restore", s.authorize(auth.PermissionFiltersDelete, s.RestoreFilter)).Methods("POST")
+	api.Handle("/filters/compiled", s.authorize(auth.PermissionFiltersRead, s.GetCompiledFilters)).Methods("GET")
+	api.Handle("/filters/export", s.authorize(auth.PermissionFiltersRead, s.ExportFilters)).Methods("GET")
+	api.Handle("/filters/import", s.authorize(auth.PermissionFiltersWrite, s.idempotent(s.ImportFilters))).Methods("POST")
+	api.Handle("/filters/stats", s.authorize(auth.PermissionStatsWrite, s.idempotent(s.RecordFilterHits))).Methods("POST")
+	api.Handle("/filters/stats", s.authorize(auth.PermissionFiltersRead, s.GetAllFilterStats)).Methods("GET")
+	api.Handle("/filter/{id:[0-9a-z]+}/stats", s.authorize(auth.PermissionFiltersRead, s.GetFilterStats)).Methods("GET")
+	api.Handle("/evaluate", s.authorize(auth.PermissionFiltersEvaluate, s.EvaluateDocument)).Methods("POST")
+	api.Handle("/role-bindings", s.authorize(auth.PermissionRolesManage, s.GetAllRoleBindings)).Methods("GET")
+	api.Handle("/role-binding/{subject}", s.authorize(auth.PermissionRolesManage, s.GetRoleBinding)).Methods("GET")
+	api.Handle("/role-binding/{subject}", s.authorize(auth.PermissionRolesManage, s.SetRoleBinding)).Methods("PUT")
+	api.Handle("/role-binding/{subject}", s.authorize(auth.PermissionRolesManage, s.DeleteRoleBinding)).Methods("DELETE")
+	api.Handle("/changes", s.authorize(auth.PermissionChangesRead, s.GetChanges)).Methods("GET")
+	api.Handle("/events", s.authorize(auth.PermissionChangesRead, s.StreamEvents)).Methods("GET")
+	api.Handle("/trash", s.authorize(auth.PermissionTrashRead, s.GetTrash)).Methods("GET")
+	api.Handle("/webhook", s.authorize(auth.PermissionWebhooksManage, s.CreateWebhook)).Methods("POST")
+	api.Handle("/webhooks", s.authorize(auth.PermissionWebhooksManage, s.GetAllWebhooks)).Methods("GET")
+	api.Handle("/webhook/{id:[0-9a-z]+}", s.authorize(auth.PermissionWebhooksManage, s.GetWebhookById)).Methods("GET")
+	api.Handle("/webhook/{id:[0-9a-z]+}", s.authorize(auth.PermissionWebhooksManage, s.DeleteWebhook)).Methods("DELETE")
+	api.Handle("/webhook/{id:[0-9a-z]+}/deliveries", s.authorize(auth.PermissionWebhooksManage, s.GetWebhookDeliveries)).Methods("GET")
+	api.Handle("/webhook/{id:[0-9a-z]+}/deliveries/{deliveryId:[0-9a-z]+}/redeliver", s.authorize(auth.PermissionWebhooksManage, s.RedeliverWebhook)).Methods("POST")
+	api.Handle("/audit", s.authorize(auth.PermissionAuditRead, s.GetAuditEvents)).Methods("GET")
+	api.Handle("/admin", s.authorize(auth.PermissionAdminsManage, s.idempotent(s.CreateAdmin))).Methods("POST")
+	api.Handle("/admins", s.authorize(auth.PermissionAdminsManage, s.GetAllAdmins)).Methods("GET")
+	api.Handle("/admin/{id:[0-9a-z]+}", s.authorize(auth.PermissionAdminsManage, s.GetAdminById)).Methods("GET")
+	api.Handle("/admin/{id:[0-9a-z]+}", s.authorize(auth.PermissionAdminsManage, s.DeleteAdmin)).Methods("DELETE")
+	api.Handle("/admin/{id:[0-9a-z]+}/revoke-sessions", s.authorize(auth.PermissionAdminsManage, s.RevokeAdminSessions)).Methods("POST")
+}
+
+func (s *Server) idempotent(handler http.HandlerFunc) http.HandlerFunc {
+	/*
+	Responses are stored in db to be replayed, with
+	secrets like user passwords redacted from them.
+	*/
+
+	return middleware.Idempotency(s.storage, s.config.IdempotencyKeyTTL)(handler).ServeHTTP
+}
+
+func (s *Server) authorize(permission auth.Permission, handler http.HandlerFunc) http.Handler {
+	/*
+	Permissions are only checked when authentication is enabled,
+	without it there is no principal to check them for.
+	*/
+
+	if s.authenticator == nil {
+		return handler
+	}
+
+	return middleware.RequirePermission(permission, s.roleResolver)(handler)
+}
+
+func (s *Server) hasPermission(r *http.Request, permission auth.Permission) (bool, error) {
+	/*
+	For handlers whose operations need different permissions,
+	route only requires the permission common to all of them.
+	*/
+
+	if s.authenticator == nil {
+		return true, nil
+	}
+
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return false, nil
+	}
+
+	roles, err := s.roleResolver.Roles(r.Context(), principal)
+	if err != nil {
+		return false, err
+	}
+
+	return auth.HasPermission(roles, permission), nil
 }
  
 func (s *Server) Start() error {
 	log.Infof("Starting listening on %s", s.listenAddr)
-	return http.ListenAndServe(s.listenAddr, s.router)
+	if err := s.httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	/*
+	Event streams never finish on their own,
+	they are closed first so shutdown doesn't wait for them.
+	*/
+
+	log.Info("Shutting down server")
+	s.events.Close()
+
+	return s.httpServer.Shutdown(ctx)
 }
\ No newline at end of file
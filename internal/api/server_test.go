@@ -0,0 +1,32 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/tokens"
+)
+
+func newTestServer(t *testing.T, storage storage.Storage, config *config.Config) *Server {
+	t.Helper()
+
+	server, err := NewServer("", storage, config)
+	if err != nil {
+		t.Fatalf("Unable to create server, error: %s\n", err)
+	}
+
+	return server
+}
+
+func TestNewServerReturnsInitErrors(t *testing.T) {
+	server, err := NewServer("", &storage.StorageMock{}, &config.Config{
+		AuthDisabled: 			true,
+		TokenEncryptionKey: 	"key",
+		TokenSigningAlgorithm: 	"none",
+	})
+
+	assert.Equal(t, server == nil, true, "server returned despite init error")
+	assert.Equal(t, err, tokens.ErrUnsupportedAlgorithm, "wrong error")
+}
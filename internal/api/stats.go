@@ -0,0 +1,174 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	ut "github.com/go-playground/universal-translator"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (s *Server) RecordFilterHits(w http.ResponseWriter, r *http.Request) {
+	var report *models.FilterHitsReport
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&report) ; err != nil || report == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	err := s.validator.Struct(report)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warning(logErrorString)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
+		return
+	}
+
+	for i := range report.Hits {
+		report.Hits[i].Normalize()
+	}
+
+	ctx := context.TODO()
+	err = s.storage.RecordFilterHits(ctx, report.Hits)
+	var unknownErr *storage.UnknownFiltersError
+	if errors.As(err, &unknownErr) {
+		utils.WriteValidationError(w, r, unknownFilterErrors(report.Hits, unknownErr.Ids, utils.RequestTranslator(r)))
+		return
+	}
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	s.recordAudit(r, "filter.hits", models.AuditResourceFilters, "", nil, report)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", nil)
+}
+
+func unknownFilterErrors(hits []models.FilterHits, unknownIds []string, translator ut.Translator) []utils.FieldError {
+	unknown := map[string]bool{}
+	for _, id := range unknownIds {
+		unknown[id] = true
+	}
+
+	fieldErrors := []utils.FieldError{}
+	for i, hit := range hits {
+		if !unknown[hit.FilterId] {
+			continue
+		}
+		field := fmt.Sprintf("hits[%d].filter_id", i)
+		fieldErrors = append(fieldErrors, utils.FieldError{
+			Field: 		field,
+			Rule: 		"exists",
+			Message: 	utils.Translate(translator, "{0} must be an id of an existing filter", field),
+		})
+	}
+	return fieldErrors
+}
+
+func (s *Server) GetFilterStats(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No filter id provided", nil)
+		return
+	}
+
+	from, err := utils.ParseTimeQuery(r, "from")
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: from must be a RFC3339 timestamp", nil)
+		return
+	}
+	to, err := utils.ParseTimeQuery(r, "to")
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: to must be a RFC3339 timestamp", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	_, err = s.storage.GetFilter(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No filter with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	buckets, err := s.storage.GetFilterStats(ctx, id, from, to)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	stats := models.FilterStats{
+		FilterId: 	id,
+		Buckets: 	buckets,
+	}
+	for i, bucket := range buckets {
+		stats.TotalHits += bucket.Hits
+		if stats.LastHit == nil || bucket.LastHit.After(*stats.LastHit) {
+			stats.LastHit = &buckets[i].LastHit
+		}
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", stats)
+}
+
+func (s *Server) GetAllFilterStats(w http.ResponseWriter, r *http.Request) {
+	/*
+	Filters that were never hit are included with zero hits,
+	least recently hit filters go first so dead ones are easy to find.
+	*/
+
+	ctx := context.TODO()
+	filters, err := s.storage.GetAllFilters(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	recordedStats, err := s.storage.GetAllFilterStats(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	statsByFilter := map[string]models.FilterStats{}
+	for _, filterStats := range recordedStats {
+		statsByFilter[filterStats.FilterId] = filterStats
+	}
+
+	stats := []models.FilterStats{}
+	for _, filter := range filters {
+		filterStats, ok := statsByFilter[filter.Id]
+		if !ok {
+			filterStats = models.FilterStats{FilterId: filter.Id}
+		}
+		stats = append(stats, filterStats)
+	}
+
+	sort.SliceStable(stats, func(i, j int) bool {
+		if stats[i].LastHit == nil || stats[j].LastHit == nil {
+			return stats[i].LastHit == nil && stats[j].LastHit != nil
+		}
+		return stats[i].LastHit.Before(*stats[j].LastHit)
+	})
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", stats)
+}
@@ -0,0 +1,328 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var recordFilterHitsTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	payload				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 when payload is correct",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{{Id: "66d8420df6e5311a791e0a08"}},
+			Error: 	nil,
+		},
+		payload: `{"hits": [{"filter_id": "66d8420df6e5311a791e0a08", "bucket": "2024-09-01T10:15:00Z", "count": 3}]}`,
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 without hits",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		payload: `{}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: hits is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "hits", Rule: "required", Message: "hits is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 without count",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		payload: `{"hits": [{"filter_id": "66d8420df6e5311a791e0a08", "bucket": "2024-09-01T10:15:00Z"}]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: hits[0].count is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "hits[0].count", Rule: "required", Message: "hits[0].count is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with invalid payload",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		payload: `{"hits": 5}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: hits must be an array",
+			FieldErrors: []utils.FieldError{
+				{Field: "hits", Rule: "type", Message: "hits must be an array"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with hits of unknown filters",
+		storage: &storage.StorageMock{
+			Filters: []models.Filter{{Id: "66d8420df6e5311a791e0a08"}},
+			Error: 	nil,
+		},
+		payload: `{"hits": [{"filter_id": "66d8420df6e5311a791e0a08", "bucket": "2024-09-01T10:15:00Z", "count": 3}, {"filter_id": "66d8420df6e5311a791e0a09", "bucket": "2024-09-01T10:15:00Z", "count": 1}]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: hits[1].filter_id must be an id of an existing filter",
+			FieldErrors: []utils.FieldError{
+				{Field: "hits[1].filter_id", Rule: "exists", Message: "hits[1].filter_id must be an id of an existing filter"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		payload: `{"hits": [{"filter_id": "66d8420df6e5311a791e0a08", "bucket": "2024-09-01T10:15:00Z", "count": 3}]}`,
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestRecordFilterHitsHandler(t *testing.T) {
+	for i, test := range recordFilterHitsTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(http.MethodPost, "/filters/stats", bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
+
+var (
+	firstBucket = time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+	secondBucket = time.Date(2024, 9, 1, 11, 0, 0, 0, time.UTC)
+	secondBucketLastHit = time.Date(2024, 9, 1, 11, 42, 0, 0, time.UTC)
+)
+
+var getFilterStatsTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	query				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and stats with total hits and last hit",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+			FilterStatsBuckets: []models.FilterStatsBucket{
+				{Bucket: firstBucket, Hits: 3, LastHit: firstBucket},
+				{Bucket: secondBucket, Hits: 4, LastHit: secondBucketLastHit},
+			},
+		},
+		query: "?from=2024-09-01T00:00:00Z",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.FilterStats{
+				FilterId: "66d8420df6e5311a791e0a08",
+				TotalHits: 7,
+				LastHit: &secondBucketLastHit,
+				Buckets: []models.FilterStatsBucket{
+					{Bucket: firstBucket, Hits: 3, LastHit: firstBucket},
+					{Bucket: secondBucket, Hits: 4, LastHit: secondBucketLastHit},
+				},
+			},
+		},
+	},
+	{
+		testName: "Returns 400 with invalid time range",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		query: "?to=yesterday",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: to must be a RFC3339 timestamp",
+			FieldErrors: []utils.FieldError{
+				{Field: "to", Rule: "date-time", Message: "to must be a RFC3339 timestamp"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 404 when no filter with such id in db",
+		storage: &storage.StorageMock{
+			Error: 	mongo.ErrNoDocuments,
+		},
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No filter with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestGetFilterStatsHandler(t *testing.T) {
+	for i, test := range getFilterStatsTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		path := "/filter/66d8420df6e5311a791e0a08/stats" + test.query
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
+
+var getAllFilterStatsTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and stats of all filters, never hit first",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+			Filters: []models.Filter{
+				{Id: "1", Regex: "a"},
+				{Id: "2", Regex: "b"},
+				{Id: "3", Regex: "c"},
+			},
+			FilterStats: []models.FilterStats{
+				{FilterId: "1", TotalHits: 10, LastHit: &secondBucketLastHit},
+				{FilterId: "3", TotalHits: 2, LastHit: &firstBucket},
+				{FilterId: "4", TotalHits: 1, LastHit: &firstBucket},
+			},
+		},
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: []models.FilterStats{
+				{FilterId: "2"},
+				{FilterId: "3", TotalHits: 2, LastHit: &firstBucket},
+				{FilterId: "1", TotalHits: 10, LastHit: &secondBucketLastHit},
+			},
+		},
+	},
+	{
+		testName: "Returns 500 when db returns an error",
+		storage: &storage.StorageMock{
+			Error: 	errors.New("random error"),
+		},
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestGetAllFilterStatsHandler(t *testing.T) {
+	for i, test := range getAllFilterStatsTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(http.MethodGet, "/filters/stats", nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
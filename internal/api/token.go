@@ -0,0 +1,160 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/tokens"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (s *Server) IssueAccessToken(w http.ResponseWriter, r *http.Request) {
+	/*
+	User is verified either by login and password or by api key.
+	Tokens issued for api key only carry indexes in the key's scopes.
+	*/
+
+	var request *models.TokenRequest
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&request) ; err != nil || request == nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	passwordGrant := request.Login != "" || request.Password != ""
+	if passwordGrant == (request.APIKey != "") || (passwordGrant && (request.Login == "" || request.Password == "")) {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: either api_key or login and password are required", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	var user *models.User
+	var indexes []string
+	var apiKeyId string
+
+	if passwordGrant {
+		/*
+		Failed password grants are throttled by login and client address,
+		so passwords can't be guessed while the user can still sign in
+		from elsewhere. Throttled requests aren't checked at all.
+		*/
+		throttleKey := auth.HashToken(request.Login + "|" + clientAddress(r))
+		allowed, retryAfter, err := s.passwordThrottle.Allow(ctx, throttleKey, time.Now())
+		if err != nil {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+			return
+		}
+		if !allowed {
+			log.WithFields(log.Fields{
+				"request_id": r.Context().Value(utils.ContextKeyReqId),
+				"login": request.Login,
+			}).Warning("Throttled access token request")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			utils.WriteJSON(w, r, http.StatusTooManyRequests, false, "Too many failed attempts, try again later", nil)
+			return
+		}
+
+		user, err = s.storage.GetUserByLogin(ctx, request.Login)
+		if err != nil && err != mongo.ErrNoDocuments {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+			return
+		}
+		if user == nil || subtle.ConstantTimeCompare([]byte(user.Password), []byte(request.Password)) != 1 {
+			log.WithFields(log.Fields{
+				"request_id": r.Context().Value(utils.ContextKeyReqId),
+				"login": request.Login,
+			}).Warning("Failed access token request")
+			if err := s.passwordThrottle.Fail(ctx, throttleKey, time.Now()); err != nil {
+				log.Errorf("Error recording failed access token request: %s", err)
+			}
+			utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Invalid credentials", nil)
+			return
+		}
+		if err := s.passwordThrottle.Reset(ctx, throttleKey); err != nil {
+			log.Errorf("Error resetting failed access token requests: %s", err)
+		}
+		indexes = user.Indexes
+	} else {
+		prefix, ok := auth.ParseAPIKey(request.APIKey)
+		if !ok {
+			utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Invalid credentials", nil)
+			return
+		}
+
+		key, err := s.storage.GetAPIKeyByPrefix(ctx, prefix)
+		if err == mongo.ErrNoDocuments {
+			utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Invalid credentials", nil)
+			return
+		} else if err != nil {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+			return
+		}
+		if !auth.CheckAPIKey(key.KeyHash, request.APIKey) || !key.IsValid(time.Now()) {
+			utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Invalid credentials", nil)
+			return
+		}
+
+		user, err = s.storage.GetUser(ctx, key.UserId)
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Invalid credentials", nil)
+			return
+		} else if err != nil {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+			return
+		}
+		user.Id = key.UserId
+		indexes = effectiveScopes(key.Scopes, user.Indexes)
+		apiKeyId = key.Id
+	}
+
+	if indexes == nil {
+		indexes = []string{}
+	}
+
+	token, expiresAt, err := s.tokens.Issue(ctx, user, indexes, apiKeyId)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", models.LoginResponse{Token: token, ExpiresAt: expiresAt})
+}
+
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func (s *Server) GetJWKS(w http.ResponseWriter, r *http.Request) {
+	/*
+	Key set is served as is rather than wrapped in the usual
+	response, jwks consumers expect the standard format.
+	*/
+
+	ctx := context.TODO()
+	keySet, err := s.tokens.JWKS(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=" + strconv.Itoa(int(tokens.JWKSMaxAge.Seconds())))
+	json.NewEncoder(w).Encode(keySet)
+}
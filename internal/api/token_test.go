@@ -0,0 +1,243 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/magiconair/properties/assert"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/tokens"
+)
+
+var tokenConfig = &config.Config{
+	AuthDisabled: 				true,
+	TokenEncryptionKey: 		base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)),
+	TokenSigningAlgorithm: 		tokens.AlgorithmEdDSA,
+	TokenIssuer: 				"search-admin",
+	TokenTTL: 					15 * time.Minute,
+	TokenKeyRotationInterval: 	24 * time.Hour,
+}
+
+var tokenUser = models.User{Id: keyOwner.Id, Login: "tenant", Password: "tenant-password", Indexes: []string{"products", "orders"}}
+
+var issueAccessTokenTests = []struct {
+	testName				string
+	payload					string
+	expectedCode			int
+	expectedErrorMessage	string
+	expectedIndexes			[]string
+	expectedKeyId			string
+}{
+	{
+		testName: "Returns 200 and token with all user indexes for password",
+		payload: `{"login": "tenant", "password": "tenant-password"}`,
+		expectedCode: http.StatusOK,
+		expectedIndexes: []string{"products", "orders"},
+	},
+	{
+		testName: "Returns 200 and token with key scopes for api key",
+		payload: `{"api_key": "sak_lookup.secret"}`,
+		expectedCode: http.StatusOK,
+		expectedIndexes: []string{"products"},
+		expectedKeyId: "66d8420df6e5311a791e0a10",
+	},
+	{
+		testName: "Returns 401 with wrong password",
+		payload: `{"login": "tenant", "password": "guessed"}`,
+		expectedCode: http.StatusUnauthorized,
+		expectedErrorMessage: "Invalid credentials",
+	},
+	{
+		testName: "Returns 401 with unknown login",
+		payload: `{"login": "nobody", "password": "tenant-password"}`,
+		expectedCode: http.StatusUnauthorized,
+		expectedErrorMessage: "Invalid credentials",
+	},
+	{
+		testName: "Returns 401 with revoked api key",
+		payload: `{"api_key": "sak_revoked.secret"}`,
+		expectedCode: http.StatusUnauthorized,
+		expectedErrorMessage: "Invalid credentials",
+	},
+	{
+		testName: "Returns 400 with both password and api key",
+		payload: `{"login": "tenant", "password": "tenant-password", "api_key": "sak_lookup.secret"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedErrorMessage: "Bad request: either api_key or login and password are required",
+	},
+}
+
+func getJWKS(t *testing.T, server *Server) tokens.JSONWebKeySet {
+	req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+
+	var keySet tokens.JSONWebKeySet
+	if err := json.Unmarshal(rr.Body.Bytes(), &keySet); err != nil {
+		t.Fatalf("Unable to unmarshal jwks, error: %s\n", err)
+	}
+
+	return keySet
+}
+
+func TestIssueAccessTokenHandler(t *testing.T) {
+	testStorage := &storage.StorageMock{Users: []models.User{tokenUser}, User: tokenUser, APIKeys: testAPIKeys}
+	server := newTestServer(t, testStorage, tokenConfig)
+
+	for i, test := range issueAccessTokenTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		req, err := http.NewRequest(http.MethodPost, "/token", bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		var resp struct {
+			ErrorMessage	string					`json:"errorMessage"`
+			Data			*models.LoginResponse	`json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Unable to unmarshal response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, resp.ErrorMessage, test.expectedErrorMessage, "wrong error message")
+		if test.expectedCode != http.StatusOK {
+			continue
+		}
+
+		keySet := getJWKS(t, server)
+		claims := tokens.AccessTokenClaims{}
+		_, err = jwt.ParseWithClaims(resp.Data.Token, &claims, func(token *jwt.Token) (interface{}, error) {
+			for _, key := range keySet.Keys {
+				if key.Kid == token.Header["kid"] {
+					x, _ := base64.RawURLEncoding.DecodeString(key.X)
+					return ed25519.PublicKey(x), nil
+				}
+			}
+			return nil, fmt.Errorf("no key %s in jwks", token.Header["kid"])
+		}, jwt.WithValidMethods([]string{"EdDSA"}), jwt.WithIssuer("search-admin"))
+
+		assert.Equal(t, err, nil, "token is not verifiable with jwks")
+		assert.Equal(t, claims.Subject, tokenUser.Id, "wrong subject claim")
+		assert.Equal(t, claims.Indexes, test.expectedIndexes, "wrong indexes claim")
+		assert.Equal(t, claims.KeyId, test.expectedKeyId, "wrong key id claim")
+	}
+}
+
+func TestIssueAccessTokenThrottle(t *testing.T) {
+	throttleConfig := *tokenConfig
+	throttleConfig.PasswordMaxFailures = 2
+	testStorage := &storage.StorageMock{Users: []models.User{tokenUser}, User: tokenUser, APIKeys: testAPIKeys}
+	servers := []*Server{newTestServer(t, testStorage, &throttleConfig), newTestServer(t, testStorage, &throttleConfig)}
+
+	requestToken := func(server *Server, password string, remoteAddr string) *httptest.ResponseRecorder {
+		payload := fmt.Sprintf(`{"login": "tenant", "password": "%s"}`, password)
+		req, err := http.NewRequest(http.MethodPost, "/token", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		req.RemoteAddr = remoteAddr
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 0; i < throttleConfig.PasswordMaxFailures; i++ {
+		assert.Equal(t, requestToken(servers[i % len(servers)], "guessed", "10.0.0.1:1234").Code, http.StatusUnauthorized, "wrong response code before throttling")
+	}
+
+	for _, server := range servers {
+		rr := requestToken(server, "tenant-password", "10.0.0.1:4321")
+		assert.Equal(t, rr.Code, http.StatusTooManyRequests, "correct password must be throttled after failures on any instance")
+		assert.Equal(t, rr.Header().Get("Retry-After") != "", true, "no Retry-After header")
+	}
+
+	rr := requestToken(servers[0], "tenant-password", "10.0.0.2:1234")
+	assert.Equal(t, rr.Code, http.StatusOK, "other client address must not be throttled")
+	assert.Equal(t, len(testStorage.LoginFailures), 1, "successful request must reset only its own failures")
+}
+
+func TestIssueAccessTokenLogsRedactedBody(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer log.StandardLogger().ReplaceHooks(log.LevelHooks{})
+	level := log.GetLevel()
+	log.SetLevel(log.DebugLevel)
+	defer log.SetLevel(level)
+
+	testStorage := &storage.StorageMock{Users: []models.User{tokenUser}, User: tokenUser, APIKeys: testAPIKeys}
+	server := newTestServer(t, testStorage, tokenConfig)
+
+	for _, payload := range []string{
+		`{"login": "tenant", "password": "tenant-password"}`,
+		`{"api_key": "sak_lookup.secret"}`,
+		`{"client_id": "search-admin", "client_secret": "sak_lookup.secret"}`,
+	} {
+		hook.Reset()
+		req, err := http.NewRequest(http.MethodPost, "/token", bytes.NewBufferString(payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		server.router.ServeHTTP(httptest.NewRecorder(), req)
+
+		for _, entry := range hook.AllEntries() {
+			if entry.Message != "New request" {
+				continue
+			}
+			body := fmt.Sprintf("%v", entry.Data["body"])
+			assert.Equal(t, strings.Contains(body, "tenant-password") || strings.Contains(body, "sak_lookup.secret"), false, "credentials are logged")
+			assert.Equal(t, strings.Contains(body, `"***"`), true, "credentials are not redacted in logged body")
+		}
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	testStorage := &storage.StorageMock{}
+	server := newTestServer(t, testStorage, tokenConfig)
+	now := time.Now()
+
+	if err := server.tokens.Rotate(context.TODO(), now); err != nil {
+		t.Fatalf("Unable to rotate signing keys, error: %s\n", err)
+	}
+	firstKid := getJWKS(t, server).Keys[0].Kid
+	assert.Equal(t, len(testStorage.SigningKeys), 1, "wrong number of stored keys")
+	assert.Equal(t, testStorage.SigningKeys[0].Id, firstKid, "published key is not the stored one")
+
+	server.tokens.Rotate(context.TODO(), now.Add(tokenConfig.TokenKeyRotationInterval))
+	keySet := getJWKS(t, server)
+	assert.Equal(t, len(keySet.Keys), 2, "old key must stay published while its tokens are valid")
+	assert.Equal(t, keySet.Keys[1].Kid, firstKid, "new key must be published first")
+
+	token, _, err := server.tokens.Issue(context.TODO(), &tokenUser, tokenUser.Indexes, "")
+	if err != nil {
+		t.Fatalf("Unable to issue token, error: %s\n", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &tokens.AccessTokenClaims{})
+	if err != nil {
+		t.Fatalf("Unable to parse token, error: %s\n", err)
+	}
+	assert.Equal(t, parsed.Header["kid"], firstKid, "new key must not sign before consumers can know it")
+
+	server.tokens.Rotate(context.TODO(), now.Add(tokenConfig.TokenKeyRotationInterval + time.Hour))
+	keySet = getJWKS(t, server)
+	assert.Equal(t, len(keySet.Keys), 1, "retired key must be removed")
+	assert.Equal(t, len(testStorage.SigningKeys), 1, "retired key must be deleted from storage")
+}
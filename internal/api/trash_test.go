@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+var deletedAt = time.Date(2024, 9, 4, 12, 0, 0, 0, time.UTC)
+
+var deletedUser = models.User{Id: "66d8420df6e5311a791e0a08", Login: "mary", Password: "12345", IndexLimit: 5, Indexes: []string{}, DeletedAt: &deletedAt}
+
+var deletedFilter = models.Filter{Id: "66d8420df6e5311a791e0a09", Regex: "^secret", DeletedAt: &deletedAt}
+
+var trashTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	method				string
+	path				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 200 and deleted users and filters",
+		storage: &storage.StorageMock{
+			DeletedUsers: []models.User{deletedUser},
+			DeletedFilters: []models.Filter{deletedFilter},
+		},
+		method: http.MethodGet,
+		path: "/trash",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: trashData{Users: []userData{{User: &deletedUser}}, Filters: []models.Filter{deletedFilter}},
+		},
+	},
+	{
+		testName: "Returns 500 on storage error while getting trash",
+		storage: &storage.StorageMock{Error: errors.New("test error")},
+		method: http.MethodGet,
+		path: "/trash",
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 200 on user restore",
+		storage: &storage.StorageMock{DeletedUsers: []models.User{deletedUser}},
+		method: http.MethodPost,
+		path: "/user/66d8420df6e5311a791e0a08/restore",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 404 on restore of user not in trash",
+		storage: &storage.StorageMock{DeletedUsers: []models.User{}},
+		method: http.MethodPost,
+		path: "/user/66d8420df6e5311a791e0a08/restore",
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No deleted user with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 200 on filter restore",
+		storage: &storage.StorageMock{DeletedFilters: []models.Filter{deletedFilter}},
+		method: http.MethodPost,
+		path: "/filter/66d8420df6e5311a791e0a09/restore",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 404 on restore of filter not in trash",
+		storage: &storage.StorageMock{DeletedFilters: []models.Filter{}},
+		method: http.MethodPost,
+		path: "/filter/66d8420df6e5311a791e0a09/restore",
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No deleted filter with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 500 on storage error while restoring filter",
+		storage: &storage.StorageMock{Error: errors.New("test error")},
+		method: http.MethodPost,
+		path: "/filter/66d8420df6e5311a791e0a09/restore",
+		expectedCode: http.StatusInternalServerError,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "internal_server_error",
+			ErrorMessage: "Internal server error",
+			Data: nil,
+		},
+	},
+}
+
+func TestTrashHandlers(t *testing.T) {
+	for i, test := range trashTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
@@ -7,12 +7,28 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
 	"github.com/xavesen/search-admin/internal/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	log "github.com/sirupsen/logrus"
 )
 
+// userData is user returned in responses, its password is shadowed to be left out
+// so that reading users doesn't hand out credentials accepted by the token endpoint
+type userData struct {
+	*models.User
+	Password	string	`json:"password,omitempty"`
+}
+
+func usersData(users []models.User) []userData {
+	data := make([]userData, len(users))
+	for i := range users {
+		data[i] = userData{User: &users[i]}
+	}
+	return data
+}
+
 func (s *Server) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	ctx := context.TODO()
 	users, err := s.storage.GetAllUsers(ctx)
@@ -21,7 +37,7 @@ func (s *Server) GetAllUsers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.WriteJSON(w, r, http.StatusOK, true, "", users)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", usersData(users))
 }
 
 func (s *Server) GetUserById(w http.ResponseWriter, r *http.Request) {
@@ -43,7 +59,7 @@ func (s *Server) GetUserById(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.WriteJSON(w, r, http.StatusOK, true, "", user)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", userData{User: user})
 }
 
 func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
@@ -51,30 +67,35 @@ func (s *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
 
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&newUser) ; err != nil {
-		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Invalid request payload", nil)
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
 		return
 	}
 
 	err := s.validator.Struct(newUser)
 	if err != nil {
-		logErrorString, errorString := utils.FormatErrorString(err, s.translator)
+		logErrorString := utils.FormatErrorString(err)
 		log.WithFields(log.Fields{
 			"request_id": r.Context().Value(utils.ContextKeyReqId),
 			"method": r.Method,
 			"url_path": r.URL.Path,
 		}).Warning(logErrorString)
-		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: " + errorString, nil)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
 		return
 	}
 
 	if newUser.Indexes == nil {
 		newUser.Indexes = []string{}
 	}
+	newUser.DeletedAt = nil
 
-	ctx := context.TODO()
+	ctx := auditContext(r)
 	newUser, err = s.storage.CreateUser(ctx, newUser)
 	if err != nil {
-		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		if err == storage.ErrDuplicateLogin {
+			utils.WriteJSON(w, r, http.StatusConflict, false, "User with such login already exists", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
 		return
 	}
 
@@ -89,7 +110,7 @@ func (s *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := context.TODO()
+	ctx := auditContext(r)
 	err := s.storage.DeleteUser(ctx, id)
 	if err != nil {
 		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
@@ -115,32 +136,45 @@ func (s *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	decoder := json.NewDecoder(r.Body)
 	if err := decoder.Decode(&updatedUser) ; err != nil {
-		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Invalid request payload", nil)
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
 		return
 	}
 
-	err := s.validator.Struct(updatedUser)
+	ctx := auditContext(r)
+	before, err := s.storage.GetUser(ctx, id)
 	if err != nil {
-		logErrorString, errorString := utils.FormatErrorString(err, s.translator)
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No user with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	err = utils.ExemptStoredUser(s.validator.Struct(updatedUser), before)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
 		log.WithFields(log.Fields{
 			"request_id": r.Context().Value(utils.ContextKeyReqId),
 			"method": r.Method,
 			"url_path": r.URL.Path,
 		}).Warning(logErrorString)
-		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: " + errorString, nil)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
 		return
 	}
 	
 	updatedUser.Id = id
+	updatedUser.DeletedAt = nil
 	if updatedUser.Indexes == nil {
 		updatedUser.Indexes = []string{}
 	}
 
-	ctx := context.TODO()
 	err = s.storage.UpdateUser(ctx, updatedUser)
 	if err != nil {
 		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
 			utils.WriteJSON(w, r, http.StatusNotFound, false, "No user with such id", nil)
+		} else if err == storage.ErrDuplicateLogin {
+			utils.WriteJSON(w, r, http.StatusConflict, false, "User with such login already exists", nil)
 		} else {
 			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
 		}
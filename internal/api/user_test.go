@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/config"
 	"github.com/xavesen/search-admin/internal/models"
 	"github.com/xavesen/search-admin/internal/storage"
 	"github.com/xavesen/search-admin/internal/utils"
@@ -53,26 +54,23 @@ var getAllUsersTests = []struct {
 		expectedResponse: utils.Response{
 			Success: true,
 			ErrorMessage: "",
-			Data: []models.User{
+			Data: usersData([]models.User{
 				{
 					Id:	"1",
 					Login: "mary",
-					Password: "12345",
 					IndexLimit: 5,
 				},
 				{
 					Id:	"2",
 					Login: "dane",
-					Password: "qwerty",
 					IndexLimit: 4,
 				},
 				{
 					Id:	"3",
 					Login: "linda",
-					Password: "password",
 					IndexLimit: 1,
 				},
-			},
+			}),
 		},
 	},
 	{
@@ -116,6 +114,7 @@ var getAllUsersTests = []struct {
 		expectedCode: http.StatusInternalServerError,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "internal_server_error",
 			ErrorMessage: "Internal server error",
 			Data: nil,
 		},
@@ -127,7 +126,7 @@ func TestGetAllUsersHandler(t *testing.T) {
 	for i, test := range getAllUsersTests {
 		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
 
-		server := NewServer("", test.storage, nil)
+		server := newTestServer(t, test.storage, nil)
 
 		req, err := http.NewRequest(http.MethodGet, "/users", nil)
 		if err != nil {
@@ -170,12 +169,11 @@ var getUserByIdTests = []struct {
 		expectedResponse: utils.Response{
 			Success: true,
 			ErrorMessage: "",
-			Data: models.User{
+			Data: userData{User: &models.User{
 				Id:	"1",
 				Login: "mary",
-				Password: "12345",
 				IndexLimit: 5,
-			},
+			}},
 		},
 	},
 	{
@@ -187,6 +185,7 @@ var getUserByIdTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No user with such id",
 			Data: nil,
 		},
@@ -200,6 +199,7 @@ var getUserByIdTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No user with such id",
 			Data: nil,
 		},
@@ -210,7 +210,7 @@ func TestGetUserByIdHandler(t *testing.T) {
 	for i, test := range getUserByIdTests {
 		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
 
-		server := NewServer("", test.storage, nil)
+		server := newTestServer(t, test.storage, nil)
 
 		path := fmt.Sprintf("/user/%s", test.userId)
 		req, err := http.NewRequest(http.MethodGet, path, nil)
@@ -234,6 +234,7 @@ func TestGetUserByIdHandler(t *testing.T) {
 var createUserTests = []struct {
 	testName			string
 	storage				*storage.StorageMock
+	config				*config.Config
 	payload				*models.User
 	expectedCode		int
 	expectedResponse	utils.Response
@@ -284,6 +285,24 @@ var createUserTests = []struct {
 			},
 		},
 	},
+	{
+		testName: "Returns 409 when login is taken by deleted user",
+		storage: &storage.StorageMock{
+			DeletedUsers: []models.User{{Id: "66d8420df6e5311a791e0a08", Login: "mary", Password: "54321", IndexLimit: 2}},
+		},
+		payload: &models.User{
+				Login: "mary",
+				Password: "12345",
+				IndexLimit: 5,
+		},
+		expectedCode: http.StatusConflict,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "conflict",
+			ErrorMessage: "User with such login already exists",
+			Data: nil,
+		},
+	},
 	{
 		testName: "Returns 400 with empty payload",
 		storage: &storage.StorageMock{
@@ -294,7 +313,13 @@ var createUserTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: login is required, password is required, index_limit is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "login", Rule: "required", Message: "login is required"},
+				{Field: "password", Rule: "required", Message: "password is required"},
+				{Field: "index_limit", Rule: "required", Message: "index_limit is required"},
+			},
 			Data: nil,
 		},
 	},
@@ -310,7 +335,11 @@ var createUserTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: login is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "login", Rule: "required", Message: "login is required"},
+			},
 			Data: nil,
 		},
 	},
@@ -326,7 +355,11 @@ var createUserTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: index_limit is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "index_limit", Rule: "required", Message: "index_limit is required"},
+			},
 			Data: nil,
 		},
 	},
@@ -342,7 +375,104 @@ var createUserTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: password is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "password", Rule: "required", Message: "password is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with login containing disallowed characters",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		payload:  &models.User{
+			Login: "mary smith",
+			Password: "12345",
+			IndexLimit: 5,
+		},
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes",
+			FieldErrors: []utils.FieldError{
+				{Field: "login", Rule: "login", Message: "login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with index limit above default maximum",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		payload:  &models.User{
+			Login: "mary",
+			Password: "12345",
+			IndexLimit: 101,
+		},
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: index_limit must be between 1 and 100",
+			FieldErrors: []utils.FieldError{
+				{Field: "index_limit", Rule: "index_limit", Message: "index_limit must be between 1 and 100"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with invalid index names",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		payload:  &models.User{
+			Login: "mary",
+			Password: "12345",
+			IndexLimit: 5,
+			Indexes: []string{"products", "Orders", "_logs"},
+		},
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: indexes[1] must be at most 255 characters long, start with a lowercase letter or digit and contain only lowercase letters, digits, dots, underscores and dashes, indexes[2] must be at most 255 characters long, start with a lowercase letter or digit and contain only lowercase letters, digits, dots, underscores and dashes",
+			FieldErrors: []utils.FieldError{
+				{Field: "indexes[1]", Rule: "index_name", Message: "indexes[1] must be at most 255 characters long, start with a lowercase letter or digit and contain only lowercase letters, digits, dots, underscores and dashes"},
+				{Field: "indexes[2]", Rule: "index_name", Message: "indexes[2] must be at most 255 characters long, start with a lowercase letter or digit and contain only lowercase letters, digits, dots, underscores and dashes"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with bounds from config",
+		storage: &storage.StorageMock{
+			Error: 	nil,
+		},
+		config: &config.Config{
+			AuthDisabled: true,
+			LoginMinLength: 5,
+			LoginMaxLength: 32,
+			IndexLimitMax: 3,
+		},
+		payload:  &models.User{
+			Login: "mary",
+			Password: "12345",
+			IndexLimit: 5,
+		},
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: login must be 5 to 32 characters long and contain only latin letters, digits, dots, underscores and dashes, index_limit must be between 1 and 3",
+			FieldErrors: []utils.FieldError{
+				{Field: "login", Rule: "login", Message: "login must be 5 to 32 characters long and contain only latin letters, digits, dots, underscores and dashes"},
+				{Field: "index_limit", Rule: "index_limit", Message: "index_limit must be between 1 and 3"},
+			},
 			Data: nil,
 		},
 	},
@@ -352,7 +482,7 @@ func TestCreateUserHandler(t *testing.T) {
 	for i, test := range createUserTests {
 		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
 
-		server := NewServer("", test.storage, nil)
+		server := newTestServer(t, test.storage, test.config)
 
 		marshaledPayload, err := json.Marshal(test.payload)
 		if err != nil {
@@ -406,6 +536,7 @@ var deleteUserTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No user with such id",
 			Data: nil,
 		},
@@ -419,6 +550,7 @@ var deleteUserTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No user with such id",
 			Data: nil,
 		},
@@ -432,6 +564,7 @@ var deleteUserTests = []struct {
 		expectedCode: http.StatusInternalServerError,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "internal_server_error",
 			ErrorMessage: "Internal server error",
 			Data: nil,
 		},
@@ -442,7 +575,7 @@ func TestDeleteUserHandler(t *testing.T) {
 	for i, test := range deleteUserTests {
 		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
 
-		server := NewServer("", test.storage, nil)
+		server := newTestServer(t, test.storage, nil)
 
 		path := fmt.Sprintf("/user/%s", test.userId)
 		req, err := http.NewRequest(http.MethodDelete, path, nil)
@@ -519,6 +652,65 @@ var updateUserTests = []struct {
 			},
 		},
 	},
+	{
+		testName: "Returns 200 when legacy user keeps values stored before domain rules",
+		storage: &storage.StorageMock{
+			User: models.User{
+				Id: "66d8420df6e5311a791e0a08",
+				Login: "mary@corp",
+				Password: "12345",
+				IndexLimit: 500,
+				Indexes: []string{"Legacy"},
+			},
+		},
+		userId: "66d8420df6e5311a791e0a08",
+		payload: &models.User{
+			Login: "mary@corp",
+			Password: "54321",
+			IndexLimit: 500,
+			Indexes: []string{"Legacy", "products"},
+		},
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.User{
+				Id:	"66d8420df6e5311a791e0a08",
+				Login: "mary@corp",
+				Password: "54321",
+				IndexLimit: 500,
+				Indexes: []string{"Legacy", "products"},
+			},
+		},
+	},
+	{
+		testName: "Returns 400 when legacy user changes values to ones breaking domain rules",
+		storage: &storage.StorageMock{
+			User: models.User{
+				Id: "66d8420df6e5311a791e0a08",
+				Login: "mary@corp",
+				Password: "12345",
+				IndexLimit: 500,
+			},
+		},
+		userId: "66d8420df6e5311a791e0a08",
+		payload: &models.User{
+			Login: "mary@home",
+			Password: "12345",
+			IndexLimit: 400,
+		},
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes, index_limit must be between 1 and 100",
+			FieldErrors: []utils.FieldError{
+				{Field: "login", Rule: "login", Message: "login must be 3 to 64 characters long and contain only latin letters, digits, dots, underscores and dashes"},
+				{Field: "index_limit", Rule: "index_limit", Message: "index_limit must be between 1 and 100"},
+			},
+			Data: nil,
+		},
+	},
 	{
 		testName: "Returns 400 with empty payload",
 		storage: &storage.StorageMock{
@@ -530,7 +722,13 @@ var updateUserTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: login is required, password is required, index_limit is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "login", Rule: "required", Message: "login is required"},
+				{Field: "password", Rule: "required", Message: "password is required"},
+				{Field: "index_limit", Rule: "required", Message: "index_limit is required"},
+			},
 			Data: nil,
 		},
 	},
@@ -547,7 +745,11 @@ var updateUserTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: login is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "login", Rule: "required", Message: "login is required"},
+			},
 			Data: nil,
 		},
 	},
@@ -564,7 +766,11 @@ var updateUserTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: index_limit is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "index_limit", Rule: "required", Message: "index_limit is required"},
+			},
 			Data: nil,
 		},
 	},
@@ -581,7 +787,11 @@ var updateUserTests = []struct {
 		expectedCode: http.StatusBadRequest,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
 			ErrorMessage: "Bad request: password is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "password", Rule: "required", Message: "password is required"},
+			},
 			Data: nil,
 		},
 	},
@@ -599,6 +809,7 @@ var updateUserTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No user with such id",
 			Data: nil,
 		},
@@ -617,10 +828,34 @@ var updateUserTests = []struct {
 		expectedCode: http.StatusNotFound,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "not_found",
 			ErrorMessage: "No user with such id",
 			Data: nil,
 		},
 	},
+	{
+		testName: "Returns 409 when login is taken by another user",
+		storage: &storage.StorageMock{
+			User: models.User{Id: "66d8420df6e5311a791e0a08", Login: "mary", Password: "12345", IndexLimit: 5},
+			Users: []models.User{
+				{Id: "66d8420df6e5311a791e0a08", Login: "mary", Password: "12345", IndexLimit: 5},
+				{Id: "66d8420df6e5311a791e0a09", Login: "dane", Password: "qwerty", IndexLimit: 4},
+			},
+		},
+		userId: "66d8420df6e5311a791e0a08",
+		payload:  &models.User{
+			Login: "dane",
+			Password: "12345",
+			IndexLimit: 5,
+		},
+		expectedCode: http.StatusConflict,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "conflict",
+			ErrorMessage: "User with such login already exists",
+			Data: nil,
+		},
+	},
 	{
 		testName: "Returns 500 when db returns an error",
 		storage: &storage.StorageMock{
@@ -635,6 +870,7 @@ var updateUserTests = []struct {
 		expectedCode: http.StatusInternalServerError,
 		expectedResponse: utils.Response{
 			Success: false,
+			ErrorCode: "internal_server_error",
 			ErrorMessage: "Internal server error",
 			Data: nil,
 		},
@@ -645,7 +881,7 @@ func TestUpdateUserHandler(t *testing.T) {
 	for i, test := range updateUserTests {
 		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
 
-		server := NewServer("", test.storage, nil)
+		server := newTestServer(t, test.storage, nil)
 
 		marshaledPayload, err := json.Marshal(test.payload)
 		if err != nil {
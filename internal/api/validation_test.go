@@ -0,0 +1,236 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+var requestValidationTests = []struct {
+	testName			string
+	config				*config.Config
+	method				string
+	path				string
+	contentType			string
+	authorization		string
+	payload				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 400 with errors for every invalid field",
+		method: http.MethodPost,
+		path: "/user",
+		payload: `{"login": 5, "index_limit": "ten", "indexes": "products"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: index_limit must be an integer, indexes must be an array, login must be a string, password is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "index_limit", Rule: "type", Message: "index_limit must be an integer"},
+				{Field: "indexes", Rule: "type", Message: "indexes must be an array"},
+				{Field: "login", Rule: "type", Message: "login must be a string"},
+				{Field: "password", Rule: "required", Message: "password is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with nested field path",
+		method: http.MethodPost,
+		path: "/filters/stats",
+		payload: `{"hits": [{"filter_id": "66d8420df6e5311a791e0a08", "bucket": "yesterday", "count": 0}]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: hits[0].bucket must be a RFC3339 timestamp, hits[0].count must be 1 or greater",
+			FieldErrors: []utils.FieldError{
+				{Field: "hits[0].bucket", Rule: "date-time", Message: "hits[0].bucket must be a RFC3339 timestamp"},
+				{Field: "hits[0].count", Rule: "min", Message: "hits[0].count must be 1 or greater"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with invalid query parameter",
+		method: http.MethodGet,
+		path: "/filters?include_inactive=maybe",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: include_inactive must be a boolean",
+			FieldErrors: []utils.FieldError{
+				{Field: "include_inactive", Rule: "type", Message: "include_inactive must be a boolean"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with query parameter of wrong type",
+		method: http.MethodGet,
+		path: "/changes?limit=ten",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: limit must be an integer",
+			FieldErrors: []utils.FieldError{
+				{Field: "limit", Rule: "type", Message: "limit must be an integer"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 without body",
+		method: http.MethodPost,
+		path: "/filter",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeInvalidPayload,
+			ErrorMessage: "Invalid request payload",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with body of wrong type",
+		method: http.MethodPost,
+		path: "/filter",
+		payload: `["^[a-z]+$"]`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeInvalidPayload,
+			ErrorMessage: "Invalid request payload",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Validates body sent without json content type as json",
+		method: http.MethodPost,
+		path: "/filter",
+		contentType: "application/x-www-form-urlencoded",
+		payload: `{"action": "drop"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: action must be one of [block redact tag], regex is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "action", Rule: "oneof", Message: "action must be one of [block redact tag]"},
+				{Field: "regex", Rule: "required", Message: "regex is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 201 and doesn't fill schema defaults into request",
+		method: http.MethodPost,
+		path: "/filter",
+		payload: `{"regex": "^[a-z]+$"}`,
+		expectedCode: http.StatusCreated,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: models.Filter{Id: "1", Regex: "^[a-z]+$"},
+		},
+	},
+	{
+		testName: "Returns 401 before validating body of unauthenticated request",
+		config: authConfig,
+		method: http.MethodPost,
+		path: "/user",
+		payload: `{"login": 5}`,
+		expectedCode: http.StatusUnauthorized,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "unauthorized",
+			ErrorMessage: "Authentication required",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with invalid body of authenticated request",
+		config: authConfig,
+		method: http.MethodPost,
+		path: "/user",
+		authorization: "Bearer static-token",
+		payload: `{"login": "tenant", "password": "secret", "index_limit": -1.5}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: index_limit must be an integer",
+			FieldErrors: []utils.FieldError{
+				{Field: "index_limit", Rule: "type", Message: "index_limit must be an integer"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 with invalid body of public route",
+		config: authConfig,
+		method: http.MethodPost,
+		path: "/login",
+		payload: `{"login": "alice"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: password is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "password", Rule: "required", Message: "password is required"},
+			},
+			Data: nil,
+		},
+	},
+}
+
+func TestRequestValidation(t *testing.T) {
+	for i, test := range requestValidationTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, &storage.StorageMock{Filters: []models.Filter{}}, test.config)
+
+		var body *bytes.Buffer
+		if test.payload != "" {
+			body = bytes.NewBufferString(test.payload)
+		} else {
+			body = &bytes.Buffer{}
+		}
+		req, err := http.NewRequest(test.method, test.path, body)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+		if test.contentType != "" {
+			req.Header.Set("Content-Type", test.contentType)
+		}
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
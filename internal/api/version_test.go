@@ -0,0 +1,187 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+var versionConfig = &config.Config{
+	AuthDisabled: 			true,
+	LegacyAPIDeprecatedAt: 	time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+	LegacyAPISunset: 		time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC),
+}
+
+var versionedUsers = []models.User{
+	{Id: "66d8420df6e5311a791e0a08", Login: "tenant", Password: "tenant-password", IndexLimit: 2},
+}
+
+var apiVersionTests = []struct {
+	testName			string
+	config				*config.Config
+	method				string
+	path				string
+	payload				string
+	expectedCode		int
+	expectedDeprecation	string
+	expectedSunset		string
+	expectedLink		string
+	expectedResponse	*utils.Response
+}{
+	{
+		testName: "Returns 200 on versioned path without deprecation headers",
+		config: versionConfig,
+		method: http.MethodGet,
+		path: "/v1/users",
+		expectedCode: http.StatusOK,
+		expectedResponse: &utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: usersData(versionedUsers),
+		},
+	},
+	{
+		testName: "Returns 200 and deprecation headers on legacy alias",
+		config: versionConfig,
+		method: http.MethodGet,
+		path: "/users",
+		expectedCode: http.StatusOK,
+		expectedDeprecation: "@1792368000",
+		expectedSunset: "Mon, 19 Apr 2027 00:00:00 GMT",
+		expectedLink: `</v1/users>; rel="successor-version"`,
+		expectedResponse: &utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: usersData(versionedUsers),
+		},
+	},
+	{
+		testName: "Returns deprecation headers without configured dates",
+		method: http.MethodGet,
+		path: "/user/66d8420df6e5311a791e0a08",
+		expectedCode: http.StatusOK,
+		expectedDeprecation: "true",
+		expectedSunset: "Mon, 19 Apr 2027 00:00:00 GMT",
+		expectedLink: `</v1/user/66d8420df6e5311a791e0a08>; rel="successor-version"`,
+		expectedResponse: &utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: userData{User: &versionedUsers[0]},
+		},
+	},
+	{
+		testName: "Returns deprecation headers on errors of legacy alias",
+		config: versionConfig,
+		method: http.MethodPost,
+		path: "/user",
+		payload: `{"login": "tenant"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedDeprecation: "@1792368000",
+		expectedSunset: "Mon, 19 Apr 2027 00:00:00 GMT",
+		expectedLink: `</v1/user>; rel="successor-version"`,
+		expectedResponse: &utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: password is required, index_limit is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "password", Rule: "required", Message: "password is required"},
+				{Field: "index_limit", Rule: "required", Message: "index_limit is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Validates requests to versioned path",
+		config: versionConfig,
+		method: http.MethodPost,
+		path: "/v1/user",
+		payload: `{"login": "tenant"}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: &utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: password is required, index_limit is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "password", Rule: "required", Message: "password is required"},
+				{Field: "index_limit", Rule: "required", Message: "index_limit is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Serves docs of versioned api",
+		config: versionConfig,
+		method: http.MethodGet,
+		path: "/v1/docs/",
+		expectedCode: http.StatusOK,
+	},
+	{
+		testName: "Returns 404 on unknown versioned path",
+		config: versionConfig,
+		method: http.MethodGet,
+		path: "/v1/v1/users",
+		expectedCode: http.StatusNotFound,
+	},
+}
+
+func TestAPIVersions(t *testing.T) {
+	for i, test := range apiVersionTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, &storage.StorageMock{Users: versionedUsers, User: versionedUsers[0]}, test.config)
+
+		req, err := http.NewRequest(test.method, test.path, strings.NewReader(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, rr.Header().Get("Deprecation"), test.expectedDeprecation, "wrong deprecation header")
+		assert.Equal(t, rr.Header().Get("Sunset"), test.expectedSunset, "wrong sunset header")
+		assert.Equal(t, rr.Header().Get("Link"), test.expectedLink, "wrong link header")
+
+		if test.expectedResponse != nil {
+			expectedResp, err := json.Marshal(test.expectedResponse)
+			if err != nil {
+				t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+			}
+			assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+		}
+	}
+}
+
+func TestUnversionedRoutes(t *testing.T) {
+	server := newTestServer(t, &storage.StorageMock{}, tokenConfig)
+
+	for _, test := range []struct{
+		path			string
+		expectedCode	int
+	}{
+		{path: "/.well-known/jwks.json", expectedCode: http.StatusOK},
+		{path: "/v1/.well-known/jwks.json", expectedCode: http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(http.MethodGet, test.path, nil)
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code for " + test.path)
+		assert.Equal(t, rr.Header().Get("Deprecation"), "", "unversioned route marked as deprecated")
+	}
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/utils"
+	"github.com/xavesen/search-admin/internal/webhooks"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	defaultDeliveriesLimit	= 100
+	maxDeliveriesLimit		= 1000
+)
+
+func (s *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var newWebhook *models.Webhook
+
+	decoder := json.NewDecoder(r.Body)
+	if err := decoder.Decode(&newWebhook) ; err != nil {
+		utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+		return
+	}
+
+	err := s.validator.Struct(newWebhook)
+	if err != nil {
+		logErrorString := utils.FormatErrorString(err)
+		log.WithFields(log.Fields{
+			"request_id": r.Context().Value(utils.ContextKeyReqId),
+			"method": r.Method,
+			"url_path": r.URL.Path,
+		}).Warning(logErrorString)
+		utils.WriteValidationError(w, r, utils.FieldErrors(err, utils.RequestTranslator(r)))
+		return
+	}
+
+	if webhookUrl, err := url.Parse(newWebhook.URL); err != nil || (webhookUrl.Scheme != "http" && webhookUrl.Scheme != "https") {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: url must be an http or https url", nil)
+		return
+	}
+
+	for _, selector := range newWebhook.Events {
+		if !webhooks.ValidSelector(selector) {
+			utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: " + utils.Translate(utils.RequestTranslator(r), "unknown event type {0}", selector), nil)
+			return
+		}
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		log.Errorf("Error generating webhook secret: %s", err)
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+	newWebhook.Id = ""
+	newWebhook.Secret = secret
+	newWebhook.CreatedAt = time.Now().UTC()
+
+	ctx := context.TODO()
+	newWebhook, err = s.storage.CreateWebhook(ctx, newWebhook)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	s.recordAudit(r, "webhook.create", models.AuditResourceWebhook, newWebhook.Id, nil, newWebhook)
+	utils.WriteJSON(w, r, http.StatusCreated, true, "", models.CreatedWebhook{Webhook: *newWebhook, Secret: secret})
+}
+
+func (s *Server) GetAllWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := context.TODO()
+	webhooks, err := s.storage.GetAllWebhooks(ctx)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", webhooks)
+}
+
+func (s *Server) GetWebhookById(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No webhook id provided", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	webhook, err := s.storage.GetWebhook(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No webhook with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", webhook)
+}
+
+func (s *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No webhook id provided", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	before, _ := s.storage.GetWebhook(ctx, id)
+	err := s.storage.DeleteWebhook(ctx, id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No webhook with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	s.recordAudit(r, "webhook.delete", models.AuditResourceWebhook, id, before, nil)
+	utils.WriteJSON(w, r, http.StatusOK, true, "", nil)
+}
+
+func (s *Server) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No webhook id provided", nil)
+		return
+	}
+
+	limit := int64(defaultDeliveriesLimit)
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxDeliveriesLimit {
+			utils.WriteJSON(w, r, http.StatusBadRequest, false, "Bad request: " + utils.Translate(utils.RequestTranslator(r), "limit must be between 1 and {0}", strconv.Itoa(maxDeliveriesLimit)), nil)
+			return
+		}
+	}
+
+	ctx := context.TODO()
+	if _, err := s.storage.GetWebhook(ctx, id); err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No webhook with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	deliveries, err := s.storage.GetWebhookDeliveries(ctx, id, limit)
+	if err != nil {
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	utils.WriteJSON(w, r, http.StatusOK, true, "", deliveries)
+}
+
+func (s *Server) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No webhook id provided", nil)
+		return
+	}
+	deliveryId, ok := vars["deliveryId"]
+	if !ok {
+		utils.WriteJSON(w, r, http.StatusBadRequest, false, "No delivery id provided", nil)
+		return
+	}
+
+	ctx := context.TODO()
+	err := s.storage.RedeliverWebhookDelivery(ctx, id, deliveryId, time.Now().UTC())
+	if err != nil {
+		if err == mongo.ErrNoDocuments || err == primitive.ErrInvalidHex {
+			utils.WriteJSON(w, r, http.StatusNotFound, false, "No delivery with such id", nil)
+		} else {
+			utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		}
+		return
+	}
+
+	s.recordAudit(r, "webhook.redeliver", models.AuditResourceWebhook, id, nil, map[string]string{"delivery_id": deliveryId})
+	utils.WriteJSON(w, r, http.StatusAccepted, true, "", nil)
+}
@@ -0,0 +1,290 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/outbox"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"github.com/xavesen/search-admin/internal/webhooks"
+)
+
+var testWebhook = models.Webhook{Id: "66d8420df6e5311a791e0a0a", URL: "https://example.com/hook", Events: []string{"user.*"}, Secret: "whsec_test"}
+
+var testDelivery = models.WebhookDelivery{
+	Id: 			"66d8420df6e5311a791e0a0b",
+	WebhookId: 		"66d8420df6e5311a791e0a0a",
+	EventId: 		"event",
+	EventType: 		"user.create",
+	Payload: 		`{"type":"user.create"}`,
+	Status: 		models.WebhookDeliveryFailed,
+	Attempts: 		10,
+	NextAttemptAt: 	time.Date(2024, 9, 4, 12, 0, 0, 0, time.UTC),
+	CreatedAt: 		time.Date(2024, 9, 4, 11, 0, 0, 0, time.UTC),
+}
+
+var webhookTests = []struct {
+	testName			string
+	storage				*storage.StorageMock
+	method				string
+	path				string
+	payload				string
+	expectedCode		int
+	expectedResponse	utils.Response
+}{
+	{
+		testName: "Returns 400 on webhook without url",
+		storage: &storage.StorageMock{},
+		method: http.MethodPost,
+		path: "/webhook",
+		payload: `{"events": ["user.create"]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: url is required",
+			FieldErrors: []utils.FieldError{
+				{Field: "url", Rule: "required", Message: "url is required"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 on webhook with non http url",
+		storage: &storage.StorageMock{},
+		method: http.MethodPost,
+		path: "/webhook",
+		payload: `{"url": "ftp://example.com/hook", "events": ["user.create"]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "bad_request",
+			ErrorMessage: "Bad request: url must be an http or https url",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 400 on webhook with unknown event type",
+		storage: &storage.StorageMock{},
+		method: http.MethodPost,
+		path: "/webhook",
+		payload: `{"url": "https://example.com/hook", "events": ["user.create", "role_binding.*"]}`,
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "bad_request",
+			ErrorMessage: "Bad request: unknown event type role_binding.*",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 200 and webhooks without secrets",
+		storage: &storage.StorageMock{Webhooks: []models.Webhook{testWebhook}},
+		method: http.MethodGet,
+		path: "/webhooks",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: []models.Webhook{testWebhook},
+		},
+	},
+	{
+		testName: "Returns 404 on non-existent webhook",
+		storage: &storage.StorageMock{Webhooks: []models.Webhook{}},
+		method: http.MethodGet,
+		path: "/webhook/66d8420df6e5311a791e0a0a",
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No webhook with such id",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 200 on webhook deletion",
+		storage: &storage.StorageMock{Webhooks: []models.Webhook{testWebhook}},
+		method: http.MethodDelete,
+		path: "/webhook/66d8420df6e5311a791e0a0a",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 200 and delivery log of webhook",
+		storage: &storage.StorageMock{
+			Webhooks: []models.Webhook{testWebhook},
+			WebhookDeliveries: []models.WebhookDelivery{testDelivery},
+		},
+		method: http.MethodGet,
+		path: "/webhook/66d8420df6e5311a791e0a0a/deliveries",
+		expectedCode: http.StatusOK,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: []models.WebhookDelivery{testDelivery},
+		},
+	},
+	{
+		testName: "Returns 400 on delivery log with invalid limit",
+		storage: &storage.StorageMock{Webhooks: []models.Webhook{testWebhook}},
+		method: http.MethodGet,
+		path: "/webhook/66d8420df6e5311a791e0a0a/deliveries?limit=0",
+		expectedCode: http.StatusBadRequest,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: utils.ErrorCodeValidationFailed,
+			ErrorMessage: "Bad request: limit must be between 1 and 1000",
+			FieldErrors: []utils.FieldError{
+				{Field: "limit", Rule: "min", Message: "limit must be between 1 and 1000"},
+			},
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 202 on redelivery",
+		storage: &storage.StorageMock{
+			Webhooks: []models.Webhook{testWebhook},
+			WebhookDeliveries: []models.WebhookDelivery{testDelivery},
+		},
+		method: http.MethodPost,
+		path: "/webhook/66d8420df6e5311a791e0a0a/deliveries/66d8420df6e5311a791e0a0b/redeliver",
+		expectedCode: http.StatusAccepted,
+		expectedResponse: utils.Response{
+			Success: true,
+			ErrorMessage: "",
+			Data: nil,
+		},
+	},
+	{
+		testName: "Returns 404 on redelivery of delivery of another webhook",
+		storage: &storage.StorageMock{
+			Webhooks: []models.Webhook{testWebhook},
+			WebhookDeliveries: []models.WebhookDelivery{testDelivery},
+		},
+		method: http.MethodPost,
+		path: "/webhook/66d8420df6e5311a791e0a0c/deliveries/66d8420df6e5311a791e0a0b/redeliver",
+		expectedCode: http.StatusNotFound,
+		expectedResponse: utils.Response{
+			Success: false,
+			ErrorCode: "not_found",
+			ErrorMessage: "No delivery with such id",
+			Data: nil,
+		},
+	},
+}
+
+func TestWebhookHandlers(t *testing.T) {
+	for i, test := range webhookTests {
+		fmt.Printf("Running test #%d: %s\n", i+1, test.testName)
+
+		server := newTestServer(t, test.storage, nil)
+
+		req, err := http.NewRequest(test.method, test.path, bytes.NewBufferString(test.payload))
+		if err != nil {
+			t.Fatalf("Unable to create request, error: %s\n", err)
+		}
+
+		rr := httptest.NewRecorder()
+		server.router.ServeHTTP(rr, req)
+
+		expectedResp, err := json.Marshal(test.expectedResponse)
+		if err != nil {
+			t.Fatalf("Unable to marshal expected response, error: %s\n", err)
+		}
+
+		assert.Equal(t, rr.Code, test.expectedCode, "wrong response code")
+		assert.Equal(t, strings.Trim(rr.Body.String(), "\n"), string(expectedResp), "wrong body contents")
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	requests := 0
+	var lastHeaders http.Header
+	var lastBody []byte
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		lastHeaders = r.Header.Clone()
+		lastBody, _ = io.ReadAll(r.Body)
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer endpoint.Close()
+
+	testStorage := &storage.StorageMock{}
+	server := newTestServer(t, testStorage, nil)
+
+	req, _ := http.NewRequest(http.MethodPost, "/webhook", bytes.NewBufferString(`{"url": "` + endpoint.URL + `", "events": ["user.*"]}`))
+	rr := httptest.NewRecorder()
+	server.router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusCreated, "wrong response code on webhook creation")
+
+	var created struct {
+		Data	models.CreatedWebhook	`json:"data"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Unable to unmarshal response, error: %s\n", err)
+	}
+	assert.Equal(t, strings.HasPrefix(created.Data.Secret, "whsec_"), true, "wrong webhook secret format")
+
+	testStorage.OutboxEvents = []models.OutboxEvent{
+		{Id: "1", Type: "filter.create", ResourceType: models.AuditResourceFilter, ResourceId: "2", Status: models.OutboxEventPending},
+		{Id: "2", Type: "user.create", ResourceType: models.AuditResourceUser, ResourceId: "1", Data: map[string]any{"login": "mary"}, Status: models.OutboxEventPending},
+	}
+	dispatcher := webhooks.NewDispatcher(testStorage, webhooks.Config{MaxAttempts: 3, Backoff: time.Minute, Timeout: time.Second})
+	relay := outbox.NewRelay(testStorage, time.Second, dispatcher)
+
+	ctx := context.Background()
+	if err := relay.RelayDue(ctx); err != nil {
+		t.Fatalf("Unable to relay outbox, error: %s\n", err)
+	}
+	assert.Equal(t, testStorage.OutboxEvents[1].Status, models.OutboxEventDelivered, "outbox event not delivered")
+	assert.Equal(t, len(testStorage.WebhookDeliveries), 1, "filter event delivered to user webhook")
+
+	if err := dispatcher.DeliverDue(ctx); err != nil {
+		t.Fatalf("Unable to deliver webhooks, error: %s\n", err)
+	}
+	delivery := testStorage.WebhookDeliveries[0]
+	assert.Equal(t, delivery.Status, models.WebhookDeliveryPending, "failed delivery is not retried")
+	assert.Equal(t, delivery.Attempts, 1, "wrong number of attempts")
+	assert.Equal(t, delivery.LastStatusCode, http.StatusServiceUnavailable, "wrong last status code")
+	assert.Equal(t, delivery.NextAttemptAt.After(time.Now().Add(50 * time.Second)), true, "retry is not backed off")
+
+	testStorage.WebhookDeliveries[0].NextAttemptAt = time.Now().UTC()
+	if err := dispatcher.DeliverDue(ctx); err != nil {
+		t.Fatalf("Unable to deliver webhooks, error: %s\n", err)
+	}
+	delivery = testStorage.WebhookDeliveries[0]
+	assert.Equal(t, delivery.Status, models.WebhookDeliverySucceeded, "delivery did not succeed")
+	assert.Equal(t, delivery.Attempts, 2, "wrong number of attempts")
+	assert.Equal(t, requests, 2, "wrong number of requests to endpoint")
+
+	timestamp, _ := strconv.ParseInt(lastHeaders.Get(webhooks.TimestampHeader), 10, 64)
+	assert.Equal(t, lastHeaders.Get(webhooks.SignatureHeader), webhooks.Sign(created.Data.Secret, timestamp, lastBody), "wrong signature")
+	assert.Equal(t, lastHeaders.Get(webhooks.EventHeader), "user.create", "wrong event header")
+
+	var event models.WebhookEvent
+	if err := json.Unmarshal(lastBody, &event); err != nil {
+		t.Fatalf("Unable to unmarshal event, error: %s\n", err)
+	}
+	assert.Equal(t, event.Id, "2", "webhook event id differs from outbox event id")
+}
@@ -0,0 +1,254 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xavesen/search-admin/internal/models"
+)
+
+const redacted = "***"
+
+// sensitiveFields are redacted at any depth of audited resources
+var sensitiveFields = map[string]bool{
+	"password":				true,
+	"api_key":				true,
+	"passwordhash":			true,
+	"keyhash":				true,
+	"tokenhash":			true,
+	"key":					true,
+	"token":				true,
+	"encryptedprivatekey":	true,
+	"secret":				true,
+	"client_secret":		true,
+}
+
+func snapshot(resource any) map[string]any {
+	/*
+	Resources are snapshotted in their json form,
+	same way they are seen through the api.
+	*/
+
+	if resource == nil {
+		return nil
+	}
+	if value := reflect.ValueOf(resource); value.Kind() == reflect.Ptr && value.IsNil() {
+		return nil
+	}
+
+	resourceJson, err := json.Marshal(resource)
+	if err != nil {
+		return nil
+	}
+
+	snapshot := map[string]any{}
+	if err := json.Unmarshal(resourceJson, &snapshot); err != nil {
+		return nil
+	}
+
+	return snapshot
+}
+
+func redact(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if sensitiveFields[strings.ToLower(key)] {
+				v[key] = redacted
+			} else {
+				v[key] = redact(child)
+			}
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = redact(child)
+		}
+	}
+
+	return value
+}
+
+func redactField(field string, value any) any {
+	if value != nil && sensitiveFields[strings.ToLower(field)] {
+		return redacted
+	}
+
+	return redact(value)
+}
+
+// Redact returns json form of resource with sensitive fields redacted
+func Redact(resource any) map[string]any {
+	if snapshot := snapshot(resource); snapshot != nil {
+		return redact(snapshot).(map[string]any)
+	}
+
+	return nil
+}
+
+type originContextKey struct{}
+
+// Origin tells who makes a change and in which request
+type Origin struct {
+	Actor		string
+	ActorMethod	string
+	RequestId	string
+}
+
+// WithOrigin marks changes made with ctx to be audited as made by origin
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originContextKey{}, origin)
+}
+
+func OriginFromContext(ctx context.Context) (Origin, bool) {
+	origin, ok := ctx.Value(originContextKey{}).(Origin)
+	return origin, ok
+}
+
+// Event returns audit event of change made by origin now
+func (origin Origin) Event(action string, resourceType string, resourceId string, before any, after any) models.AuditEvent {
+	event := NewEvent(action, resourceType, resourceId, before, after)
+	event.Time = time.Now().UTC()
+	event.Actor = origin.Actor
+	event.ActorMethod = origin.ActorMethod
+	event.RequestId = origin.RequestId
+
+	return event
+}
+
+func NewEvent(action string, resourceType string, resourceId string, before any, after any) models.AuditEvent {
+	/*
+	Diff is computed before redaction, so changed password
+	is still recorded as a change, just without its values.
+	*/
+
+	beforeSnapshot, afterSnapshot := snapshot(before), snapshot(after)
+
+	keys := map[string]bool{}
+	for key := range beforeSnapshot {
+		keys[key] = true
+	}
+	for key := range afterSnapshot {
+		keys[key] = true
+	}
+
+	fields := make([]string, 0, len(keys))
+	for key := range keys {
+		fields = append(fields, key)
+	}
+	sort.Strings(fields)
+
+	changes := []models.AuditChange{}
+	for _, field := range fields {
+		if !reflect.DeepEqual(beforeSnapshot[field], afterSnapshot[field]) {
+			changes = append(changes, models.AuditChange{
+				Field: 	field,
+				Before: redactField(field, beforeSnapshot[field]),
+				After: 	redactField(field, afterSnapshot[field]),
+			})
+		}
+	}
+
+	if beforeSnapshot != nil {
+		redact(beforeSnapshot)
+	}
+	if afterSnapshot != nil {
+		redact(afterSnapshot)
+	}
+
+	return models.AuditEvent{
+		Action: 		action,
+		ResourceType: 	resourceType,
+		ResourceId: 	resourceId,
+		Before: 		beforeSnapshot,
+		After: 			afterSnapshot,
+		Changes: 		changes,
+	}
+}
+
+// RedactJSON returns json document with sensitive fields redacted, keeping its layout
+func RedactJSON(document []byte) ([]byte, error) {
+	/*
+	Document is rewritten token by token instead of being decoded to a map,
+	so order of keys stays the same as in the original document.
+	*/
+
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.UseNumber()
+
+	var redactedDocument bytes.Buffer
+	if err := redactJSONValue(decoder, &redactedDocument); err != nil {
+		return nil, err
+	}
+	redactedDocument.Write(document[decoder.InputOffset():])
+
+	return redactedDocument.Bytes(), nil
+}
+
+func redactJSONValue(decoder *json.Decoder, out *bytes.Buffer) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return writeJSONToken(out, token)
+	}
+
+	out.WriteRune(rune(delim))
+	for i := 0; decoder.More(); i++ {
+		if i > 0 {
+			out.WriteByte(',')
+		}
+		if delim == '[' {
+			if err := redactJSONValue(decoder, out); err != nil {
+				return err
+			}
+			continue
+		}
+
+		key, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		if err := writeJSONToken(out, key); err != nil {
+			return err
+		}
+		out.WriteByte(':')
+
+		if name, _ := key.(string); sensitiveFields[strings.ToLower(name)] {
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				return err
+			}
+			if err := writeJSONToken(out, redacted); err != nil {
+				return err
+			}
+		} else if err := redactJSONValue(decoder, out); err != nil {
+			return err
+		}
+	}
+
+	closing, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	out.WriteRune(rune(closing.(json.Delim)))
+
+	return nil
+}
+
+func writeJSONToken(out *bytes.Buffer, token json.Token) error {
+	tokenJson, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	out.Write(tokenJson)
+
+	return nil
+}
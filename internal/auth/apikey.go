@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"strings"
+)
+
+const (
+	apiKeyPrefix		= "sak_"
+	apiKeyLookupBytes	= 6
+	apiKeySecretBytes	= 32
+)
+
+func NewAPIKey() (key string, lookupPrefix string, err error) {
+	/*
+	Key contains lookup prefix, which is stored in plain text
+	and lets us find the key without scanning all key hashes.
+	*/
+
+	lookupPrefix, err = RandomToken(apiKeyLookupBytes)
+	if err != nil {
+		return "", "", err
+	}
+	secret, err := RandomToken(apiKeySecretBytes)
+	if err != nil {
+		return "", "", err
+	}
+
+	return apiKeyPrefix + lookupPrefix + "." + secret, lookupPrefix, nil
+}
+
+func ParseAPIKey(key string) (lookupPrefix string, ok bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", false
+	}
+
+	lookupPrefix, secret, ok := strings.Cut(strings.TrimPrefix(key, apiKeyPrefix), ".")
+	if !ok || lookupPrefix == "" || secret == "" {
+		return "", false
+	}
+
+	return lookupPrefix, true
+}
+
+func CheckAPIKey(keyHash string, key string) bool {
+	return subtle.ConstantTimeCompare([]byte(keyHash), []byte(HashToken(key))) == 1
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+const (
+	MethodStaticToken	= "static_token"
+	MethodJWT			= "jwt"
+)
+
+var (
+	ErrUnknownCredentials	= errors.New("credentials are not recognized by authenticator")
+	ErrInvalidCredentials	= errors.New("invalid credentials")
+
+	/*
+	Credentials can't be checked when storage or identity provider
+	fails, such errors wrap these so they aren't reported as invalid
+	credentials, which would hide outages behind 401 responses.
+	*/
+	ErrBackendUnavailable			= errors.New("authentication backend is unavailable")
+	ErrIdentityProviderUnavailable	= errors.New("identity provider is unavailable")
+)
+
+type Principal struct {
+	Subject		string		`json:"subject"`
+	Method		string		`json:"method"`
+	SessionId	string		`json:"session_id,omitempty"`
+	Roles		[]string	`json:"roles,omitempty"`
+}
+
+type Authenticator interface {
+	/*
+	Authenticate returns ErrUnknownCredentials when token
+	is not meant for this authenticator, so the next one can try it.
+	*/
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+type ChainAuthenticator struct {
+	authenticators	[]Authenticator
+}
+
+func NewChainAuthenticator(authenticators ...Authenticator) *ChainAuthenticator {
+	return &ChainAuthenticator{authenticators: authenticators}
+}
+
+func (c *ChainAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	for _, authenticator := range c.authenticators {
+		principal, err := authenticator.Authenticate(ctx, token)
+		if err == ErrUnknownCredentials {
+			continue
+		}
+		return principal, err
+	}
+
+	return nil, ErrUnknownCredentials
+}
+
+var subjectPrefixes = map[string]string{
+	MethodStaticToken:	"token",
+	MethodJWT:			"jwt",
+	MethodSession:		"admin",
+	MethodOIDC:			"oidc",
+}
+
+func (p *Principal) QualifiedSubject() string {
+	/*
+	Subjects are only unique within their authentication method,
+	a jwt subject may be named the same as a static token one,
+	so permissions and other per subject state are keyed by both.
+	*/
+
+	prefix, ok := subjectPrefixes[p.Method]
+	if !ok {
+		prefix = p.Method
+	}
+
+	return prefix + ":" + p.Subject
+}
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, utils.ContextKeyPrincipal, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(utils.ContextKeyPrincipal).(*Principal)
+	return principal, ok
+}
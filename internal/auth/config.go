@@ -0,0 +1,77 @@
+package auth
+
+import (
+	log "github.com/sirupsen/logrus"
+	cfg "github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/storage"
+)
+
+func NewOIDCProviderFromConfig(config *cfg.Config) (*OIDCProvider, error) {
+	if config.AuthDisabled || config.OIDCIssuer == "" {
+		return nil, nil
+	}
+
+	log.Debugf("Enabling oidc authentication with issuer %s", config.OIDCIssuer)
+	return NewOIDCProvider(OIDCConfig{
+		Issuer: 		config.OIDCIssuer,
+		ClientId: 		config.OIDCClientId,
+		ClientSecret: 	config.OIDCClientSecret,
+		RedirectURL: 	config.OIDCRedirectURL,
+		Scopes: 		config.OIDCScopes,
+		SubjectClaim: 	config.OIDCSubjectClaim,
+		GroupsClaim: 	config.OIDCGroupsClaim,
+		GroupRoles: 	config.OIDCGroupRoles,
+		JWKSCacheTTL: 	config.OIDCJWKSCacheTTL,
+	})
+}
+
+func NewAuthenticatorFromConfig(config *cfg.Config, storage storage.Storage, oidcProvider *OIDCProvider) (Authenticator, error) {
+	/*
+	Returns nil authenticator when authentication is disabled.
+	Admin sessions are always accepted, other methods are
+	enabled when they are configured.
+	*/
+
+	if config.AuthDisabled {
+		log.Warning("Authentication is disabled, admin api is open to anyone")
+		return nil, nil
+	}
+
+	authenticators := []Authenticator{}
+
+	if len(config.AuthTokens) > 0 {
+		log.Debugf("Enabling static token authentication with %d tokens", len(config.AuthTokens))
+		staticAuthenticator, err := NewStaticTokenAuthenticator(config.AuthTokens)
+		if err != nil {
+			log.Errorf("Error initializing static token authentication: %s", err)
+			return nil, err
+		}
+		authenticators = append(authenticators, staticAuthenticator)
+	}
+
+	if config.AuthJWTSecret != "" {
+		log.Debug("Enabling jwt authentication")
+		authenticators = append(authenticators, NewJWTAuthenticator(config.AuthJWTSecret, config.AuthJWTIssuer, config.AuthJWTAudience))
+	}
+
+	if oidcProvider != nil {
+		authenticators = append(authenticators, oidcProvider)
+	}
+
+	authenticators = append(authenticators, NewSessionAuthenticator(storage))
+
+	return NewChainAuthenticator(authenticators...), nil
+}
+
+func NewPasswordThrottleFromConfig(config *cfg.Config, storage storage.Storage) *Throttle {
+	maxFailures := config.PasswordMaxFailures
+	if maxFailures <= 0 {
+		maxFailures = cfg.DefaultPasswordMaxFailures
+	}
+	window := config.PasswordFailureWindow
+	if window <= 0 {
+		window = cfg.DefaultPasswordFailureWindow
+	}
+
+	return NewThrottle(storage, maxFailures, window)
+}
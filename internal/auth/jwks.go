@@ -0,0 +1,225 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrUnknownKey = errors.New("no key with such kid in jwks")
+
+type jsonWebKey struct {
+	Kid	string	`json:"kid"`
+	Kty	string	`json:"kty"`
+	Use	string	`json:"use,omitempty"`
+	N	string	`json:"n,omitempty"`
+	E	string	`json:"e,omitempty"`
+	Crv	string	`json:"crv,omitempty"`
+	X	string	`json:"x,omitempty"`
+	Y	string	`json:"y,omitempty"`
+}
+
+type jsonWebKeySet struct {
+	Keys	[]jsonWebKey	`json:"keys"`
+}
+
+type JWKSCache struct {
+	url					string
+	httpClient			*http.Client
+	maxAge				time.Duration
+	minRefreshInterval	time.Duration
+
+	mu				sync.Mutex
+	keys			map[string]crypto.PublicKey
+	fetchedAt		time.Time
+	refreshedAt		time.Time
+	missRefreshedAt	time.Time
+	refreshErr		error
+	refreshing		chan struct{}
+}
+
+func NewJWKSCache(url string, httpClient *http.Client, maxAge time.Duration) *JWKSCache {
+	return &JWKSCache{
+		url: 				url,
+		httpClient: 		httpClient,
+		maxAge: 			maxAge,
+		minRefreshInterval:	10 * time.Second,
+		keys: 				map[string]crypto.PublicKey{},
+	}
+}
+
+func (c *JWKSCache) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	/*
+	Keys are refetched when cache is older than max age, and when
+	token is signed with unknown kid, which is how issuers rotate keys.
+	Refetches are rate limited, so tokens with random kids and
+	failing issuer can't make us hammer it, and only one runs at
+	a time, requests arriving meanwhile wait for its result.
+	While issuer is unavailable previously fetched keys are served.
+	*/
+
+	c.mu.Lock()
+	now := time.Now()
+	stale := c.fetchedAt.IsZero() || now.Sub(c.fetchedAt) > c.maxAge
+	key, ok := c.keys[kid]
+	if ok && !stale {
+		c.mu.Unlock()
+		return key, nil
+	}
+
+	refresh := false
+	if stale {
+		refresh = now.Sub(c.refreshedAt) > c.minRefreshInterval
+	} else {
+		refresh = now.Sub(c.missRefreshedAt) > c.minRefreshInterval
+	}
+
+	refreshing := c.refreshing
+	if refreshing == nil && refresh {
+		refreshing = make(chan struct{})
+		c.refreshing = refreshing
+		if stale {
+			c.refreshedAt = now
+		} else {
+			c.missRefreshedAt = now
+		}
+		c.mu.Unlock()
+
+		keys, err := c.fetch(ctx)
+
+		c.mu.Lock()
+		c.refreshErr = err
+		if err == nil {
+			c.keys = keys
+			c.fetchedAt = time.Now()
+		}
+		c.refreshing = nil
+		close(refreshing)
+		c.mu.Unlock()
+	} else {
+		c.mu.Unlock()
+	}
+
+	if refreshing != nil {
+		select {
+		case <-refreshing:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key, ok = c.keys[kid]
+	if ok {
+		return key, nil
+	}
+	if c.refreshErr != nil {
+		return nil, fmt.Errorf("%w: %s", ErrIdentityProviderUnavailable, c.refreshErr)
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (c *JWKSCache) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	log.Debugf("Fetching jwks from %s", c.url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		log.Errorf("Error fetching jwks from %s: %s", c.url, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Errorf("Error fetching jwks from %s: unexpected status %d", c.url, resp.StatusCode)
+		return nil, fmt.Errorf("jwks endpoint responded with status %d", resp.StatusCode)
+	}
+
+	var keySet jsonWebKeySet
+	if err := json.NewDecoder(resp.Body).Decode(&keySet); err != nil {
+		log.Errorf("Error decoding jwks from %s: %s", c.url, err)
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Warningf("Skipping jwk %s from %s: %s", jwk.Kid, c.url, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	log.Debugf("Successfully fetched %d keys from %s", len(keys), c.url)
+	return keys, nil
+}
+
+func (jwk *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(decoded), nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+type JWTAuthenticator struct {
+	secret	[]byte
+	parser	*jwt.Parser
+}
+
+func NewJWTAuthenticator(secret string, issuer string, audience string) *JWTAuthenticator {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(issuer))
+	}
+	if audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(audience))
+	}
+
+	return &JWTAuthenticator{
+		secret: []byte(secret),
+		parser: jwt.NewParser(parserOpts...),
+	}
+}
+
+func looksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if !looksLikeJWT(token) {
+		return nil, ErrUnknownCredentials
+	}
+
+	unverified, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		log.Warningf("Error parsing jwt: %s", err)
+		return nil, ErrInvalidCredentials
+	}
+	if alg, _ := unverified.Header["alg"].(string); !strings.HasPrefix(alg, "HS") {
+		return nil, ErrUnknownCredentials
+	}
+
+	claims := jwt.RegisteredClaims{}
+	_, err = a.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return a.secret, nil
+	})
+	if err != nil {
+		log.Warningf("Error validating jwt: %s", err)
+		return nil, ErrInvalidCredentials
+	}
+
+	if claims.Subject == "" {
+		log.Warning("Valid jwt without subject claim")
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{Subject: claims.Subject, Method: MethodJWT}, nil
+}
@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	MethodOIDC				= "oidc"
+	oidcDiscoveryPath		= "/.well-known/openid-configuration"
+	oidcHTTPTimeout			= 10 * time.Second
+	oidcClockSkew			= time.Minute
+)
+
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+type OIDCConfig struct {
+	Issuer			string
+	ClientId		string
+	ClientSecret	string
+	RedirectURL		string
+	Scopes			[]string
+	SubjectClaim	string
+	GroupsClaim		string
+	GroupRoles		[]string
+	JWKSCacheTTL	time.Duration
+}
+
+type oidcDiscovery struct {
+	Issuer					string	`json:"issuer"`
+	AuthorizationEndpoint	string	`json:"authorization_endpoint"`
+	TokenEndpoint			string	`json:"token_endpoint"`
+	JWKSURI					string	`json:"jwks_uri"`
+}
+
+type OIDCProvider struct {
+	config		OIDCConfig
+	groupRoles	map[string][]string
+	httpClient	*http.Client
+
+	mu			sync.Mutex
+	discovery	*oidcDiscovery
+	keys		*JWKSCache
+}
+
+func NewOIDCProvider(config OIDCConfig) (*OIDCProvider, error) {
+	/*
+	Discovery happens on first use rather than here,
+	so the server can start while identity provider is unavailable.
+	*/
+
+	if config.Issuer == "" || config.ClientId == "" {
+		return nil, errors.New("oidc issuer and client id are required")
+	}
+	if config.SubjectClaim == "" {
+		config.SubjectClaim = "sub"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	}
+	if config.JWKSCacheTTL <= 0 {
+		config.JWKSCacheTTL = time.Hour
+	}
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
+	groupRoles := map[string][]string{}
+	for _, pair := range config.GroupRoles {
+		group, role, ok := strings.Cut(pair, ":")
+		if !ok || group == "" {
+			return nil, fmt.Errorf("invalid group role mapping %q, must be in group:role format", pair)
+		}
+		if _, known := RolePermissions[role]; !known && role != RoleSuperadmin {
+			return nil, fmt.Errorf("unknown role %q in group role mapping", role)
+		}
+		groupRoles[group] = append(groupRoles[group], role)
+	}
+
+	return &OIDCProvider{
+		config: 	config,
+		groupRoles:	groupRoles,
+		httpClient:	&http.Client{Timeout: oidcHTTPTimeout},
+	}, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, *JWKSCache, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, p.keys, nil
+	}
+
+	discoveryURL := p.config.Issuer + oidcDiscoveryPath
+	log.Infof("Discovering oidc provider configuration from %s", discoveryURL)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		log.Errorf("Error fetching oidc discovery document from %s: %s", discoveryURL, err)
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Errorf("Error fetching oidc discovery document from %s: unexpected status %d", discoveryURL, resp.StatusCode)
+		return nil, nil, fmt.Errorf("oidc discovery endpoint responded with status %d", resp.StatusCode)
+	}
+
+	var discovery oidcDiscovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		log.Errorf("Error decoding oidc discovery document from %s: %s", discoveryURL, err)
+		return nil, nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.config.Issuer {
+		log.Errorf("Oidc discovery document issuer %s doesn't match configured issuer %s", discovery.Issuer, p.config.Issuer)
+		return nil, nil, errors.New("oidc issuer mismatch")
+	}
+	if discovery.JWKSURI == "" {
+		return nil, nil, errors.New("oidc discovery document has no jwks_uri")
+	}
+
+	p.discovery = &discovery
+	p.keys = NewJWKSCache(discovery.JWKSURI, p.httpClient, p.config.JWKSCacheTTL)
+
+	log.Info("Successfully discovered oidc provider configuration")
+	return p.discovery, p.keys, nil
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state string, nonce string, verifier string) (string, error) {
+	discovery, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	if discovery.AuthorizationEndpoint == "" {
+		return "", errors.New("oidc discovery document has no authorization_endpoint")
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":			{"code"},
+		"client_id":				{p.config.ClientId},
+		"redirect_uri":				{p.config.RedirectURL},
+		"scope":					{strings.Join(p.config.Scopes, " ")},
+		"state":					{state},
+		"nonce":					{nonce},
+		"code_challenge":			{base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method":	{"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, verifier string) (string, error) {
+	/*
+	Returns id token from the token response,
+	access and refresh tokens of identity provider are not used.
+	*/
+
+	discovery, _, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	if discovery.TokenEndpoint == "" {
+		return "", errors.New("oidc discovery document has no token_endpoint")
+	}
+
+	form := url.Values{
+		"grant_type":		{"authorization_code"},
+		"code":				{code},
+		"redirect_uri":		{p.config.RedirectURL},
+		"code_verifier":	{verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.config.ClientId), url.QueryEscape(p.config.ClientSecret))
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		log.Errorf("Error exchanging oidc authorization code: %s", err)
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		IdToken				string	`json:"id_token"`
+		Error				string	`json:"error"`
+		ErrorDescription	string	`json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		log.Errorf("Error decoding oidc token response: %s", err)
+		return "", err
+	}
+
+	if resp.StatusCode != http.StatusOK || tokenResponse.Error != "" {
+		log.Warningf("Oidc token endpoint rejected authorization code with status %d: %s %s", resp.StatusCode, tokenResponse.Error, tokenResponse.ErrorDescription)
+		return "", ErrInvalidCredentials
+	}
+	if tokenResponse.IdToken == "" {
+		log.Error("Oidc token response has no id token")
+		return "", errors.New("oidc token response has no id_token")
+	}
+
+	return tokenResponse.IdToken, nil
+}
+
+func (p *OIDCProvider) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if !looksLikeJWT(token) {
+		return nil, ErrUnknownCredentials
+	}
+
+	unverified, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		return nil, ErrUnknownCredentials
+	}
+	if issuer, _ := unverified.Claims.GetIssuer(); strings.TrimSuffix(issuer, "/") != p.config.Issuer {
+		return nil, ErrUnknownCredentials
+	}
+
+	principal, _, err := p.VerifyIDToken(ctx, token, "")
+	return principal, err
+}
+
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, token string, nonce string) (*Principal, time.Time, error) {
+	/*
+	Nonce is only checked for tokens obtained through the login flow,
+	bearer tokens are validated by issuer, audience and expiration.
+	*/
+
+	_, keys, err := p.discover(ctx)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: %s", ErrIdentityProviderUnavailable, err)
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuer(p.config.Issuer),
+		jwt.WithAudience(p.config.ClientId),
+		jwt.WithLeeway(oidcClockSkew),
+	)
+
+	claims := jwt.MapClaims{}
+	_, err = parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return keys.Key(ctx, kid)
+	})
+	if errors.Is(err, ErrIdentityProviderUnavailable) {
+		return nil, time.Time{}, err
+	} else if err != nil {
+		log.Warningf("Error validating oidc id token: %s", err)
+		return nil, time.Time{}, ErrInvalidCredentials
+	}
+
+	if nonce != "" {
+		if tokenNonce, _ := claims["nonce"].(string); tokenNonce != nonce {
+			log.Warning("Oidc id token nonce doesn't match login nonce")
+			return nil, time.Time{}, ErrInvalidCredentials
+		}
+	}
+
+	subject, _ := claims[p.config.SubjectClaim].(string)
+	if subject == "" {
+		log.Warningf("Valid oidc id token without %s claim", p.config.SubjectClaim)
+		return nil, time.Time{}, ErrInvalidCredentials
+	}
+
+	expiresAt, _ := claims.GetExpirationTime()
+
+	return &Principal{Subject: subject, Method: MethodOIDC, Roles: p.rolesFromClaims(claims)}, expiresAt.Time, nil
+}
+
+func (p *OIDCProvider) rolesFromClaims(claims jwt.MapClaims) []string {
+	groups := []string{}
+	switch value := claims[p.config.GroupsClaim].(type) {
+	case string:
+		groups = append(groups, value)
+	case []interface{}:
+		for _, group := range value {
+			if groupName, ok := group.(string); ok {
+				groups = append(groups, groupName)
+			}
+		}
+	}
+
+	roles := []string{}
+	seen := map[string]bool{}
+	for _, group := range groups {
+		for _, role := range p.groupRoles[group] {
+			if !seen[role] {
+				seen[role] = true
+				roles = append(roles, role)
+			}
+		}
+	}
+
+	return roles
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	RoleViewer			= "viewer"
+	RoleFilterEditor	= "filter-editor"
+	RoleUserAdmin		= "user-admin"
+	RoleSearchService	= "search-service"
+	RoleSuperadmin		= "superadmin"
+)
+
+type Permission string
+
+const (
+	PermissionUsersRead			Permission = "users:read"
+	PermissionUsersWrite		Permission = "users:write"
+	PermissionUsersDelete		Permission = "users:delete"
+	PermissionFiltersRead		Permission = "filters:read"
+	PermissionFiltersWrite		Permission = "filters:write"
+	PermissionFiltersDelete		Permission = "filters:delete"
+	PermissionFiltersEvaluate	Permission = "filters:evaluate"
+	PermissionStatsWrite		Permission = "stats:write"
+	PermissionRolesManage		Permission = "roles:manage"
+	PermissionAdminsManage		Permission = "admins:manage"
+	PermissionKeysVerify		Permission = "keys:verify"
+	PermissionAuditRead			Permission = "audit:read"
+	PermissionTrashRead			Permission = "trash:read"
+	PermissionWebhooksManage	Permission = "webhooks:manage"
+	PermissionChangesRead		Permission = "changes:read"
+)
+
+var viewerPermissions = []Permission{
+	PermissionUsersRead,
+	PermissionFiltersRead,
+	PermissionFiltersEvaluate,
+	PermissionTrashRead,
+	PermissionChangesRead,
+}
+
+var RolePermissions = map[string][]Permission{
+	RoleViewer:			viewerPermissions,
+	RoleFilterEditor:	append([]Permission{PermissionFiltersWrite, PermissionFiltersDelete, PermissionStatsWrite}, viewerPermissions...),
+	RoleUserAdmin:		append([]Permission{PermissionUsersWrite, PermissionUsersDelete}, viewerPermissions...),
+	RoleSearchService:	{PermissionKeysVerify},
+}
+
+func HasPermission(roles []string, permission Permission) bool {
+	for _, role := range roles {
+		if role == RoleSuperadmin {
+			return true
+		}
+		for _, rolePermission := range RolePermissions[role] {
+			if rolePermission == permission {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+type RoleResolver struct {
+	storage		storage.Storage
+	superadmins	map[string]bool
+}
+
+func NewRoleResolver(storage storage.Storage, superadmins []string) *RoleResolver {
+	/*
+	Superadmins from config always have superadmin role,
+	so there is someone to create the first role bindings.
+	They are qualified subjects, like "token:deploy-bot".
+	*/
+
+	resolver := &RoleResolver{
+		storage: 		storage,
+		superadmins:	map[string]bool{},
+	}
+	for _, subject := range superadmins {
+		resolver.superadmins[subject] = true
+	}
+
+	return resolver
+}
+
+func (r *RoleResolver) Roles(ctx context.Context, principal *Principal) ([]string, error) {
+	/*
+	Roles carried by principal itself, like ones mapped
+	from identity provider groups, are added to bound roles.
+	*/
+
+	subject := principal.QualifiedSubject()
+	roles := []string{}
+	if r.superadmins[subject] {
+		roles = append(roles, RoleSuperadmin)
+	}
+	roles = append(roles, principal.Roles...)
+
+	binding, err := r.storage.GetRoleBinding(ctx, subject)
+	if err == mongo.ErrNoDocuments {
+		log.Debugf("No role binding for subject %s", subject)
+		return roles, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return append(roles, binding.Roles...), nil
+}
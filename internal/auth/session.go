@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	MethodSession		= "session"
+	sessionTokenPrefix	= "sas_"
+	sessionTokenBytes	= 32
+	DefaultSessionTTL	= 12 * time.Hour
+)
+
+// dummyPasswordHash is compared against when admin doesn't exist,
+// so login takes the same time for existing and non-existing admins
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func CheckPassword(passwordHash string, password string) bool {
+	if passwordHash == "" {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) == nil
+}
+
+func RandomToken(size int) (string, error) {
+	tokenBytes := make([]byte, size)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+func NewSessionToken() (string, error) {
+	token, err := RandomToken(sessionTokenBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return sessionTokenPrefix + token, nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type SessionAuthenticator struct {
+	storage	storage.Storage
+}
+
+func NewSessionAuthenticator(storage storage.Storage) *SessionAuthenticator {
+	return &SessionAuthenticator{storage: storage}
+}
+
+func (a *SessionAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if !strings.HasPrefix(token, sessionTokenPrefix) {
+		return nil, ErrUnknownCredentials
+	}
+
+	session, err := a.storage.GetSessionByTokenHash(ctx, HashToken(token))
+	if err == mongo.ErrNoDocuments {
+		log.Warning("Session token not found in db")
+		return nil, ErrInvalidCredentials
+	} else if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrBackendUnavailable, err)
+	}
+
+	if !session.IsValid(time.Now()) {
+		log.Warningf("Session %s of admin %s is expired or revoked", session.Id, session.Login)
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Principal{Subject: session.Login, Method: MethodSession, SessionId: session.Id}, nil
+}
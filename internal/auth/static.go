@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+type staticToken struct {
+	subject	string
+	token	[]byte
+}
+
+type StaticTokenAuthenticator struct {
+	tokens	[]staticToken
+}
+
+func NewStaticTokenAuthenticator(tokens []string) (*StaticTokenAuthenticator, error) {
+	/*
+	Tokens are configured as "subject:token" pairs,
+	subject identifies the caller in logs and access checks.
+	*/
+
+	authenticator := &StaticTokenAuthenticator{}
+	for _, pair := range tokens {
+		subject, token, ok := strings.Cut(pair, ":")
+		if !ok || subject == "" || token == "" {
+			return nil, fmt.Errorf("static token must be in subject:token format")
+		}
+		authenticator.tokens = append(authenticator.tokens, staticToken{subject: subject, token: []byte(token)})
+	}
+
+	return authenticator, nil
+}
+
+func (a *StaticTokenAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	var principal *Principal
+	for _, staticToken := range a.tokens {
+		if subtle.ConstantTimeCompare(staticToken.token, []byte(token)) == 1 {
+			principal = &Principal{Subject: staticToken.subject, Method: MethodStaticToken}
+		}
+	}
+
+	if principal == nil {
+		return nil, ErrUnknownCredentials
+	}
+
+	return principal, nil
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/xavesen/search-admin/internal/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type Throttle struct {
+	storage		storage.Storage
+	maxFailures	int
+	window		time.Duration
+}
+
+func NewThrottle(storage storage.Storage, maxFailures int, window time.Duration) *Throttle {
+	/*
+	Failures are counted in db, so every server instance
+	shares the same maxFailures budget of a key.
+	*/
+
+	return &Throttle{
+		storage: 		storage,
+		maxFailures: 	maxFailures,
+		window: 		window,
+	}
+}
+
+func (t *Throttle) Allow(ctx context.Context, key string, now time.Time) (bool, time.Duration, error) {
+	/*
+	Returns false and time left until attempts are allowed again
+	once key has failed maxFailures times within the window.
+	*/
+
+	failure, err := t.storage.GetLoginFailure(ctx, key)
+	if err == mongo.ErrNoDocuments {
+		return true, 0, nil
+	} else if err != nil {
+		return false, 0, err
+	}
+	if !now.Before(failure.ResetAt) || failure.Count < t.maxFailures {
+		return true, 0, nil
+	}
+
+	return false, failure.ResetAt.Sub(now), nil
+}
+
+func (t *Throttle) Fail(ctx context.Context, key string, now time.Time) error {
+	return t.storage.RecordLoginFailure(ctx, key, now, now.Add(t.window))
+}
+
+func (t *Throttle) Reset(ctx context.Context, key string) error {
+	return t.storage.DeleteLoginFailure(ctx, key)
+}
@@ -1,17 +1,100 @@
 package config
 
 import (
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	DefaultLoginMinLength		= 3
+	DefaultLoginMaxLength		= 64
+	DefaultIndexNameMaxLength	= 255
+	DefaultIndexLimitMax		= 100
+
+	DefaultPasswordMaxFailures		= 5
+	DefaultPasswordFailureWindow	= 15 * time.Minute
+)
+
+// DefaultLegacyAPISunset is when unversioned aliases of /v1 are removed unless LEGACY_API_SUNSET is set
+var DefaultLegacyAPISunset = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+
+// timeKeys are parsed on their own rather than by a decode hook, so other keys are decoded as before
+var timeKeys = []string{"LEGACY_API_DEPRECATED_AT", "LEGACY_API_SUNSET"}
+
 type Config struct {
-	DbAddr		string		`mapstructure:"DB_ADDR"`
-	ListenAddr	string		`mapstructure:"LISTEN_ADDR"`
-	Db			string		`mapstructure:"DB"`
-	DbUser		string		`mapstructure:"DB_USER"`
-	DbPass		string		`mapstructure:"DB_PASSWORD"`
-	LogLevel	log.Level	`mapstructure:"LOG_LEVEL"`
+	DbAddr						string			`mapstructure:"DB_ADDR"`
+	ListenAddr					string			`mapstructure:"LISTEN_ADDR"`
+	Db							string			`mapstructure:"DB"`
+	DbUser						string			`mapstructure:"DB_USER"`
+	DbPass						string			`mapstructure:"DB_PASSWORD"`
+	LogLevel					log.Level		`mapstructure:"LOG_LEVEL"`
+
+	AuthDisabled				bool			`mapstructure:"AUTH_DISABLED"`
+	AuthTokens					[]string		`mapstructure:"AUTH_TOKENS"`
+	AuthJWTSecret				string			`mapstructure:"AUTH_JWT_SECRET"`
+	AuthJWTIssuer				string			`mapstructure:"AUTH_JWT_ISSUER"`
+	AuthJWTAudience				string			`mapstructure:"AUTH_JWT_AUDIENCE"`
+	Superadmins					[]string		`mapstructure:"SUPERADMINS"`
+	SessionTTL					time.Duration	`mapstructure:"SESSION_TTL"`
+	PasswordMaxFailures			int				`mapstructure:"PASSWORD_MAX_FAILURES"`
+	PasswordFailureWindow		time.Duration	`mapstructure:"PASSWORD_FAILURE_WINDOW"`
+
+	OIDCIssuer					string			`mapstructure:"OIDC_ISSUER"`
+	OIDCClientId				string			`mapstructure:"OIDC_CLIENT_ID"`
+	OIDCClientSecret			string			`mapstructure:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL				string			`mapstructure:"OIDC_REDIRECT_URL"`
+	OIDCScopes					[]string		`mapstructure:"OIDC_SCOPES"`
+	OIDCSubjectClaim			string			`mapstructure:"OIDC_SUBJECT_CLAIM"`
+	OIDCGroupsClaim				string			`mapstructure:"OIDC_GROUPS_CLAIM"`
+	OIDCGroupRoles				[]string		`mapstructure:"OIDC_GROUP_ROLES"`
+	OIDCJWKSCacheTTL			time.Duration	`mapstructure:"OIDC_JWKS_CACHE_TTL"`
+
+	TokenEncryptionKey			string			`mapstructure:"TOKEN_ENCRYPTION_KEY"`
+	TokenSigningAlgorithm		string			`mapstructure:"TOKEN_SIGNING_ALGORITHM"`
+	TokenIssuer					string			`mapstructure:"TOKEN_ISSUER"`
+	TokenAudience				string			`mapstructure:"TOKEN_AUDIENCE"`
+	TokenTTL					time.Duration	`mapstructure:"TOKEN_TTL"`
+	TokenKeyRotationInterval	time.Duration	`mapstructure:"TOKEN_KEY_ROTATION_INTERVAL"`
+
+	EvaluateFields				[]string		`mapstructure:"EVALUATE_FIELDS"`
+
+	FilterSweepInterval			time.Duration	`mapstructure:"FILTER_SWEEP_INTERVAL"`
+
+	TrashRetention				time.Duration	`mapstructure:"TRASH_RETENTION"`
+	TrashPurgeInterval			time.Duration	`mapstructure:"TRASH_PURGE_INTERVAL"`
+
+	WebhookDeliveryInterval		time.Duration	`mapstructure:"WEBHOOK_DELIVERY_INTERVAL"`
+	WebhookMaxAttempts			int				`mapstructure:"WEBHOOK_MAX_ATTEMPTS"`
+	WebhookRetryBackoff			time.Duration	`mapstructure:"WEBHOOK_RETRY_BACKOFF"`
+	WebhookTimeout				time.Duration	`mapstructure:"WEBHOOK_TIMEOUT"`
+
+	OutboxRelayInterval			time.Duration	`mapstructure:"OUTBOX_RELAY_INTERVAL"`
+	OutboxRetryBackoff			time.Duration	`mapstructure:"OUTBOX_RETRY_BACKOFF"`
+	OutboxHTTPURL				string			`mapstructure:"OUTBOX_HTTP_URL"`
+	OutboxHTTPTimeout			time.Duration	`mapstructure:"OUTBOX_HTTP_TIMEOUT"`
+	OutboxFilePath				string			`mapstructure:"OUTBOX_FILE_PATH"`
+
+	EventsPollInterval			time.Duration	`mapstructure:"EVENTS_POLL_INTERVAL"`
+	EventsBufferSize			int				`mapstructure:"EVENTS_BUFFER_SIZE"`
+	EventsHeartbeatInterval		time.Duration	`mapstructure:"EVENTS_HEARTBEAT_INTERVAL"`
+
+	LegacyAPIDeprecatedAt		time.Time		`mapstructure:"-"`
+	LegacyAPISunset				time.Time		`mapstructure:"-"`
+
+	LoginMinLength				int				`mapstructure:"LOGIN_MIN_LENGTH"`
+	LoginMaxLength				int				`mapstructure:"LOGIN_MAX_LENGTH"`
+	IndexNameMaxLength			int				`mapstructure:"INDEX_NAME_MAX_LENGTH"`
+	IndexLimitMax				int				`mapstructure:"INDEX_LIMIT_MAX"`
+
+	IdempotencyKeyTTL			time.Duration	`mapstructure:"IDEMPOTENCY_KEY_TTL"`
+
+	BulkMaxOperations			int				`mapstructure:"BULK_MAX_OPERATIONS"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -19,16 +102,152 @@ func LoadConfig() (*Config, error) {
 	var config Config
 
 	viper.AutomaticEnv()
+	if err := bindEnv(); err != nil {
+		log.Errorf("Error binding environment variables: %s", err.Error())
+		return nil, err
+	}
+	viper.SetDefault("FILTER_SWEEP_INTERVAL", time.Minute)
+	viper.SetDefault("SESSION_TTL", 12 * time.Hour)
+	viper.SetDefault("PASSWORD_MAX_FAILURES", DefaultPasswordMaxFailures)
+	viper.SetDefault("PASSWORD_FAILURE_WINDOW", DefaultPasswordFailureWindow)
+	viper.SetDefault("OIDC_SUBJECT_CLAIM", "sub")
+	viper.SetDefault("OIDC_GROUPS_CLAIM", "groups")
+	viper.SetDefault("OIDC_JWKS_CACHE_TTL", time.Hour)
+	viper.SetDefault("TOKEN_SIGNING_ALGORITHM", "EdDSA")
+	viper.SetDefault("TOKEN_ISSUER", "search-admin")
+	viper.SetDefault("TOKEN_TTL", 15 * time.Minute)
+	viper.SetDefault("TOKEN_KEY_ROTATION_INTERVAL", 24 * time.Hour)
+	viper.SetDefault("TRASH_RETENTION", 30 * 24 * time.Hour)
+	viper.SetDefault("TRASH_PURGE_INTERVAL", time.Hour)
+	viper.SetDefault("WEBHOOK_DELIVERY_INTERVAL", 5 * time.Second)
+	viper.SetDefault("WEBHOOK_MAX_ATTEMPTS", 10)
+	viper.SetDefault("WEBHOOK_RETRY_BACKOFF", 30 * time.Second)
+	viper.SetDefault("WEBHOOK_TIMEOUT", 10 * time.Second)
+	viper.SetDefault("OUTBOX_RELAY_INTERVAL", time.Second)
+	viper.SetDefault("OUTBOX_RETRY_BACKOFF", 5 * time.Second)
+	viper.SetDefault("OUTBOX_HTTP_TIMEOUT", 10 * time.Second)
+	viper.SetDefault("EVENTS_POLL_INTERVAL", time.Second)
+	viper.SetDefault("EVENTS_BUFFER_SIZE", 1000)
+	viper.SetDefault("EVENTS_HEARTBEAT_INTERVAL", 15 * time.Second)
+	viper.SetDefault("LOGIN_MIN_LENGTH", DefaultLoginMinLength)
+	viper.SetDefault("LOGIN_MAX_LENGTH", DefaultLoginMaxLength)
+	viper.SetDefault("INDEX_NAME_MAX_LENGTH", DefaultIndexNameMaxLength)
+	viper.SetDefault("INDEX_LIMIT_MAX", DefaultIndexLimitMax)
+	viper.SetDefault("IDEMPOTENCY_KEY_TTL", 24 * time.Hour)
+	viper.SetDefault("BULK_MAX_OPERATIONS", 1000)
 
 	log.Info("Parsing environment variables to config struct")
-	if err := viper.Unmarshal(&config); err != nil {
+	decodeHook := viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))
+	if err := viper.Unmarshal(&config, decodeHook); err != nil {
 		log.Errorf("Error parsing environment variables to config struct: %s", err.Error())
 		return nil, err
 	}
 
+	var err error
+	if config.LegacyAPIDeprecatedAt, err = parseTime("LEGACY_API_DEPRECATED_AT"); err != nil {
+		return nil, err
+	}
+	if config.LegacyAPISunset, err = parseTime("LEGACY_API_SUNSET"); err != nil {
+		return nil, err
+	}
+	if config.LegacyAPISunset.IsZero() {
+		config.LegacyAPISunset = DefaultLegacyAPISunset
+	}
+	if !config.LegacyAPIDeprecatedAt.IsZero() && !config.LegacyAPIDeprecatedAt.Before(config.LegacyAPISunset) {
+		log.Error("LEGACY_API_DEPRECATED_AT must be before LEGACY_API_SUNSET")
+		return nil, errors.New("invalid legacy api dates")
+	}
+
+	if !config.AuthDisabled && len(config.AuthTokens) == 0 && config.AuthJWTSecret == "" && config.OIDCIssuer == "" {
+		log.Error("No authentication method configured, set AUTH_TOKENS, AUTH_JWT_SECRET or OIDC_ISSUER, or AUTH_DISABLED=true to run without authentication")
+		return nil, errors.New("no authentication method configured")
+	}
+
+	for _, pair := range config.AuthTokens {
+		if subject, token, ok := strings.Cut(pair, ":"); !ok || subject == "" || token == "" {
+			log.Error("Error parsing AUTH_TOKENS: every token must be in subject:token format")
+			return nil, errors.New("invalid AUTH_TOKENS format")
+		}
+	}
+
+	if config.OIDCIssuer != "" && config.OIDCClientId == "" {
+		log.Error("OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+		return nil, errors.New("oidc client id is not configured")
+	}
+
+	if config.LoginMinLength > config.LoginMaxLength {
+		log.Error("LOGIN_MIN_LENGTH must not be greater than LOGIN_MAX_LENGTH")
+		return nil, errors.New("invalid login length bounds")
+	}
+
+	/*
+	Background jobs tick at these intervals, a ticker can't be
+	created with a non positive one.
+	*/
+	jobIntervals := []struct {
+		key			string
+		interval	time.Duration
+	}{
+		{"FILTER_SWEEP_INTERVAL", config.FilterSweepInterval},
+		{"TRASH_PURGE_INTERVAL", config.TrashPurgeInterval},
+		{"WEBHOOK_DELIVERY_INTERVAL", config.WebhookDeliveryInterval},
+		{"OUTBOX_RELAY_INTERVAL", config.OutboxRelayInterval},
+	}
+	for _, job := range jobIntervals {
+		if job.interval <= 0 {
+			log.Errorf("%s must be greater than zero", job.key)
+			return nil, errors.New("invalid background job interval")
+		}
+	}
+
 	log.Infof("Setting log level to %s", config.LogLevel.String())
 	log.SetLevel(config.LogLevel)
 
 	log.Info("Successfully loaded config from environment")
 	return &config, nil
-}
\ No newline at end of file
+}
+
+func bindEnv() error {
+	/*
+	Automatic env only resolves keys viper already knows about, so keys
+	without a default would never be read by unmarshal unless bound explicitly.
+	*/
+
+	configType := reflect.TypeOf(Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		if key := configType.Field(i).Tag.Get("mapstructure"); key != "" && key != "-" {
+			if err := viper.BindEnv(key); err != nil {
+				return err
+			}
+		}
+	}
+	for _, key := range timeKeys {
+		if err := viper.BindEnv(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseTime(key string) (time.Time, error) {
+	/*
+	Unset timestamps are left zero, meaning the moment is not configured.
+	*/
+
+	value := viper.GetString(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Errorf("Error parsing %s, it must be a RFC3339 timestamp: %s", key, err.Error())
+		return time.Time{}, err
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/magiconair/properties/assert"
+)
+
+var loadConfigTests = []struct {
+	testName		string
+	env				map[string]string
+	expectedErr		bool
+	check			func(t *testing.T, config *Config)
+}{
+	{
+		testName: "Load auth settings without defaults from env",
+		env: map[string]string{
+			"DB_ADDR": "mongodb://db:27017",
+			"AUTH_TOKENS": "bot-a:secret-a,bot-b:secret-b",
+			"AUTH_JWT_SECRET": "jwt-secret",
+			"SUPERADMINS": "token:bot-a,jwt:alice",
+		},
+		check: func(t *testing.T, config *Config) {
+			assert.Equal(t, config.DbAddr, "mongodb://db:27017", "wrong db address")
+			assert.Equal(t, config.AuthTokens, []string{"bot-a:secret-a", "bot-b:secret-b"}, "wrong auth tokens")
+			assert.Equal(t, config.AuthJWTSecret, "jwt-secret", "wrong jwt secret")
+			assert.Equal(t, config.Superadmins, []string{"token:bot-a", "jwt:alice"}, "wrong superadmins")
+		},
+	},
+	{
+		testName: "Load oidc, token, outbox and evaluation settings from env",
+		env: map[string]string{
+			"OIDC_ISSUER": "https://issuer.example.com",
+			"OIDC_CLIENT_ID": "search-admin",
+			"OIDC_CLIENT_SECRET": "client-secret",
+			"OIDC_REDIRECT_URL": "https://admin.example.com/oidc/callback",
+			"OIDC_SCOPES": "openid,email",
+			"OIDC_GROUP_ROLES": "ops:admin",
+			"TOKEN_ENCRYPTION_KEY": "encryption-key",
+			"TOKEN_AUDIENCE": "search",
+			"OUTBOX_HTTP_URL": "https://events.example.com",
+			"OUTBOX_FILE_PATH": "/var/lib/outbox.jsonl",
+			"EVALUATE_FIELDS": "title,body",
+			"FILTER_SWEEP_INTERVAL": "5m",
+		},
+		check: func(t *testing.T, config *Config) {
+			assert.Equal(t, config.OIDCIssuer, "https://issuer.example.com", "wrong oidc issuer")
+			assert.Equal(t, config.OIDCClientId, "search-admin", "wrong oidc client id")
+			assert.Equal(t, config.OIDCClientSecret, "client-secret", "wrong oidc client secret")
+			assert.Equal(t, config.OIDCRedirectURL, "https://admin.example.com/oidc/callback", "wrong oidc redirect url")
+			assert.Equal(t, config.OIDCScopes, []string{"openid", "email"}, "wrong oidc scopes")
+			assert.Equal(t, config.OIDCGroupRoles, []string{"ops:admin"}, "wrong oidc group roles")
+			assert.Equal(t, config.OIDCSubjectClaim, "sub", "wrong default oidc subject claim")
+			assert.Equal(t, config.TokenEncryptionKey, "encryption-key", "wrong token encryption key")
+			assert.Equal(t, config.TokenAudience, "search", "wrong token audience")
+			assert.Equal(t, config.OutboxHTTPURL, "https://events.example.com", "wrong outbox http url")
+			assert.Equal(t, config.OutboxFilePath, "/var/lib/outbox.jsonl", "wrong outbox file path")
+			assert.Equal(t, config.EvaluateFields, []string{"title", "body"}, "wrong evaluate fields")
+			assert.Equal(t, config.FilterSweepInterval, 5 * time.Minute, "wrong filter sweep interval")
+		},
+	},
+	{
+		testName: "Load config with authentication disabled",
+		env: map[string]string{
+			"AUTH_DISABLED": "true",
+		},
+		check: func(t *testing.T, config *Config) {
+			assert.Equal(t, config.AuthDisabled, true, "authentication is not disabled")
+			assert.Equal(t, len(config.AuthTokens), 0, "unexpected auth tokens")
+		},
+	},
+	{
+		testName: "Leave legacy api deprecation date unset and default sunset",
+		env: map[string]string{
+			"AUTH_DISABLED": "true",
+		},
+		check: func(t *testing.T, config *Config) {
+			assert.Equal(t, config.LegacyAPIDeprecatedAt.IsZero(), true, "legacy api deprecation date is set")
+			assert.Equal(t, config.LegacyAPISunset, DefaultLegacyAPISunset, "wrong default legacy api sunset")
+		},
+	},
+	{
+		testName: "Load legacy api dates from env",
+		env: map[string]string{
+			"AUTH_DISABLED": "true",
+			"LEGACY_API_DEPRECATED_AT": "2026-10-19T00:00:00Z",
+			"LEGACY_API_SUNSET": "2027-04-19T00:00:00Z",
+		},
+		check: func(t *testing.T, config *Config) {
+			assert.Equal(t, config.LegacyAPIDeprecatedAt, time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC), "wrong legacy api deprecation date")
+			assert.Equal(t, config.LegacyAPISunset, time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC), "wrong legacy api sunset")
+		},
+	},
+	{
+		testName: "Return error when legacy api is deprecated after its sunset",
+		env: map[string]string{
+			"AUTH_DISABLED": "true",
+			"LEGACY_API_DEPRECATED_AT": "2027-10-19T00:00:00Z",
+		},
+		expectedErr: true,
+	},
+	{
+		testName: "Return error on malformed legacy api date",
+		env: map[string]string{
+			"AUTH_DISABLED": "true",
+			"LEGACY_API_SUNSET": "next spring",
+		},
+		expectedErr: true,
+	},
+	{
+		testName: "Return error on non positive background job interval",
+		env: map[string]string{
+			"AUTH_DISABLED": "true",
+			"TRASH_PURGE_INTERVAL": "0s",
+		},
+		expectedErr: true,
+	},
+	{
+		testName: "Return error when no authentication method is configured",
+		env: map[string]string{},
+		expectedErr: true,
+	},
+	{
+		testName: "Return error on malformed auth tokens",
+		env: map[string]string{
+			"AUTH_TOKENS": "secret-without-subject",
+		},
+		expectedErr: true,
+	},
+}
+
+func TestLoadConfig(t *testing.T) {
+	/*
+	Every test starts from a clean environment for all config keys,
+	so values set by the machine running tests don't leak into them.
+	*/
+
+	configType := reflect.TypeOf(Config{})
+	for _, test := range loadConfigTests {
+		t.Run(test.testName, func(t *testing.T) {
+			for i := 0; i < configType.NumField(); i++ {
+				if key := configType.Field(i).Tag.Get("mapstructure"); key != "-" {
+					t.Setenv(key, "")
+				}
+			}
+			for _, key := range timeKeys {
+				t.Setenv(key, "")
+			}
+			for key, value := range test.env {
+				t.Setenv(key, value)
+			}
+
+			config, err := LoadConfig()
+			if test.expectedErr {
+				assert.Equal(t, err != nil, true, "expected error")
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unable to load config, error: %s\n", err)
+			}
+
+			test.check(t, config)
+		})
+	}
+}
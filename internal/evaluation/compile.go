@@ -0,0 +1,75 @@
+package evaluation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/xavesen/search-admin/internal/models"
+)
+
+type CompiledFilter struct {
+	Id					string		`json:"id"`
+	Regex				string		`json:"regex"`
+	Fields				[]string	`json:"fields"`
+	Action				string		`json:"action"`
+	Tag					string		`json:"tag,omitempty"`
+	Replacement			string		`json:"replacement,omitempty"`
+	Priority			int			`json:"priority"`
+	StopProcessing		bool		`json:"stop_processing"`
+	Mode				string		`json:"mode"`
+	RolloutPercentage	int			`json:"rollout_percentage"`
+}
+
+type CompiledSet struct {
+	Version		string				`json:"version"`
+	Rollout		RolloutSpec			`json:"rollout"`
+	Filters		[]CompiledFilter	`json:"filters"`
+}
+
+func Compile(filters []models.Filter, defaultFields []string) CompiledSet {
+	/*
+	Compiled set contains filters in the order they must be applied
+	with all defaults resolved, so consumers don't need to know them.
+	Version changes whenever anything in the compiled filters changes.
+	*/
+
+	compiled := []CompiledFilter{}
+	for _, filter := range Order(filters) {
+		fields := filter.Fields
+		if len(fields) == 0 {
+			fields = defaultFields
+		}
+		if fields == nil {
+			fields = []string{}
+		}
+
+		compiledFilter := CompiledFilter{
+			Id: 				filter.Id,
+			Regex: 				filter.Regex,
+			Fields: 			fields,
+			Action: 			filter.EffectiveAction(),
+			Priority: 			filter.Priority,
+			StopProcessing: 	filter.StopProcessing,
+			Mode: 				filter.EffectiveMode(),
+			RolloutPercentage: 	filter.EffectiveRolloutPercentage(),
+		}
+		switch compiledFilter.Action {
+		case models.FilterActionTag:
+			compiledFilter.Tag = filter.EffectiveTag()
+		case models.FilterActionRedact:
+			compiledFilter.Replacement = filter.EffectiveReplacement()
+		}
+
+		compiled = append(compiled, compiledFilter)
+	}
+
+	compiledJson, _ := json.Marshal(compiled)
+	sum := sha256.Sum256(compiledJson)
+
+	return CompiledSet{
+		Version: 	hex.EncodeToString(sum[:8]),
+		Rollout: 	NewRolloutSpec(),
+		Filters: 	compiled,
+	}
+}
@@ -0,0 +1,202 @@
+package evaluation
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+)
+
+const ActionNone = "none"
+
+var ErrInvalidRegex = errors.New("enforced filter has invalid regex")
+
+var actionSeverity = map[string]int{
+	ActionNone:					0,
+	models.FilterActionTag:		1,
+	models.FilterActionRedact:	2,
+	models.FilterActionBlock:	3,
+}
+
+type Match struct {
+	FilterId	string		`json:"filter_id"`
+	Action		string		`json:"action"`
+	Matches		[]string	`json:"matches"`
+	Shadow		bool		`json:"shadow,omitempty"`
+}
+
+type Result struct {
+	Action		string				`json:"action"`
+	Matches		map[string][]Match	`json:"matches"`
+	Tags		[]string			`json:"tags"`
+	Document	map[string]any		`json:"document"`
+	Skipped		[]string			`json:"skipped_filters,omitempty"`
+}
+
+func Order(filters []models.Filter) []models.Filter {
+	/*
+	Filters with higher priority are applied first,
+	filters with equal priority keep the order they are stored in.
+	*/
+
+	ordered := make([]models.Filter, len(filters))
+	copy(ordered, filters)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority > ordered[j].Priority
+	})
+
+	return ordered
+}
+
+func Evaluate(filters []models.Filter, document map[string]any, documentKey string, defaultFields []string) (*Result, error) {
+	/*
+	Shadow filters report their matches but never change the document,
+	the resulting action or stop processing. Filters with partial rollout
+	are only applied to documents whose bucket falls into the rollout.
+	Shadow and tagging filters with invalid regex are skipped and reported,
+	so one broken filter doesn't stop the others from being applied. Block
+	and redact filters in enforce mode fail evaluation instead, skipping
+	them would let through documents they are meant to stop.
+	*/
+
+	if documentKey == "" {
+		documentKey = DocumentKey(document)
+	}
+
+	result := &Result{
+		Action: 	ActionNone,
+		Matches: 	map[string][]Match{},
+		Tags:		[]string{},
+		Document: 	document,
+	}
+
+	for _, filter := range Order(filters) {
+		if !InRollout(&filter, documentKey) {
+			log.Debugf("Document %s is outside of rollout of filter %s", documentKey, filter.Id)
+			continue
+		}
+
+		action := filter.EffectiveAction()
+		shadow := filter.EffectiveMode() == models.FilterModeShadow
+		matched := false
+
+		re, err := regexp.Compile(filter.Regex)
+		if err != nil && !shadow && action != models.FilterActionTag {
+			log.Errorf("Error compiling regex of enforced filter %s: %s", filter.String(), err)
+			return nil, fmt.Errorf("%w: filter %s: %s", ErrInvalidRegex, filter.Id, err)
+		} else if err != nil {
+			log.Errorf("Error compiling regex of filter %s, skipping it: %s", filter.String(), err)
+			result.Skipped = append(result.Skipped, filter.Id)
+			continue
+		}
+
+		apply := func(path string, value string) string {
+			found := re.FindAllString(value, -1)
+			if len(found) == 0 {
+				return value
+			}
+
+			matched = true
+			result.Matches[path] = append(result.Matches[path], Match{
+				FilterId: 	filter.Id,
+				Action: 	action,
+				Matches: 	found,
+				Shadow: 	shadow,
+			})
+
+			if action == models.FilterActionRedact && !shadow {
+				return re.ReplaceAllLiteralString(value, filter.EffectiveReplacement())
+			}
+			return value
+		}
+
+		fields := filter.Fields
+		if len(fields) == 0 {
+			fields = defaultFields
+		}
+
+		if len(fields) == 0 {
+			applyAll(document, "", apply)
+		} else {
+			for _, field := range fields {
+				applyPath(document, strings.Split(field, "."), "", apply)
+			}
+		}
+
+		if !matched || shadow {
+			continue
+		}
+
+		if action == models.FilterActionTag {
+			result.Tags = append(result.Tags, filter.EffectiveTag())
+		}
+		if actionSeverity[action] > actionSeverity[result.Action] {
+			result.Action = action
+		}
+
+		if filter.StopProcessing {
+			log.Debugf("Filter %s matched and stops processing", filter.Id)
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+func applyPath(value any, parts []string, path string, apply func(string, string) string) any {
+	switch v := value.(type) {
+	case string:
+		if len(parts) == 0 {
+			return apply(path, v)
+		}
+	case []any:
+		for i := range v {
+			v[i] = applyPath(v[i], parts, joinPath(path, strconv.Itoa(i)), apply)
+		}
+	case map[string]any:
+		if len(parts) == 0 {
+			break
+		}
+		if child, ok := v[parts[0]]; ok {
+			v[parts[0]] = applyPath(child, parts[1:], joinPath(path, parts[0]), apply)
+		}
+	}
+
+	return value
+}
+
+func applyAll(value any, path string, apply func(string, string) string) any {
+	switch v := value.(type) {
+	case string:
+		return apply(path, v)
+	case []any:
+		for i := range v {
+			v[i] = applyAll(v[i], joinPath(path, strconv.Itoa(i)), apply)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			v[key] = applyAll(v[key], joinPath(path, key), apply)
+		}
+	}
+
+	return value
+}
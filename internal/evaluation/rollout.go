@@ -0,0 +1,68 @@
+package evaluation
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+
+	"github.com/xavesen/search-admin/internal/models"
+)
+
+const (
+	RolloutHashAlgorithm	= "fnv1a-32"
+	RolloutHashInput		= "<filter_id>:<document_key>"
+	RolloutBuckets			= 100
+	RolloutDocumentKey		= "document_key if provided, otherwise hex sha256 of the compact document JSON with sorted keys and unescaped <, > and &"
+)
+
+type RolloutSpec struct {
+	Algorithm	string	`json:"algorithm"`
+	Input		string	`json:"input"`
+	Buckets		int		`json:"buckets"`
+	DocumentKey	string	`json:"document_key"`
+}
+
+func NewRolloutSpec() RolloutSpec {
+	return RolloutSpec{
+		Algorithm: 		RolloutHashAlgorithm,
+		Input: 			RolloutHashInput,
+		Buckets: 		RolloutBuckets,
+		DocumentKey: 	RolloutDocumentKey,
+	}
+}
+
+func DocumentKey(document map[string]any) string {
+	/*
+	Canonical form of the document is compact JSON with object
+	keys sorted at every level, as encoding/json sorts map keys,
+	so field order doesn't change the key. HTML escaping is off,
+	<, > and & are kept as is like other JSON encoders do, so
+	consumers can compute the same key without Go quirks.
+	*/
+
+	var documentJson bytes.Buffer
+	encoder := json.NewEncoder(&documentJson)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(document)
+	sum := sha256.Sum256(bytes.TrimSuffix(documentJson.Bytes(), []byte("\n")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func RolloutBucket(filterId string, documentKey string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(filterId + ":" + documentKey))
+
+	return int(hash.Sum32() % RolloutBuckets)
+}
+
+func InRollout(filter *models.Filter, documentKey string) bool {
+	percentage := filter.EffectiveRolloutPercentage()
+	if percentage >= RolloutBuckets {
+		return true
+	}
+
+	return RolloutBucket(filter.Id, documentKey) < percentage
+}
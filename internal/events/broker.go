@@ -0,0 +1,240 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	cfg "github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+)
+
+const (
+	defaultPollInterval	= time.Second
+	defaultBufferSize	= 1000
+	subscriberBuffer	= 64
+	pollBatch			= 1000
+)
+
+// Subscription receives changes in sequence order,
+// channel is closed when subscriber falls behind or broker is closed
+type Subscription struct {
+	Changes	<-chan models.ChangeRecord
+	changes	chan models.ChangeRecord
+}
+
+type Broker struct {
+	storage			storage.Storage
+	pollInterval	time.Duration
+	bufferSize		int
+
+	startOnce		sync.Once
+	cancel			context.CancelFunc
+	mu				sync.Mutex
+	started			chan struct{}
+	closed			bool
+	buffer			[]models.ChangeRecord
+	lastSeq			int64
+	subscribers		map[*Subscription]struct{}
+}
+
+func NewBroker(storage storage.Storage, pollInterval time.Duration, bufferSize int) *Broker {
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	if bufferSize <= 0 {
+		bufferSize = defaultBufferSize
+	}
+
+	return &Broker{
+		storage:		storage,
+		pollInterval:	pollInterval,
+		bufferSize:		bufferSize,
+		started:		make(chan struct{}),
+		subscribers:	map[*Subscription]struct{}{},
+	}
+}
+
+func NewBrokerFromConfig(storage storage.Storage, config *cfg.Config) *Broker {
+	return NewBroker(storage, config.EventsPollInterval, config.EventsBufferSize)
+}
+
+func (b *Broker) start() {
+	/*
+	Broker follows the change feed instead of being notified by handlers,
+	so changes made through other instances are streamed as well.
+	Polling starts with the first subscriber.
+	*/
+
+	b.startOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			cancel()
+			close(b.started)
+			return
+		}
+		b.cancel = cancel
+		b.mu.Unlock()
+
+		recent, err := b.storage.GetRecentChanges(ctx, int64(b.bufferSize))
+		if err != nil {
+			log.Errorf("Error priming event stream buffer: %s", err)
+		}
+		b.mu.Lock()
+		b.buffer = recent
+		if len(recent) > 0 {
+			b.lastSeq = recent[len(recent) - 1].Seq
+		}
+		b.mu.Unlock()
+		close(b.started)
+
+		go b.run(ctx)
+	})
+	<-b.started
+}
+
+func (b *Broker) run(ctx context.Context) {
+	log.Infof("Starting event stream broker with poll interval %s", b.pollInterval)
+	ticker := time.NewTicker(b.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("Stopping event stream broker")
+			return
+		case <-ticker.C:
+		}
+
+		if err := b.poll(ctx); err != nil && ctx.Err() == nil {
+			log.Errorf("Error polling changes for event stream: %s", err)
+		}
+	}
+}
+
+func (b *Broker) poll(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		since := b.lastSeq
+		b.mu.Unlock()
+
+		changes, err := b.storage.GetChanges(ctx, since, pollBatch)
+		if errors.Is(err, storage.ErrChangesCursorExpired) {
+			/*
+			All kept changes are after the expired cursor,
+			so streaming goes on from the oldest of them.
+			*/
+			log.Warningf("Changes after %d expired before being streamed, streaming from the oldest kept change", since)
+			changes, err = b.storage.GetChanges(ctx, 0, pollBatch)
+		}
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		b.publish(changes)
+		if len(changes) < pollBatch {
+			return nil
+		}
+	}
+}
+
+func (b *Broker) publish(changes []models.ChangeRecord) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	b.buffer = append(b.buffer, changes...)
+	if len(b.buffer) > b.bufferSize {
+		b.buffer = append([]models.ChangeRecord{}, b.buffer[len(b.buffer) - b.bufferSize:]...)
+	}
+	b.lastSeq = changes[len(changes) - 1].Seq
+
+	for subscription := range b.subscribers {
+		for _, change := range changes {
+			select {
+			case subscription.changes <- change:
+			default:
+				/*
+				Slow subscriber is dropped instead of blocking everyone,
+				it can resume from its last event id on reconnect.
+				*/
+				log.Warning("Event stream subscriber fell behind, closing its stream")
+				delete(b.subscribers, subscription)
+				close(subscription.changes)
+			}
+			if _, ok := b.subscribers[subscription]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// Subscribe returns subscription and, when resuming, buffered changes
+// after lastSeq. Complete is false when some of them already left the buffer.
+func (b *Broker) Subscribe(lastSeq int64, resume bool) (subscription *Subscription, replay []models.ChangeRecord, complete bool) {
+	b.start()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	changes := make(chan models.ChangeRecord, subscriberBuffer)
+	subscription = &Subscription{Changes: changes, changes: changes}
+	if b.closed {
+		close(changes)
+		return subscription, nil, true
+	}
+	b.subscribers[subscription] = struct{}{}
+
+	if !resume {
+		return subscription, nil, true
+	}
+
+	replay = []models.ChangeRecord{}
+	for _, change := range b.buffer {
+		if change.Seq > lastSeq {
+			replay = append(replay, change)
+		}
+	}
+	complete = len(b.buffer) == 0 || lastSeq >= b.buffer[0].Seq - 1
+
+	return subscription, replay, complete
+}
+
+func (b *Broker) Unsubscribe(subscription *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[subscription]; ok {
+		delete(b.subscribers, subscription)
+		close(subscription.changes)
+	}
+}
+
+// Close stops polling and closes streams of all subscribers
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	if b.cancel != nil {
+		b.cancel()
+	}
+	for subscription := range b.subscribers {
+		delete(b.subscribers, subscription)
+		close(subscription.changes)
+	}
+}
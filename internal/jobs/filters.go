@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/storage"
+)
+
+func ArchiveExpiredFilters(storage storage.Storage) Job {
+	return func(ctx context.Context) error {
+		archived, err := storage.ArchiveExpiredFilters(ctx, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+
+		for _, filter := range archived {
+			log.WithFields(log.Fields{
+				"filter_id": filter.Id,
+				"active_until": filter.ActiveUntil,
+			}).Info("Filter expired and was archived")
+		}
+
+		return nil
+	}
+}
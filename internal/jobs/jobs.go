@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+type Job func(ctx context.Context) error
+
+func RunPeriodically(ctx context.Context, name string, interval time.Duration, job Job) {
+	/*
+	Job errors are only logged, the job is retried on the next tick.
+	Runner stops when the context is cancelled.
+	*/
+
+	log.Infof("Starting background job %s with interval %s", name, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(ctx); err != nil {
+			log.Errorf("Background job %s failed: %s", name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopping background job %s", name)
+			return
+		case <-ticker.C:
+		}
+	}
+}
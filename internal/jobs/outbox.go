@@ -0,0 +1,13 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/xavesen/search-admin/internal/outbox"
+)
+
+func RelayOutbox(relay *outbox.Relay) Job {
+	return func(ctx context.Context) error {
+		return relay.RelayDue(ctx)
+	}
+}
@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/storage"
+)
+
+func PurgeTrash(storage storage.Storage, retention time.Duration) Job {
+	return func(ctx context.Context) error {
+		before := time.Now().UTC().Add(-retention)
+		result, err := storage.PurgeDeleted(ctx, before)
+		if err != nil {
+			return err
+		}
+
+		if result.Users > 0 || result.Filters > 0 {
+			log.WithFields(log.Fields{
+				"users": result.Users,
+				"filters": result.Filters,
+				"deleted_before": before,
+			}).Info("Purged documents from trash")
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,13 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/xavesen/search-admin/internal/webhooks"
+)
+
+func DeliverWebhooks(dispatcher *webhooks.Dispatcher) Job {
+	return func(ctx context.Context) error {
+		return dispatcher.DeliverDue(ctx)
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+func Authentication(authenticator auth.Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fields := log.Fields{
+				"request_id": r.Context().Value(utils.ContextKeyReqId),
+				"method": r.Method,
+				"url_path": r.URL.Path,
+			}
+
+			scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+				log.WithFields(fields).Warning("Request without bearer token")
+				w.Header().Add("WWW-Authenticate", "Bearer")
+				utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Authentication required", nil)
+				return
+			}
+
+			principal, err := authenticator.Authenticate(r.Context(), token)
+			if errors.Is(err, auth.ErrIdentityProviderUnavailable) {
+				log.WithFields(fields).Errorf("Unable to check bearer token: %s", err)
+				utils.WriteJSON(w, r, http.StatusBadGateway, false, "Identity provider is unavailable", nil)
+				return
+			} else if errors.Is(err, auth.ErrBackendUnavailable) {
+				log.WithFields(fields).Errorf("Unable to check bearer token: %s", err)
+				utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+				return
+			} else if err != nil {
+				log.WithFields(fields).Warningf("Request with invalid bearer token: %s", err)
+				w.Header().Add("WWW-Authenticate", "Bearer error=\"invalid_token\"")
+				utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Invalid credentials", nil)
+				return
+			}
+
+			fields["subject"] = principal.Subject
+			fields["auth_method"] = principal.Method
+			log.WithFields(fields).Info("Authenticated request")
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+func Deprecation(deprecatedAt time.Time, sunset time.Time, successorPrefix string) mux.MiddlewareFunc {
+	/*
+	Deprecation header follows rfc 9745, its older draft form
+	without date is used when deprecation date is not configured.
+	Sunset header follows rfc 8594, sunset is always scheduled.
+	*/
+
+	deprecation := "true"
+	if !deprecatedAt.IsZero() {
+		deprecation = fmt.Sprintf("@%d", deprecatedAt.Unix())
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log.WithFields(log.Fields{
+				"request_id": r.Context().Value(utils.ContextKeyReqId),
+				"method": r.Method,
+				"url_path": r.URL.Path,
+			}).Info("Request to deprecated api path")
+
+			w.Header().Set("Deprecation", deprecation)
+			w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			w.Header().Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successorPrefix, r.URL.EscapedPath()))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/audit"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"github.com/xavesen/search-admin/internal/utils"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	IdempotencyKeyHeader		= "Idempotency-Key"
+	IdempotentReplayedHeader	= "Idempotent-Replayed"
+
+	ErrorCodeIdempotencyKeyReused	= "idempotency_key_reused"
+	ErrorCodeIdempotencyKeyInUse	= "idempotency_key_in_use"
+
+	defaultIdempotencyKeyTTL		= 24 * time.Hour
+	idempotencyLockTimeout			= time.Minute
+	idempotencyLockRenewInterval	= idempotencyLockTimeout / 3
+)
+
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	statusCode	int
+	body		bytes.Buffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	w.statusCode = statusCode
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func Idempotency(store storage.Storage, ttl time.Duration) func(http.Handler) http.Handler {
+	/*
+	Requests with Idempotency-Key header are handled once per key,
+	repeats get the stored response. Keys are scoped to the principal,
+	so clients can't replay responses of each other. Secrets are redacted
+	from responses before they are stored, replays carry *** in their place.
+	*/
+
+	if ttl <= 0 {
+		ttl = defaultIdempotencyKeyTTL
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			fields := log.Fields{
+				"request_id": r.Context().Value(utils.ContextKeyReqId),
+				"method": r.Method,
+				"url_path": r.URL.Path,
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				log.WithFields(fields).Errorf("Error reading request body: %s", err)
+				utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewBuffer(body))
+
+			subject := ""
+			if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+				subject = principal.QualifiedSubject()
+			}
+
+			/*
+			Record is locked only for a short time and the lock is renewed
+			while request is being handled, so a long request keeps the key
+			and a request interrupted by a crash doesn't hold it until it expires.
+			*/
+			now := time.Now().UTC()
+			record := &models.IdempotencyRecord{
+				Key: 			subject + ":" + key,
+				Fingerprint: 	requestFingerprint(r, body),
+				Status: 		models.IdempotencyStatusProcessing,
+				CreatedAt: 		now,
+				ExpiresAt: 		now.Add(idempotencyLockTimeout),
+			}
+
+			err = store.CreateIdempotencyRecord(r.Context(), record)
+			if errors.Is(err, storage.ErrDuplicateIdempotencyKey) {
+				replayResponse(w, r, store, record, fields)
+				return
+			} else if err != nil {
+				log.WithFields(fields).Errorf("Error storing idempotency key: %s", err)
+				utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+				return
+			}
+
+			stopRenewing := make(chan struct{})
+			renewingStopped := make(chan struct{})
+			go func() {
+				defer close(renewingStopped)
+				renewLock(store, record, stopRenewing, fields)
+			}()
+
+			recorder := &recordingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+
+			close(stopRenewing)
+			<-renewingStopped
+
+			/*
+			Server errors are not stored, key is released
+			so request can be retried with the same key.
+			*/
+			ctx := context.TODO()
+			if recorder.statusCode >= http.StatusInternalServerError {
+				if err := store.DeleteIdempotencyRecord(ctx, record); err != nil {
+					log.WithFields(fields).Errorf("Error releasing idempotency key: %s", err)
+				}
+				return
+			}
+
+			body, err = audit.RedactJSON(recorder.body.Bytes())
+			if err != nil {
+				log.WithFields(fields).Errorf("Error redacting response for idempotency key: %s", err)
+				if err := store.DeleteIdempotencyRecord(ctx, record); err != nil {
+					log.WithFields(fields).Errorf("Error releasing idempotency key: %s", err)
+				}
+				return
+			}
+
+			record.StatusCode = recorder.statusCode
+			record.Body = body
+			record.ExpiresAt = time.Now().UTC().Add(ttl)
+			if err := store.CompleteIdempotencyRecord(ctx, record); err != nil {
+				log.WithFields(fields).Errorf("Error storing response for idempotency key: %s", err)
+			}
+		})
+	}
+}
+
+func renewLock(store storage.Storage, record *models.IdempotencyRecord, stop <-chan struct{}, fields log.Fields) {
+	ticker := time.NewTicker(idempotencyLockRenewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			expiresAt := time.Now().UTC().Add(idempotencyLockTimeout)
+			if err := store.RenewIdempotencyRecord(context.TODO(), record, expiresAt); err != nil {
+				log.WithFields(fields).Errorf("Error renewing idempotency key lock: %s", err)
+			}
+		}
+	}
+}
+
+func replayResponse(w http.ResponseWriter, r *http.Request, store storage.Storage, record *models.IdempotencyRecord, fields log.Fields) {
+	stored, err := store.GetIdempotencyRecord(r.Context(), record.Key)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.WithFields(fields).Errorf("Error getting idempotency record: %s", err)
+		utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+		return
+	}
+
+	if stored != nil && stored.Fingerprint != record.Fingerprint {
+		log.WithFields(fields).Warning("Idempotency key reused for a different request")
+		utils.WriteError(w, r, http.StatusUnprocessableEntity, ErrorCodeIdempotencyKeyReused, "Idempotency key is already used for a different request", nil)
+		return
+	}
+
+	/*
+	Record missing here was released after a server error
+	a moment ago, request with the key may be running again.
+	*/
+	if stored == nil || stored.Status != models.IdempotencyStatusCompleted {
+		log.WithFields(fields).Warning("Request with idempotency key is still being processed")
+		utils.WriteError(w, r, http.StatusConflict, ErrorCodeIdempotencyKeyInUse, "Request with this idempotency key is still being processed", nil)
+		return
+	}
+
+	log.WithFields(fields).Info("Replaying stored response for idempotency key")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	/*
+	Json bodies are compared regardless of formatting
+	and order of keys, they are remarshaled before hashing.
+	*/
+
+	var decoded any
+	if err := json.Unmarshal(body, &decoded); err == nil {
+		if normalized, err := json.Marshal(decoded); err == nil {
+			body = normalized
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
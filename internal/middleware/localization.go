@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+func Localization(translators *utils.Translators) mux.MiddlewareFunc {
+	/*
+	Translator chosen from Accept-Language is put into request
+	context, responses name the language their messages are in.
+	*/
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			translator := translators.Negotiate(r.Header.Get("Accept-Language"))
+
+			w.Header().Set("Content-Language", translator.Locale())
+			w.Header().Add("Vary", "Accept-Language")
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), utils.ContextKeyTranslator, translator)))
+		})
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/audit"
 	"github.com/xavesen/search-admin/internal/utils"
 )
 
@@ -28,11 +29,23 @@ func Logging(next http.Handler) http.Handler {
 			byteBody, err := io.ReadAll(r.Body)
 			if err != nil {
 				log.Errorf("Error reading request body: %s", err)
-				utils.WriteJSON(w, r, http.StatusBadRequest, false, "Invalid request payload", nil)
+				utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
 				return
 			}
 			r.Body = io.NopCloser(bytes.NewBuffer(byteBody))
-			fields["body"] = string(byteBody)
+
+			/*
+			Bodies carry passwords and api keys of login and token
+			requests, they are logged with those redacted. Bodies that
+			aren't json can't be redacted and are not logged at all.
+			*/
+			if len(byteBody) > 0 {
+				if redactedBody, err := audit.RedactJSON(byteBody); err == nil {
+					fields["body"] = string(redactedBody)
+				} else {
+					fields["body"] = "<not json, omitted>"
+				}
+			}
 		}
 
 		log.WithFields(fields).Info("New request")
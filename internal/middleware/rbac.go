@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/auth"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+const ForbiddenReasonMissingPermission = "missing_permission"
+
+type ForbiddenDetails struct {
+	Reason		string			`json:"reason"`
+	Permission	auth.Permission	`json:"permission"`
+	Roles		[]string		`json:"roles"`
+}
+
+func RequirePermission(permission auth.Permission, resolver *auth.RoleResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fields := log.Fields{
+				"request_id": r.Context().Value(utils.ContextKeyReqId),
+				"method": r.Method,
+				"url_path": r.URL.Path,
+				"permission": permission,
+			}
+
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				log.WithFields(fields).Warning("Authorizing request without authenticated principal")
+				utils.WriteJSON(w, r, http.StatusUnauthorized, false, "Authentication required", nil)
+				return
+			}
+			fields["subject"] = principal.Subject
+
+			roles, err := resolver.Roles(r.Context(), principal)
+			if err != nil {
+				log.WithFields(fields).Errorf("Error resolving roles: %s", err)
+				utils.WriteJSON(w, r, http.StatusInternalServerError, false, "Internal server error", nil)
+				return
+			}
+
+			if !auth.HasPermission(roles, permission) {
+				log.WithFields(fields).Warningf("Access denied for roles %v", roles)
+				utils.WriteJSON(w, r, http.StatusForbidden, false, "Forbidden", ForbiddenDetails{
+					Reason: 	ForbiddenReasonMissingPermission,
+					Permission: permission,
+					Roles: 		roles,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/utils"
+)
+
+const (
+	defaultRequestContentType	= "application/json"
+	handlerRuleExtension		= "x-rule"
+)
+
+var formatMessages = map[string]string{
+	"date-time":	"{0} must be a RFC3339 timestamp",
+	"regex":		"{0} must be a regular expression accepted by RE2",
+}
+
+var typeMessages = map[string]string{
+	"string":	"{0} must be a string",
+	"number":	"{0} must be a number",
+	"integer":	"{0} must be an integer",
+	"boolean":	"{0} must be a boolean",
+	"array":	"{0} must be an array",
+	"object":	"{0} must be an object",
+}
+
+func init() {
+	openapi3.DefineStringFormatCallback("regex", func(value string) error {
+		_, err := regexp.Compile(value)
+		return err
+	})
+}
+
+func RequestValidation(router routers.Router) mux.MiddlewareFunc {
+	/*
+	Authentication is left to its own middleware, and defaults
+	from the schema are not written into requests so handlers
+	keep seeing exactly what clients sent.
+	*/
+
+	options := &openapi3filter.Options{
+		MultiError: 					true,
+		SkipSettingDefaults: 			true,
+		ExcludeReadOnlyValidations: 	true,
+		AuthenticationFunc: 			openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			/*
+			Handlers decode bodies as json whatever content type
+			clients send, so bodies of types not described in the
+			schema are validated as json as well.
+			*/
+			validationRequest := r.Clone(r.Context())
+			if body := route.Operation.RequestBody; body != nil && body.Value != nil {
+				mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+				if body.Value.Content.Get(mediaType) == nil {
+					validationRequest.Header.Set("Content-Type", defaultRequestContentType)
+				}
+			}
+
+			input := &openapi3filter.RequestValidationInput{
+				Request: 		validationRequest,
+				PathParams: 	pathParams,
+				Route: 			route,
+				Options: 		options,
+			}
+			err = openapi3filter.ValidateRequest(r.Context(), input)
+			r.Body = validationRequest.Body
+			if err == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			log.WithFields(log.Fields{
+				"request_id": r.Context().Value(utils.ContextKeyReqId),
+				"method": r.Method,
+				"url_path": r.URL.Path,
+			}).Warningf("User input validation error: %s", err)
+
+			fieldErrors, ok := requestFieldErrors(utils.RequestTranslator(r), err)
+			if !ok {
+				utils.WriteError(w, r, http.StatusBadRequest, utils.ErrorCodeInvalidPayload, "Invalid request payload", nil)
+				return
+			}
+			if len(fieldErrors) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			utils.WriteValidationError(w, r, fieldErrors)
+		})
+	}
+}
+
+func requestFieldErrors(translator ut.Translator, err error) ([]utils.FieldError, bool) {
+	/*
+	Returns false when request body is missing or can't be decoded,
+	there are no fields to report errors for in that case.
+	*/
+
+	if multiError, ok := err.(openapi3.MultiError); ok {
+		fieldErrors := []utils.FieldError{}
+		for _, err := range multiError {
+			errors, ok := requestFieldErrors(translator, err)
+			if !ok {
+				return nil, false
+			}
+			fieldErrors = append(fieldErrors, errors...)
+		}
+		return fieldErrors, true
+	}
+
+	var requestError *openapi3filter.RequestError
+	if !errors.As(err, &requestError) {
+		return nil, false
+	}
+
+	if requestError.Parameter == nil {
+		if requestError.Err == nil || errors.Is(requestError.Err, openapi3filter.ErrInvalidRequired) {
+			return nil, false
+		}
+		var parseError *openapi3filter.ParseError
+		if errors.As(requestError.Err, &parseError) {
+			return nil, false
+		}
+		return schemaFieldErrors(translator, requestError.Err, "")
+	}
+
+	name := requestError.Parameter.Name
+	if errors.Is(requestError.Err, openapi3filter.ErrInvalidRequired) {
+		return []utils.FieldError{{Field: name, Rule: "required", Message: utils.Translate(translator, "{0} is required", name)}}, true
+	}
+	var parseError *openapi3filter.ParseError
+	if errors.As(requestError.Err, &parseError) {
+		schema := requestError.Parameter.Schema
+		if schema != nil && schema.Value != nil && schema.Value.Type != nil && len(*schema.Value.Type) == 1 {
+			return []utils.FieldError{{Field: name, Rule: "type", Message: typeMessage(translator, name, (*schema.Value.Type)[0])}}, true
+		}
+	}
+	if requestError.Err == nil || parseError != nil {
+		return []utils.FieldError{{Field: name, Rule: "invalid", Message: utils.Translate(translator, "{0} is invalid", name)}}, true
+	}
+	return schemaFieldErrors(translator, requestError.Err, name)
+}
+
+func schemaFieldErrors(translator ut.Translator, err error, prefix string) ([]utils.FieldError, bool) {
+	if multiError, ok := err.(openapi3.MultiError); ok {
+		fieldErrors := []utils.FieldError{}
+		for _, err := range multiError {
+			errors, ok := schemaFieldErrors(translator, err, prefix)
+			if !ok {
+				return nil, false
+			}
+			fieldErrors = append(fieldErrors, errors...)
+		}
+		return fieldErrors, true
+	}
+
+	var schemaError *openapi3.SchemaError
+	if !errors.As(err, &schemaError) {
+		return nil, false
+	}
+
+	field := fieldName(prefix, schemaError.JSONPointer())
+	if field == "" {
+		return nil, false
+	}
+	if handlerRule(schemaError) {
+		return []utils.FieldError{}, true
+	}
+
+	rule, message := schemaErrorMessage(translator, field, schemaError)
+	return []utils.FieldError{{Field: field, Rule: rule, Message: message}}, true
+}
+
+func fieldName(prefix string, pointer []string) string {
+	/*
+	Field names follow json names of fields, array items are
+	referenced by index in brackets: roles[0], hits[1].count.
+	*/
+
+	name := prefix
+	for _, key := range pointer {
+		if _, err := strconv.Atoi(key); err == nil && name != "" {
+			name = name + "[" + key + "]"
+			continue
+		}
+		if name != "" {
+			name = name + "."
+		}
+		name = name + key
+	}
+
+	return name
+}
+
+func schemaErrorMessage(translator ut.Translator, field string, err *openapi3.SchemaError) (string, string) {
+	/*
+	Rules are named after validator tags where there is one,
+	so clients see the same rules whichever validation failed.
+	*/
+
+	schema := err.Schema
+
+	switch err.SchemaField {
+	case "required":
+		return "required", utils.Translate(translator, "{0} is required", field)
+	case "type":
+		if schema.Type != nil && len(*schema.Type) == 1 {
+			return "type", typeMessage(translator, field, (*schema.Type)[0])
+		}
+	case "enum":
+		values := []string{}
+		for _, value := range schema.Enum {
+			values = append(values, fmt.Sprint(value))
+		}
+		return "oneof", utils.Translate(translator, "{0} must be one of [{1}]", field, strings.Join(values, " "))
+	case "minimum", "maximum":
+		rule := "min"
+		if err.SchemaField == "maximum" {
+			rule = "max"
+		}
+		if schema.Min != nil && schema.Max != nil {
+			return rule, utils.Translate(translator, "{0} must be between {1} and {2}", field, fmt.Sprint(*schema.Min), fmt.Sprint(*schema.Max))
+		}
+		if schema.Min != nil {
+			return rule, utils.Translate(translator, "{0} must be {1} or greater", field, fmt.Sprint(*schema.Min))
+		}
+		if schema.Max != nil {
+			return rule, utils.Translate(translator, "{0} must be {1} or less", field, fmt.Sprint(*schema.Max))
+		}
+	case "minItems":
+		if schema.MinItems == 1 {
+			return "min", utils.Translate(translator, "{0} must contain at least 1 item", field)
+		}
+		return "min", utils.Translate(translator, "{0} must contain at least {1} items", field, fmt.Sprint(schema.MinItems))
+	case "minLength":
+		return "min", utils.Translate(translator, "{0} must be at least {1} characters in length", field, fmt.Sprint(schema.MinLength))
+	case "maxLength":
+		if schema.MaxLength != nil {
+			return "max", utils.Translate(translator, "{0} must be at most {1} characters in length", field, fmt.Sprint(*schema.MaxLength))
+		}
+	case "pattern":
+		return "pattern", utils.Translate(translator, "{0} must match {1}", field, schema.Pattern)
+	case "format":
+		if message, ok := formatMessages[schema.Format]; ok {
+			return schema.Format, utils.Translate(translator, message, field)
+		}
+		return schema.Format, utils.Translate(translator, "{0} must be a valid {1}", field, schema.Format)
+	}
+
+	return "invalid", utils.Translate(translator, "{0} is invalid", field)
+}
+
+func handlerRule(err *openapi3.SchemaError) bool {
+	/*
+	Fields marked with x-rule are checked by handlers with a
+	validator rule of that name, which knows configured bounds
+	and values already stored. Bounds in the schema document
+	the rule, their errors are left to handlers to report.
+	*/
+
+	if _, ok := err.Schema.Extensions[handlerRuleExtension]; !ok {
+		return false
+	}
+
+	switch err.SchemaField {
+	case "pattern", "minLength", "maxLength", "minimum", "maximum":
+		return true
+	}
+
+	return false
+}
+
+func typeMessage(translator ut.Translator, field string, schemaType string) string {
+	message, ok := typeMessages[schemaType]
+	if !ok {
+		return utils.Translate(translator, "{0} is invalid", field)
+	}
+
+	return utils.Translate(translator, message, field)
+}
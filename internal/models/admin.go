@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Admin struct {
+	Id				string		`json:"id,omitempty" bson:"_id,omitempty" validate:"omitempty,mongodb"`
+	Login			string		`json:"login" validate:"required"`
+	Password		string		`json:"password,omitempty" bson:"-" validate:"required,min=8"`
+	PasswordHash	string		`json:"-" bson:"passwordhash"`
+	CreatedAt		time.Time	`json:"created_at" bson:"createdat"`
+}
+
+type Session struct {
+	Id			string		`json:"id,omitempty" bson:"_id,omitempty"`
+	AdminId		string		`json:"admin_id" bson:"adminid"`
+	Login		string		`json:"login"`
+	TokenHash	string		`json:"-" bson:"tokenhash"`
+	CreatedAt	time.Time	`json:"created_at" bson:"createdat"`
+	ExpiresAt	time.Time	`json:"expires_at" bson:"expiresat"`
+	RevokedAt	*time.Time	`json:"revoked_at,omitempty" bson:"revokedat,omitempty"`
+}
+
+type LoginRequest struct {
+	Login		string	`json:"login" validate:"required"`
+	Password	string	`json:"password" validate:"required"`
+}
+
+type LoginResponse struct {
+	Token		string		`json:"token"`
+	ExpiresAt	time.Time	`json:"expires_at"`
+}
+
+func (admin *Admin) String() string {
+	/*
+	Password is never stored, but it is present
+	in admin struct while admin is being created.
+	*/
+
+	adminNoPassword := *admin
+	adminNoPassword.Password = "***"
+	adminJson, _ := json.Marshal(&adminNoPassword)
+
+	return string(adminJson)
+}
+
+func (session *Session) IsValid(now time.Time) bool {
+	return session.RevokedAt == nil && now.Before(session.ExpiresAt)
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+type APIKey struct {
+	Id			string		`json:"id,omitempty" bson:"_id,omitempty"`
+	UserId		string		`json:"user_id" bson:"userid"`
+	Name		string		`json:"name"`
+	Prefix		string		`json:"prefix"`
+	KeyHash		string		`json:"-" bson:"keyhash"`
+	Scopes		[]string	`json:"scopes"`
+	CreatedAt	time.Time	`json:"created_at" bson:"createdat"`
+	ExpiresAt	*time.Time	`json:"expires_at,omitempty" bson:"expiresat,omitempty"`
+	RevokedAt	*time.Time	`json:"revoked_at,omitempty" bson:"revokedat,omitempty"`
+}
+
+type APIKeyRequest struct {
+	Name		string		`json:"name" validate:"required"`
+	Scopes		[]string	`json:"scopes" validate:"required,min=1,dive,required"`
+	ExpiresAt	*time.Time	`json:"expires_at,omitempty"`
+}
+
+// CreatedAPIKey is the only response containing the key itself,
+// only its hash is stored
+type CreatedAPIKey struct {
+	APIKey
+	Key	string	`json:"key"`
+}
+
+type APIKeyVerifyRequest struct {
+	Key		string	`json:"key" validate:"required"`
+	Index	string	`json:"index,omitempty"`
+}
+
+type APIKeyVerifyResponse struct {
+	Valid	bool		`json:"valid"`
+	Reason	string		`json:"reason,omitempty"`
+	KeyId	string		`json:"key_id,omitempty"`
+	UserId	string		`json:"user_id,omitempty"`
+	Scopes	[]string	`json:"scopes,omitempty"`
+}
+
+func (key *APIKey) IsValid(now time.Time) bool {
+	return key.RevokedAt == nil && (key.ExpiresAt == nil || now.Before(*key.ExpiresAt))
+}
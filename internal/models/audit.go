@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+const (
+	AuditResourceUser			= "user"
+	AuditResourceFilter			= "filter"
+	AuditResourceFilters		= "filters"
+	AuditResourceRoleBinding	= "role_binding"
+	AuditResourceAdmin			= "admin"
+	AuditResourceSession		= "session"
+	AuditResourceAPIKey			= "api_key"
+	AuditResourceWebhook		= "webhook"
+)
+
+type AuditChange struct {
+	Field	string	`json:"field"`
+	Before	any		`json:"before"`
+	After	any		`json:"after"`
+}
+
+type AuditEvent struct {
+	Id				string			`json:"id,omitempty" bson:"_id,omitempty"`
+	Time			time.Time		`json:"time"`
+	Actor			string			`json:"actor"`
+	ActorMethod		string			`json:"actor_method,omitempty" bson:"actormethod,omitempty"`
+	RequestId		string			`json:"request_id" bson:"requestid"`
+	Action			string			`json:"action"`
+	ResourceType	string			`json:"resource_type" bson:"resourcetype"`
+	ResourceId		string			`json:"resource_id,omitempty" bson:"resourceid,omitempty"`
+	Before			map[string]any	`json:"before,omitempty" bson:"before,omitempty"`
+	After			map[string]any	`json:"after,omitempty" bson:"after,omitempty"`
+	Changes			[]AuditChange	`json:"changes"`
+}
+
+type AuditQuery struct {
+	ResourceType	string
+	ResourceId		string
+	Actor			string
+	From			time.Time
+	To				time.Time
+	Limit			int64
+}
@@ -0,0 +1,31 @@
+package models
+
+const (
+	BulkOperationCreate	= "create"
+	BulkOperationUpdate	= "update"
+	BulkOperationDelete	= "delete"
+)
+
+type UserBulkOperation struct {
+	Op		string	`json:"op" validate:"required,oneof=create update delete"`
+	Id		string	`json:"id,omitempty" validate:"required_unless=Op create,omitempty,mongodb"`
+	User	*User	`json:"user,omitempty" validate:"required_unless=Op delete"`
+}
+
+type UserBulkResult struct {
+	Before	*User
+	After	*User
+	Err		error
+}
+
+type FilterBulkOperation struct {
+	Op		string	`json:"op" validate:"required,oneof=create update delete"`
+	Id		string	`json:"id,omitempty" validate:"required_unless=Op create,omitempty,mongodb"`
+	Filter	*Filter	`json:"filter,omitempty" validate:"required_unless=Op delete"`
+}
+
+type FilterBulkResult struct {
+	Before	*Filter
+	After	*Filter
+	Err		error
+}
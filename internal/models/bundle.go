@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+const FilterBundleVersion = 1
+
+const (
+	FilterImportModeMerge	= "merge"
+	FilterImportModeReplace	= "replace"
+)
+
+type FilterBundle struct {
+	Version		int			`json:"version" yaml:"version"`
+	ExportedAt	time.Time	`json:"exported_at" yaml:"exported_at"`
+	Filters		[]Filter	`json:"filters" yaml:"filters"`
+}
+
+type FilterImportEntryError struct {
+	Index	int			`json:"index"`
+	Id		string		`json:"id,omitempty"`
+	Errors	[]string	`json:"errors"`
+}
+
+type FilterImportResult struct {
+	Mode		string						`json:"mode"`
+	DryRun		bool						`json:"dry_run"`
+	Created		int							`json:"created"`
+	Updated		int							`json:"updated"`
+	Deleted		int							`json:"deleted"`
+	Errors		[]FilterImportEntryError	`json:"errors,omitempty"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type ChangeRecord struct {
+	Seq				int64			`json:"seq"`
+	ResourceType	string			`json:"resource_type" bson:"resourcetype"`
+	ResourceId		string			`json:"resource_id" bson:"resourceid"`
+	Operation		string			`json:"operation"`
+	State			map[string]any	`json:"state,omitempty" bson:"state,omitempty"`
+	Time			time.Time		`json:"time"`
+}
+
+type ChangeFeed struct {
+	Changes		[]ChangeRecord	`json:"changes"`
+	NextCursor	string			`json:"next_cursor"`
+	HasMore		bool			`json:"has_more"`
+}
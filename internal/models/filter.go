@@ -1,14 +1,119 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	FilterActionBlock	= "block"
+	FilterActionRedact	= "redact"
+	FilterActionTag		= "tag"
+)
+
+const (
+	FilterModeEnforce	= "enforce"
+	FilterModeShadow	= "shadow"
+)
+
+const (
+	defaultRedactReplacement	= "***"
+	fullRolloutPercentage		= 100
+)
 
 type Filter struct {
-	Id		string	`json:"id,omitempty" bson:"_id,omitempty" validate:"omitempty,mongodb"`
-	Regex	string	`json:"regex" validate:"required"`
+	Id					string		`json:"id,omitempty" yaml:"id,omitempty" bson:"_id,omitempty" validate:"omitempty,mongodb"`
+	Regex				string		`json:"regex" yaml:"regex" validate:"required,re2"`
+	Fields				[]string	`json:"fields,omitempty" yaml:"fields,omitempty" validate:"omitempty,dive,required"`
+	Action				string		`json:"action,omitempty" yaml:"action,omitempty" validate:"omitempty,oneof=block redact tag"`
+	Tag					string		`json:"tag,omitempty" yaml:"tag,omitempty"`
+	Replacement			string		`json:"replacement,omitempty" yaml:"replacement,omitempty"`
+	Priority			int			`json:"priority,omitempty" yaml:"priority,omitempty"`
+	StopProcessing		bool		`json:"stop_processing,omitempty" yaml:"stop_processing,omitempty" bson:"stopprocessing"`
+	Mode				string		`json:"mode,omitempty" yaml:"mode,omitempty" validate:"omitempty,oneof=enforce shadow"`
+	RolloutPercentage	*int		`json:"rollout_percentage,omitempty" yaml:"rollout_percentage,omitempty" bson:"rolloutpercentage,omitempty" validate:"omitempty,min=0,max=100"`
+	ActiveFrom			*time.Time	`json:"active_from,omitempty" yaml:"active_from,omitempty" bson:"activefrom,omitempty"`
+	ActiveUntil			*time.Time	`json:"active_until,omitempty" yaml:"active_until,omitempty" bson:"activeuntil,omitempty"`
+	ArchivedAt			*time.Time	`json:"archived_at,omitempty" yaml:"archived_at,omitempty" bson:"archivedat,omitempty"`
+	DeletedAt			*time.Time	`json:"deleted_at,omitempty" yaml:"-" bson:"deletedat,omitempty"`
 }
 
 func (filter *Filter) String() string {
 	filterJson, _ := json.Marshal(&filter)
 
 	return string(filterJson)
+}
+
+func (filter *Filter) EffectiveAction() string {
+	/*
+	Filters created before actions were introduced have no action stored,
+	they have always been used to block documents.
+	*/
+
+	if filter.Action == "" {
+		return FilterActionBlock
+	}
+
+	return filter.Action
+}
+
+func (filter *Filter) EffectiveTag() string {
+	if filter.Tag == "" {
+		return filter.Id
+	}
+
+	return filter.Tag
+}
+
+func (filter *Filter) EffectiveReplacement() string {
+	if filter.Replacement == "" {
+		return defaultRedactReplacement
+	}
+
+	return filter.Replacement
+}
+
+func (filter *Filter) EffectiveMode() string {
+	if filter.Mode == "" {
+		return FilterModeEnforce
+	}
+
+	return filter.Mode
+}
+
+func (filter *Filter) EffectiveRolloutPercentage() int {
+	if filter.RolloutPercentage == nil {
+		return fullRolloutPercentage
+	}
+
+	return *filter.RolloutPercentage
+}
+
+func (filter *Filter) IsActive(now time.Time) bool {
+	if filter.ArchivedAt != nil {
+		return false
+	}
+	if filter.ActiveFrom != nil && now.Before(*filter.ActiveFrom) {
+		return false
+	}
+	if filter.IsExpired(now) {
+		return false
+	}
+
+	return true
+}
+
+func (filter *Filter) IsExpired(now time.Time) bool {
+	return filter.ActiveUntil != nil && !now.Before(*filter.ActiveUntil)
+}
+
+func ActiveFilters(filters []Filter, now time.Time) []Filter {
+	active := []Filter{}
+	for _, filter := range filters {
+		if filter.IsActive(now) {
+			active = append(active, filter)
+		}
+	}
+
+	return active
 }
\ No newline at end of file
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+const (
+	IdempotencyStatusProcessing	= "processing"
+	IdempotencyStatusCompleted	= "completed"
+)
+
+type IdempotencyRecord struct {
+	Key			string		`json:"key" bson:"_id"`
+	Fingerprint	string		`json:"fingerprint"`
+	Status		string		`json:"status"`
+	StatusCode	int			`json:"status_code,omitempty" bson:"statuscode,omitempty"`
+	Body		[]byte		`json:"-" bson:"body,omitempty"`
+	CreatedAt	time.Time	`json:"created_at" bson:"createdat"`
+	ExpiresAt	time.Time	`json:"expires_at" bson:"expiresat"`
+}
@@ -0,0 +1,9 @@
+package models
+
+import "time"
+
+type LoginFailure struct {
+	Key			string		`json:"key" bson:"_id"`
+	Count		int			`json:"count"`
+	ResetAt		time.Time	`json:"reset_at" bson:"resetat"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	OutboxEventPending		= "pending"
+	OutboxEventDelivered	= "delivered"
+)
+
+// OutboxEvent is written in the same transaction as the change it
+// describes, data is the changed resource with sensitive fields redacted
+type OutboxEvent struct {
+	Id				string			`json:"id,omitempty" bson:"_id,omitempty"`
+	Type			string			`json:"type"`
+	ResourceType	string			`json:"resource_type" bson:"resourcetype"`
+	ResourceId		string			`json:"resource_id" bson:"resourceid"`
+	Data			map[string]any	`json:"data,omitempty" bson:"data,omitempty"`
+	CreatedAt		time.Time		`json:"created_at" bson:"createdat"`
+	Status			string			`json:"-"`
+	Attempts		int				`json:"-"`
+	NextAttemptAt	time.Time		`json:"-" bson:"nextattemptat"`
+	DeliveredAt		*time.Time		`json:"-" bson:"deliveredat,omitempty"`
+	LastError		string			`json:"-" bson:"lasterror,omitempty"`
+}
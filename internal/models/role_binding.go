@@ -0,0 +1,14 @@
+package models
+
+import "encoding/json"
+
+type RoleBinding struct {
+	Subject	string		`json:"subject" bson:"_id"`
+	Roles	[]string	`json:"roles" validate:"required,min=1,dive,oneof=viewer filter-editor user-admin search-service superadmin"`
+}
+
+func (binding *RoleBinding) String() string {
+	bindingJson, _ := json.Marshal(&binding)
+
+	return string(bindingJson)
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type SigningKey struct {
+	Id					string		`json:"kid" bson:"_id"`
+	Algorithm			string		`json:"alg" bson:"algorithm"`
+	EncryptedPrivateKey	string		`json:"-" bson:"encryptedprivatekey"`
+	CreatedAt			time.Time	`json:"created_at" bson:"createdat"`
+}
+
+type TokenRequest struct {
+	Login		string	`json:"login,omitempty"`
+	Password	string	`json:"password,omitempty"`
+	APIKey		string	`json:"api_key,omitempty"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const FilterStatsBucketSize = time.Hour
+
+type FilterHits struct {
+	FilterId	string		`json:"filter_id" validate:"required,mongodb"`
+	Bucket		time.Time	`json:"bucket" validate:"required"`
+	Count		int64		`json:"count" validate:"required,min=1"`
+	LastHit		*time.Time	`json:"last_hit,omitempty"`
+}
+
+type FilterHitsReport struct {
+	Hits	[]FilterHits	`json:"hits" validate:"required,min=1,dive"`
+}
+
+type FilterStatsBucket struct {
+	Bucket		time.Time	`json:"bucket"`
+	Hits		int64		`json:"hits"`
+	LastHit		time.Time	`json:"last_hit" bson:"lasthit"`
+}
+
+type FilterStats struct {
+	FilterId	string				`json:"filter_id" bson:"_id"`
+	TotalHits	int64				`json:"total_hits" bson:"totalhits"`
+	LastHit		*time.Time			`json:"last_hit" bson:"lasthit"`
+	Buckets		[]FilterStatsBucket	`json:"buckets,omitempty" bson:"-"`
+}
+
+func (hits *FilterHits) String() string {
+	hitsJson, _ := json.Marshal(&hits)
+
+	return string(hitsJson)
+}
+
+func (hits *FilterHits) Normalize() {
+	/*
+	Consumers may report hits with any precision, they are
+	rolled up into hourly buckets. If consumer doesn't know
+	the exact time of the last hit, start of the bucket is used.
+	*/
+
+	hits.Bucket = hits.Bucket.UTC().Truncate(FilterStatsBucketSize)
+	if hits.LastHit == nil {
+		lastHit := hits.Bucket
+		hits.LastHit = &lastHit
+	}
+}
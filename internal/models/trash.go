@@ -0,0 +1,11 @@
+package models
+
+type Trash struct {
+	Users	[]User		`json:"users"`
+	Filters	[]Filter	`json:"filters"`
+}
+
+type PurgeResult struct {
+	Users	int64	`json:"users"`
+	Filters	int64	`json:"filters"`
+}
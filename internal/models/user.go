@@ -1,13 +1,17 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type User struct {
 	Id         	string 		`json:"id,omitempty" bson:"_id,omitempty" validate:"omitempty,mongodb"`
-	Login      	string 		`json:"login" validate:"required"`
+	Login      	string 		`json:"login" validate:"required,login"`
 	Password   	string 		`json:"password" validate:"required"`
-	IndexLimit 	int    		`json:"index_limit" bson:"indexlimit" validate:"required"`
-	Indexes		[]string	`json:"indexes,omitempty" validate:"omitempty"`
+	IndexLimit 	int    		`json:"index_limit" bson:"indexlimit" validate:"required,index_limit"`
+	Indexes		[]string	`json:"indexes,omitempty" validate:"omitempty,dive,index_name"`
+	DeletedAt	*time.Time	`json:"deleted_at,omitempty" bson:"deletedat,omitempty"`
 }
 
 func (user *User) String() string {
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+const (
+	WebhookDeliveryPending		= "pending"
+	WebhookDeliverySucceeded	= "succeeded"
+	WebhookDeliveryFailed		= "failed"
+)
+
+type Webhook struct {
+	Id			string		`json:"id,omitempty" bson:"_id,omitempty"`
+	URL			string		`json:"url" validate:"required,url"`
+	Events		[]string	`json:"events" validate:"required,min=1,dive,required"`
+	Secret		string		`json:"-" bson:"secret"`
+	CreatedAt	time.Time	`json:"created_at" bson:"createdat"`
+}
+
+// CreatedWebhook is the only response containing the signing secret
+type CreatedWebhook struct {
+	Webhook
+	Secret	string	`json:"secret"`
+}
+
+type WebhookEvent struct {
+	Id				string		`json:"id"`
+	Type			string		`json:"type"`
+	Time			time.Time	`json:"time"`
+	ResourceType	string		`json:"resource_type"`
+	ResourceId		string		`json:"resource_id"`
+	Data			any			`json:"data,omitempty"`
+}
+
+// WebhookDelivery keeps event body as it was first sent,
+// so redeliveries carry exactly the same payload
+type WebhookDelivery struct {
+	Id				string		`json:"id,omitempty" bson:"_id,omitempty"`
+	WebhookId		string		`json:"webhook_id" bson:"webhookid"`
+	EventId			string		`json:"event_id" bson:"eventid"`
+	EventType		string		`json:"event_type" bson:"eventtype"`
+	Payload			string		`json:"payload"`
+	Status			string		`json:"status"`
+	Attempts		int			`json:"attempts"`
+	NextAttemptAt	time.Time	`json:"next_attempt_at" bson:"nextattemptat"`
+	LastAttemptAt	*time.Time	`json:"last_attempt_at,omitempty" bson:"lastattemptat,omitempty"`
+	LastStatusCode	int			`json:"last_status_code,omitempty" bson:"laststatuscode,omitempty"`
+	LastError		string		`json:"last_error,omitempty" bson:"lasterror,omitempty"`
+	CreatedAt		time.Time	`json:"created_at" bson:"createdat"`
+}
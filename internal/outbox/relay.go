@@ -0,0 +1,102 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	cfg "github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	eventsPerRun	= 100
+	maxRetryDelay	= 10 * time.Minute
+	eventLease		= time.Minute
+)
+
+type Relay struct {
+	storage		storage.Storage
+	publishers	[]Publisher
+	backoff		time.Duration
+}
+
+func NewRelay(storage storage.Storage, backoff time.Duration, publishers ...Publisher) *Relay {
+	return &Relay{
+		storage:	storage,
+		publishers:	publishers,
+		backoff:	backoff,
+	}
+}
+
+func NewRelayFromConfig(storage storage.Storage, config *cfg.Config, publishers ...Publisher) *Relay {
+	if config.OutboxHTTPURL != "" {
+		log.Infof("Relaying outbox events to %s", config.OutboxHTTPURL)
+		publishers = append(publishers, NewHTTPPublisher(config.OutboxHTTPURL, config.OutboxHTTPTimeout))
+	}
+	if config.OutboxFilePath != "" {
+		log.Infof("Relaying outbox events to file %s", config.OutboxFilePath)
+		publishers = append(publishers, NewFilePublisher(config.OutboxFilePath))
+	}
+
+	return NewRelay(storage, config.OutboxRetryBackoff, publishers...)
+}
+
+func (r *Relay) RelayDue(ctx context.Context) error {
+	/*
+	Event is marked delivered only after every publisher accepted it.
+	When one of them fails the event is retried for all of them,
+	so publishers may see an event more than once, but never miss it.
+	*/
+
+	for i := 0; i < eventsPerRun; i++ {
+		now := time.Now().UTC()
+		event, err := r.storage.ClaimOutboxEvent(ctx, now, now.Add(eventLease))
+		if err == mongo.ErrNoDocuments {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		r.relay(ctx, event)
+		if err := r.storage.UpdateOutboxEvent(ctx, event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Relay) relay(ctx context.Context, event *models.OutboxEvent) {
+	event.Attempts++
+
+	for _, publisher := range r.publishers {
+		if err := publisher.Publish(ctx, event); err != nil {
+			event.LastError = fmt.Sprintf("%s: %s", publisher.Name(), err)
+			event.NextAttemptAt = time.Now().UTC().Add(retryDelay(r.backoff, event.Attempts))
+			log.Warningf("Relaying outbox event %s failed on attempt %d, retrying: %s", event.Id, event.Attempts, event.LastError)
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	event.Status = models.OutboxEventDelivered
+	event.DeliveredAt = &now
+	event.LastError = ""
+	log.Debugf("Relayed outbox event %s %s", event.Id, event.Type)
+}
+
+func retryDelay(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/xavesen/search-admin/internal/models"
@@ -13,10 +14,25 @@ import (
 )
 
 type MongoStorage struct {
-	client 				*mongo.Client
-	database 			*mongo.Database
-	usersCollection		*mongo.Collection
-	filtersCollection	*mongo.Collection
+	client						*mongo.Client
+	database					*mongo.Database
+	usersCollection				*mongo.Collection
+	filtersCollection			*mongo.Collection
+	filterStatsCollection		*mongo.Collection
+	roleBindingsCollection		*mongo.Collection
+	adminsCollection			*mongo.Collection
+	sessionsCollection			*mongo.Collection
+	apiKeysCollection			*mongo.Collection
+	signingKeysCollection		*mongo.Collection
+	auditCollection				*mongo.Collection
+	webhooksCollection			*mongo.Collection
+	webhookDeliveriesCollection	*mongo.Collection
+	outboxCollection			*mongo.Collection
+	countersCollection			*mongo.Collection
+	changesCollection			*mongo.Collection
+	idempotencyCollection		*mongo.Collection
+	loginFailuresCollection		*mongo.Collection
+	transactions				bool
 }
 
 func NewMongoStorage(ctx context.Context, addr string, db string, user string, password string) (*MongoStorage, error) {
@@ -44,22 +60,242 @@ func NewMongoStorage(ctx context.Context, addr string, db string, user string, p
 		return nil, err
 	}
 
+	log.Debug("Checking if db deployment supports transactions")
+	transactions, err := supportsTransactions(ctx, newClient)
+	if err != nil {
+		log.Errorf("Error checking if mongo db %s on %s supports transactions: %s", db, addr, err.Error())
+		return nil, err
+	}
+	if !transactions {
+		log.Warning("Mongo db deployment is standalone, multi-document changes will not be atomic")
+		log.Warning("Outbox events are stored apart from their changes on standalone db deployment, events of changes made while db fails may be lost, use a replica set to publish events and webhooks reliably")
+		log.Warning("Change feed sequence is not assigned atomically with changes on standalone db deployment, consumers of /changes and /events may skip concurrent changes, use a replica set to follow changes reliably")
+	}
+
 	log.Debug("Initializing db and collections")
 	appDb := newClient.Database(db)
 	usersCol := appDb.Collection("users")
 	filtersCol := appDb.Collection("filters")
+	filterStatsCol := appDb.Collection("filter_stats")
+	roleBindingsCol := appDb.Collection("role_bindings")
+	adminsCol := appDb.Collection("admins")
+	sessionsCol := appDb.Collection("sessions")
+	apiKeysCol := appDb.Collection("api_keys")
+	signingKeysCol := appDb.Collection("signing_keys")
+	auditCol := appDb.Collection("audit")
+	webhooksCol := appDb.Collection("webhooks")
+	webhookDeliveriesCol := appDb.Collection("webhook_deliveries")
+	outboxCol := appDb.Collection("outbox")
+	countersCol := appDb.Collection("counters")
+	changesCol := appDb.Collection("changes")
+	idempotencyCol := appDb.Collection("idempotency_keys")
+	loginFailuresCol := appDb.Collection("login_failures")
+
+	log.Debug("Creating indexes")
+	filterStatsIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "filterid", Value: 1}, {Key: "bucket", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err = filterStatsCol.Indexes().CreateOne(ctx, filterStatsIndex); err != nil {
+		log.Errorf("Error creating index on filter stats collection: %s", err.Error())
+		return nil, err
+	}
+	/*
+	Users are authenticated by login at the token endpoint, so it has to be
+	unique. Soft deleted users keep their logins until they are purged.
+	*/
+	usersIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "login", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err = usersCol.Indexes().CreateOne(ctx, usersIndex); err != nil {
+		log.Errorf("Error creating index on users collection: %s", err.Error())
+		return nil, err
+	}
+	adminsIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "login", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+	if _, err = adminsCol.Indexes().CreateOne(ctx, adminsIndex); err != nil {
+		log.Errorf("Error creating index on admins collection: %s", err.Error())
+		return nil, err
+	}
+	sessionsIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "tokenhash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "expiresat", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	}
+	if _, err = sessionsCol.Indexes().CreateMany(ctx, sessionsIndexes); err != nil {
+		log.Errorf("Error creating indexes on sessions collection: %s", err.Error())
+		return nil, err
+	}
+	apiKeysIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "prefix", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "userid", Value: 1}},
+		},
+	}
+	if _, err = apiKeysCol.Indexes().CreateMany(ctx, apiKeysIndexes); err != nil {
+		log.Errorf("Error creating indexes on api keys collection: %s", err.Error())
+		return nil, err
+	}
+	auditIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "time", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "resourcetype", Value: 1}, {Key: "resourceid", Value: 1}, {Key: "time", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "actor", Value: 1}, {Key: "time", Value: -1}},
+		},
+	}
+	if _, err = auditCol.Indexes().CreateMany(ctx, auditIndexes); err != nil {
+		log.Errorf("Error creating indexes on audit collection: %s", err.Error())
+		return nil, err
+	}
+	webhookDeliveriesIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextattemptat", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "webhookid", Value: 1}, {Key: "createdat", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "webhookid", Value: 1}, {Key: "eventid", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	if _, err = webhookDeliveriesCol.Indexes().CreateMany(ctx, webhookDeliveriesIndexes); err != nil {
+		log.Errorf("Error creating indexes on webhook deliveries collection: %s", err.Error())
+		return nil, err
+	}
+	outboxIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextattemptat", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "deliveredat", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(outboxRetention.Seconds())),
+		},
+	}
+	if _, err = outboxCol.Indexes().CreateMany(ctx, outboxIndexes); err != nil {
+		log.Errorf("Error creating indexes on outbox collection: %s", err.Error())
+		return nil, err
+	}
+	changesIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "time", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(changesRetention.Seconds())),
+		},
+	}
+	if _, err = changesCol.Indexes().CreateMany(ctx, changesIndexes); err != nil {
+		log.Errorf("Error creating indexes on changes collection: %s", err.Error())
+		return nil, err
+	}
+	idempotencyIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "expiresat", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err = idempotencyCol.Indexes().CreateOne(ctx, idempotencyIndex); err != nil {
+		log.Errorf("Error creating index on idempotency keys collection: %s", err.Error())
+		return nil, err
+	}
+	loginFailuresIndex := mongo.IndexModel{
+		Keys: bson.D{{Key: "resetat", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	if _, err = loginFailuresCol.Indexes().CreateOne(ctx, loginFailuresIndex); err != nil {
+		log.Errorf("Error creating index on login failures collection: %s", err.Error())
+		return nil, err
+	}
 
 	newStorage := &MongoStorage{
 		client: newClient,
 		database: appDb,
 		usersCollection: usersCol,
 		filtersCollection: filtersCol,
+		filterStatsCollection: filterStatsCol,
+		roleBindingsCollection: roleBindingsCol,
+		adminsCollection: adminsCol,
+		sessionsCollection: sessionsCol,
+		apiKeysCollection: apiKeysCol,
+		signingKeysCollection: signingKeysCol,
+		auditCollection: auditCol,
+		webhooksCollection: webhooksCol,
+		webhookDeliveriesCollection: webhookDeliveriesCol,
+		outboxCollection: outboxCol,
+		countersCollection: countersCol,
+		changesCollection: changesCol,
+		idempotencyCollection: idempotencyCol,
+		loginFailuresCollection: loginFailuresCol,
+		transactions: transactions,
 	}
 
 	log.Info("Successfully initialized and connected mongo db")
 	return newStorage, nil
 }
 
+func supportsTransactions(ctx context.Context, client *mongo.Client) (bool, error) {
+	/*
+	Transactions are only available on replica sets and sharded clusters,
+	replica set members report setName, mongos reports isdbgrid.
+	Hello command needs MongoDB 4.4.2 or newer, older servers reject it
+	with a command error and are asked with legacy isMaster instead.
+	*/
+
+	var hello struct {
+		SetName	string	`bson:"setName"`
+		Msg		string	`bson:"msg"`
+	}
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) {
+		log.Debugf("Hello command is not supported by db, falling back to isMaster: %s", err.Error())
+		err = client.Database("admin").RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
+func (s *MongoStorage) withTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !s.transactions {
+		return fn(ctx)
+	}
+
+	session, err := s.client.StartSession()
+	if err != nil {
+		log.Errorf("Error starting db session: %s", err.Error())
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+
+	return err
+}
+
+// notDeleted excludes soft deleted documents from reads and updates
+var notDeleted = bson.E{Key: "deletedat", Value: bson.D{{Key: "$exists", Value: false}}}
+var deleted = bson.E{Key: "deletedat", Value: bson.D{{Key: "$exists", Value: true}}}
+
 func getOid(supposedOid interface{}) (string, bool) {
 	log.Debug("Getting object id")
 	if oid, ok := supposedOid.(primitive.ObjectID); ok {
@@ -74,20 +310,31 @@ func getOid(supposedOid interface{}) (string, bool) {
 func (s *MongoStorage) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
 	log.Debugf("Inserting user %s to db", user)
 
-	result, err := s.usersCollection.InsertOne(ctx, user)
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		user.Id = ""
+		result, err := s.usersCollection.InsertOne(ctx, user)
+		if mongo.IsDuplicateKeyError(err) {
+			log.Warningf("Tried to insert user with already taken login %s to db", user.Login)
+			return ErrDuplicateLogin
+		} else if err != nil {
+			log.Errorf("Error inserting user %s to db: %s", user, err.Error())
+			return err
+		}
+
+		id, ok := getOid(result.InsertedID)
+		if !ok {
+			log.Errorf("Unable to get oid from interface returned by db after trying to insert user %s", user)
+			return errors.New("db did not return object id")
+		}
+
+		user.Id = id
+
+		return s.recordChange(ctx, "user.create", models.AuditResourceUser, id, nil, user)
+	})
 	if err != nil {
-		log.Errorf("Error inserting user %s to db: %s", user, err.Error())
 		return nil, err
 	}
 
-	id, ok := getOid(result.InsertedID)
-	if !ok {
-		log.Errorf("Unable to get oid from interface returned by db after trying to insert user %s", user)
-		return nil, errors.New("db did not return object id")
-	}
-
-	user.Id = id
-
 	log.Debugf("Successfully inserted user %s to db", user)
 	return user, nil
 }
@@ -101,7 +348,7 @@ func (s *MongoStorage) GetUser(ctx context.Context, id string) (*models.User, er
 		log.Warningf("Error converting id string %s to object id while searching for user in db: %s", id, err.Error())
 		return nil, err
 	}
-	mongoFilter := bson.D{{Key: "_id", Value: oid}}
+	mongoFilter := bson.D{{Key: "_id", Value: oid}, notDeleted}
 
 	if err := s.usersCollection.FindOne(ctx, mongoFilter).Decode(&user); err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -116,11 +363,29 @@ func (s *MongoStorage) GetUser(ctx context.Context, id string) (*models.User, er
 	return user, nil
 }
 
+func (s *MongoStorage) GetUserByLogin(ctx context.Context, login string) (*models.User, error) {
+	log.Debugf("Searching for user with login %s in db", login)
+	var user *models.User
+
+	mongoFilter := bson.D{{Key: "login", Value: login}, notDeleted}
+	if err := s.usersCollection.FindOne(ctx, mongoFilter).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			log.Warningf("Tried to find in db non-existent user with login %s ", login)
+		} else {
+			log.Errorf("Error searching for user with login %s in db: %s", login, err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Successfully found user with login %s in db: %s", login, user)
+	return user, nil
+}
+
 func (s *MongoStorage) GetAllUsers(ctx context.Context) ([]models.User, error) {
 	log.Debug("Getting all users from db")
 	users := []models.User{}
 
-	mongoFilter := bson.D{{}}
+	mongoFilter := bson.D{notDeleted}
 	cur, err := s.usersCollection.Find(ctx, mongoFilter)
 	if err != nil {
 		log.Errorf("Error finding all users in db: %s", err.Error())
@@ -145,6 +410,11 @@ func (s *MongoStorage) GetAllUsers(ctx context.Context) ([]models.User, error) {
 }
 
 func (s *MongoStorage) DeleteUser(ctx context.Context, id string) error {
+	/*
+	Users are only marked as deleted, they are removed
+	for good by purge after trash retention passes.
+	*/
+
 	log.Debugf("Deleting user with id %s", id)
 
 	oid, err := primitive.ObjectIDFromHex(id)
@@ -152,21 +422,70 @@ func (s *MongoStorage) DeleteUser(ctx context.Context, id string) error {
 		log.Warningf("Error converting id string %s to object id while deleting user from db: %s", id, err.Error())
 		return err
 	}
-	mongoFilter := bson.D{{Key: "_id", Value: oid}}
-	
-	result, err := s.usersCollection.DeleteOne(ctx, mongoFilter)
+	now := time.Now().UTC()
+	mongoFilter := bson.D{{Key: "_id", Value: oid}, notDeleted}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "deletedat", Value: now}}}}
+	updateOpts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		var before models.User
+		if err := s.usersCollection.FindOneAndUpdate(ctx, mongoFilter, update, updateOpts).Decode(&before); err != nil {
+			if err == mongo.ErrNoDocuments {
+				log.Warningf("Tried to delete from db non-existent user with id %s ", id)
+			} else {
+				log.Errorf("Error deleting user with id %s from db: %s", id, err.Error())
+			}
+			return err
+		}
+		user := before
+		user.DeletedAt = &now
+
+		return s.recordChange(ctx, "user.delete", models.AuditResourceUser, id, &before, &user)
+	})
 	if err != nil {
-		log.Errorf("Error deleting user with id %s from db: %s", id, err.Error())
 		return err
-	} else if result.DeletedCount < 1 {
-		log.Warningf("Tried to delete from db non-existent user with id %s ", id)
-		return mongo.ErrNoDocuments
 	}
 
 	log.Debugf("Successfully deleted user with id %s from db", id)
 	return nil
 }
 
+func (s *MongoStorage) RestoreUser(ctx context.Context, id string) error {
+	log.Debugf("Restoring user with id %s", id)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while restoring user in db: %s", id, err.Error())
+		return err
+	}
+	mongoFilter := bson.D{{Key: "_id", Value: oid}, deleted}
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "deletedat", Value: ""}}}}
+	updateOpts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		var before models.User
+		if err := s.usersCollection.FindOneAndUpdate(ctx, mongoFilter, update, updateOpts).Decode(&before); err != nil {
+			if err == mongo.ErrNoDocuments {
+				log.Warningf("Tried to restore in db non-existent or not deleted user with id %s ", id)
+			} else {
+				log.Errorf("Error restoring user with id %s in db: %s", id, err.Error())
+			}
+			return err
+		}
+
+		user := before
+		user.DeletedAt = nil
+
+		return s.recordChange(ctx, "user.restore", models.AuditResourceUser, id, &before, &user)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Successfully restored user with id %s in db", id)
+	return nil
+}
+
 func (s *MongoStorage) UpdateUser(ctx context.Context, user *models.User) error {
 	log.Debugf("Updating user with id %s: %s", user.Id, user)
 
@@ -184,35 +503,58 @@ func (s *MongoStorage) UpdateUser(ctx context.Context, user *models.User) error
 			{Key: "indexes", Value: user.Indexes},
 		}},
 	}
+	updateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	return s.withTransaction(ctx, func(ctx context.Context) error {
+		var before, updatedUser models.User
+		mongoFilter := bson.D{{Key: "_id", Value: oid}, notDeleted}
+		if err := s.usersCollection.FindOne(ctx, mongoFilter).Decode(&before); err != nil {
+			if err == mongo.ErrNoDocuments {
+				log.Warningf("Tried to update in db non-existent user with id %s ", user.Id)
+			}
+			return err
+		}
 
-	result, err := s.usersCollection.UpdateByID(ctx, oid, update)
-	if err != nil {
-		return err
-	} else if result.MatchedCount < 1 {
-		log.Warningf("Tried to update in db non-existent user with id %s ", user.Id)
-		return mongo.ErrNoDocuments
-	}
+		err := s.usersCollection.FindOneAndUpdate(ctx, mongoFilter, update, updateOpts).Decode(&updatedUser)
+		if err == mongo.ErrNoDocuments {
+			log.Warningf("Tried to update in db non-existent user with id %s ", user.Id)
+			return err
+		} else if mongo.IsDuplicateKeyError(err) {
+			log.Warningf("Tried to update user with id %s to already taken login %s in db", user.Id, user.Login)
+			return ErrDuplicateLogin
+		} else if err != nil {
+			return err
+		}
 
-	return nil
+		return s.recordChange(ctx, "user.update", models.AuditResourceUser, user.Id, &before, &updatedUser)
+	})
 }
 
 func (s *MongoStorage) CreateFilter(ctx context.Context, filter *models.Filter) (*models.Filter, error) {
 	log.Debugf("Inserting filter %s to db", filter)
 
-	result, err := s.filtersCollection.InsertOne(ctx, filter)
+	err := s.withTransaction(ctx, func(ctx context.Context) error {
+		filter.Id = ""
+		result, err := s.filtersCollection.InsertOne(ctx, filter)
+		if err != nil {
+			log.Errorf("Error inserting filter %s to db: %s", filter, err.Error())
+			return err
+		}
+
+		id, ok := getOid(result.InsertedID)
+		if !ok {
+			log.Errorf("Unable to get oid from interface returned by db after trying to insert filter %s", filter)
+			return errors.New("db did not return object id")
+		}
+
+		filter.Id = id
+
+		return s.recordChange(ctx, "filter.create", models.AuditResourceFilter, id, nil, filter)
+	})
 	if err != nil {
-		log.Errorf("Error inserting filter %s to db: %s", filter, err.Error())
 		return nil, err
 	}
 
-	id, ok := getOid(result.InsertedID)
-	if !ok {
-		log.Errorf("Unable to get oid from interface returned by db after trying to insert filter %s", filter)
-		return nil, errors.New("db did not return object id")
-	}
-
-	filter.Id = id
-
 	log.Debugf("Successfully inserted filter %s to db", filter)
 	return filter, nil
 }
@@ -221,7 +563,7 @@ func (s *MongoStorage) GetAllFilters(ctx context.Context) ([]models.Filter, erro
 	log.Debug("Getting all filters from db")
 	filters := []models.Filter{}
 
-	mongoFilter := bson.D{{}}
+	mongoFilter := bson.D{notDeleted}
 	cur, err := s.filtersCollection.Find(ctx, mongoFilter)
 	if err != nil {
 		log.Errorf("Error finding all filters in db: %s", err.Error())
@@ -253,21 +595,70 @@ func (s *MongoStorage) DeleteFilter(ctx context.Context, id string) error {
 		log.Warningf("Error converting id string %s to object id while deleting filter from db: %s", id, err.Error())
 		return err
 	}
-	mongoFilter := bson.D{{Key: "_id", Value: oid}}
-	
-	result, err := s.filtersCollection.DeleteOne(ctx, mongoFilter)
+	now := time.Now().UTC()
+	mongoFilter := bson.D{{Key: "_id", Value: oid}, notDeleted}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "deletedat", Value: now}}}}
+	updateOpts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		var before models.Filter
+		if err := s.filtersCollection.FindOneAndUpdate(ctx, mongoFilter, update, updateOpts).Decode(&before); err != nil {
+			if err == mongo.ErrNoDocuments {
+				log.Warningf("Tried to delete from db non-existent filter with id %s ", id)
+			} else {
+				log.Errorf("Error deleting filter with id %s from db: %s", id, err.Error())
+			}
+			return err
+		}
+		filter := before
+		filter.DeletedAt = &now
+
+		return s.recordChange(ctx, "filter.delete", models.AuditResourceFilter, id, &before, &filter)
+	})
 	if err != nil {
-		log.Errorf("Error deleting filter with id %s from db: %s", id, err.Error())
 		return err
-	} else if result.DeletedCount < 1 {
-		log.Warningf("Tried to delete from db non-existent filter with id %s ", id)
-		return mongo.ErrNoDocuments
 	}
 
 	log.Debugf("Successfully deleted filter with id %s from db", id)
 	return nil
 }
 
+func (s *MongoStorage) RestoreFilter(ctx context.Context, id string) error {
+	log.Debugf("Restoring filter with id %s", id)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while restoring filter in db: %s", id, err.Error())
+		return err
+	}
+	mongoFilter := bson.D{{Key: "_id", Value: oid}, deleted}
+	update := bson.D{{Key: "$unset", Value: bson.D{{Key: "deletedat", Value: ""}}}}
+	updateOpts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		var before models.Filter
+		if err := s.filtersCollection.FindOneAndUpdate(ctx, mongoFilter, update, updateOpts).Decode(&before); err != nil {
+			if err == mongo.ErrNoDocuments {
+				log.Warningf("Tried to restore in db non-existent or not deleted filter with id %s ", id)
+			} else {
+				log.Errorf("Error restoring filter with id %s in db: %s", id, err.Error())
+			}
+			return err
+		}
+
+		filter := before
+		filter.DeletedAt = nil
+
+		return s.recordChange(ctx, "filter.restore", models.AuditResourceFilter, id, &before, &filter)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Successfully restored filter with id %s in db", id)
+	return nil
+}
+
 func (s *MongoStorage) GetFilter(ctx context.Context, id string) (*models.Filter, error) {
 	log.Debugf("Searching for filter with id %s in db", id)
 	var filter *models.Filter
@@ -277,7 +668,7 @@ func (s *MongoStorage) GetFilter(ctx context.Context, id string) (*models.Filter
 		log.Warningf("Error converting id string %s to object id while searching for filter in db: %s", id, err.Error())
 		return nil, err
 	}
-	mongoFilter := bson.D{{Key: "_id", Value: oid}}
+	mongoFilter := bson.D{{Key: "_id", Value: oid}, notDeleted}
 
 	if err := s.filtersCollection.FindOne(ctx, mongoFilter).Decode(&filter); err != nil {
 		if err == mongo.ErrNoDocuments {
@@ -290,4 +681,114 @@ func (s *MongoStorage) GetFilter(ctx context.Context, id string) (*models.Filter
 
 	log.Debugf("Successfully found filter with id %s in db: %s", id, filter)
 	return filter, nil
+}
+
+func (s *MongoStorage) UpdateFilter(ctx context.Context, filter *models.Filter) error {
+	/*
+	Archived filter is only unarchived when update moves its end
+	into the future, otherwise it stays archived as it was and
+	filter's archived state is set to the stored one.
+	*/
+
+	log.Debugf("Updating filter with id %s: %s", filter.Id, filter)
+
+	oid, err := primitive.ObjectIDFromHex(filter.Id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while updating filter in db: %s", filter.Id, err.Error())
+		return err
+	}
+
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "regex", Value: filter.Regex},
+			{Key: "fields", Value: filter.Fields},
+			{Key: "action", Value: filter.Action},
+			{Key: "tag", Value: filter.Tag},
+			{Key: "replacement", Value: filter.Replacement},
+			{Key: "priority", Value: filter.Priority},
+			{Key: "stopprocessing", Value: filter.StopProcessing},
+			{Key: "mode", Value: filter.Mode},
+			{Key: "rolloutpercentage", Value: filter.RolloutPercentage},
+			{Key: "activefrom", Value: filter.ActiveFrom},
+			{Key: "activeuntil", Value: filter.ActiveUntil},
+		}},
+	}
+	if !filter.IsExpired(time.Now()) {
+		update = append(update, bson.E{Key: "$unset", Value: bson.D{{Key: "archivedat", Value: ""}}})
+	}
+
+	updateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		var before, updatedFilter models.Filter
+		mongoFilter := bson.D{{Key: "_id", Value: oid}, notDeleted}
+		if err := s.filtersCollection.FindOne(ctx, mongoFilter).Decode(&before); err != nil {
+			if err == mongo.ErrNoDocuments {
+				log.Warningf("Tried to update in db non-existent filter with id %s ", filter.Id)
+			} else {
+				log.Errorf("Error updating filter with id %s in db: %s", filter.Id, err.Error())
+			}
+			return err
+		}
+
+		err := s.filtersCollection.FindOneAndUpdate(ctx, mongoFilter, update, updateOpts).Decode(&updatedFilter)
+		if err == mongo.ErrNoDocuments {
+			log.Warningf("Tried to update in db non-existent filter with id %s ", filter.Id)
+			return err
+		} else if err != nil {
+			log.Errorf("Error updating filter with id %s in db: %s", filter.Id, err.Error())
+			return err
+		}
+		filter.ArchivedAt = updatedFilter.ArchivedAt
+
+		return s.recordChange(ctx, "filter.update", models.AuditResourceFilter, filter.Id, &before, &updatedFilter)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Debugf("Successfully updated filter with id %s in db", filter.Id)
+	return nil
+}
+
+func (s *MongoStorage) ArchiveExpiredFilters(ctx context.Context, now time.Time) ([]models.Filter, error) {
+	/*
+	Filters are archived one by one with findOneAndUpdate,
+	so when several instances sweep at the same time
+	every filter is archived and reported only once.
+	*/
+
+	log.Debugf("Archiving filters expired before %s in db", now)
+	archived := []models.Filter{}
+
+	mongoFilter := bson.D{
+		{Key: "activeuntil", Value: bson.D{{Key: "$lte", Value: now}}},
+		{Key: "archivedat", Value: bson.D{{Key: "$exists", Value: false}}},
+		notDeleted,
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{{Key: "archivedat", Value: now}}},
+	}
+	updateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	for {
+		var filter models.Filter
+		err := s.withTransaction(ctx, func(ctx context.Context) error {
+			if err := s.filtersCollection.FindOneAndUpdate(ctx, mongoFilter, update, updateOpts).Decode(&filter); err != nil {
+				return err
+			}
+
+			return s.recordChange(ctx, "filter.archive", models.AuditResourceFilter, filter.Id, nil, &filter)
+		})
+		if err == mongo.ErrNoDocuments {
+			break
+		} else if err != nil {
+			log.Errorf("Error archiving expired filters in db: %s", err.Error())
+			return archived, err
+		}
+		archived = append(archived, filter)
+	}
+
+	log.Debugf("Successfully archived %d expired filters in db", len(archived))
+	return archived, nil
 }
\ No newline at end of file
@@ -0,0 +1,203 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrDuplicateLogin = errors.New("login is already taken")
+
+func (s *MongoStorage) CreateAdmin(ctx context.Context, admin *models.Admin) (*models.Admin, error) {
+	log.Debugf("Inserting admin %s to db", admin)
+
+	result, err := s.adminsCollection.InsertOne(ctx, admin)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			log.Warningf("Tried to insert admin with already taken login %s to db", admin.Login)
+			return nil, ErrDuplicateLogin
+		}
+		log.Errorf("Error inserting admin %s to db: %s", admin, err.Error())
+		return nil, err
+	}
+
+	id, ok := getOid(result.InsertedID)
+	if !ok {
+		log.Errorf("Unable to get oid from interface returned by db after trying to insert admin %s", admin)
+		return nil, errors.New("db did not return object id")
+	}
+
+	admin.Id = id
+
+	log.Debugf("Successfully inserted admin %s to db", admin)
+	return admin, nil
+}
+
+func (s *MongoStorage) GetAllAdmins(ctx context.Context) ([]models.Admin, error) {
+	log.Debug("Getting all admins from db")
+	admins := []models.Admin{}
+
+	cur, err := s.adminsCollection.Find(ctx, bson.D{{}})
+	if err != nil {
+		log.Errorf("Error finding all admins in db: %s", err.Error())
+		return admins, err
+	}
+
+	if err = cur.All(ctx, &admins); err != nil {
+		log.Errorf("Error iterating and decoding all admins from db: %s", err.Error())
+		return admins, err
+	}
+
+	log.Debug("Successfully got all admins from db")
+	return admins, nil
+}
+
+func (s *MongoStorage) GetAdmin(ctx context.Context, id string) (*models.Admin, error) {
+	log.Debugf("Searching for admin with id %s in db", id)
+	var admin *models.Admin
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while searching for admin in db: %s", id, err.Error())
+		return nil, err
+	}
+	mongoFilter := bson.D{{Key: "_id", Value: oid}}
+
+	if err := s.adminsCollection.FindOne(ctx, mongoFilter).Decode(&admin); err != nil {
+		if err == mongo.ErrNoDocuments {
+			log.Warningf("Tried to find in db non-existent admin with id %s ", id)
+		} else {
+			log.Errorf("Error searching for admin with id %s in db: %s", id, err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Successfully found admin with id %s in db: %s", id, admin)
+	return admin, nil
+}
+
+func (s *MongoStorage) GetAdminByLogin(ctx context.Context, login string) (*models.Admin, error) {
+	log.Debugf("Searching for admin with login %s in db", login)
+	var admin *models.Admin
+
+	mongoFilter := bson.D{{Key: "login", Value: login}}
+	if err := s.adminsCollection.FindOne(ctx, mongoFilter).Decode(&admin); err != nil {
+		if err == mongo.ErrNoDocuments {
+			log.Warningf("Tried to find in db non-existent admin with login %s ", login)
+		} else {
+			log.Errorf("Error searching for admin with login %s in db: %s", login, err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Successfully found admin with login %s in db", login)
+	return admin, nil
+}
+
+func (s *MongoStorage) DeleteAdmin(ctx context.Context, id string) error {
+	log.Debugf("Deleting admin with id %s", id)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while deleting admin from db: %s", id, err.Error())
+		return err
+	}
+	mongoFilter := bson.D{{Key: "_id", Value: oid}}
+
+	result, err := s.adminsCollection.DeleteOne(ctx, mongoFilter)
+	if err != nil {
+		log.Errorf("Error deleting admin with id %s from db: %s", id, err.Error())
+		return err
+	} else if result.DeletedCount < 1 {
+		log.Warningf("Tried to delete from db non-existent admin with id %s ", id)
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debugf("Successfully deleted admin with id %s from db", id)
+	return nil
+}
+
+func (s *MongoStorage) CreateSession(ctx context.Context, session *models.Session) (*models.Session, error) {
+	log.Debugf("Inserting session of admin %s to db", session.Login)
+
+	result, err := s.sessionsCollection.InsertOne(ctx, session)
+	if err != nil {
+		log.Errorf("Error inserting session of admin %s to db: %s", session.Login, err.Error())
+		return nil, err
+	}
+
+	id, ok := getOid(result.InsertedID)
+	if !ok {
+		log.Errorf("Unable to get oid from interface returned by db after trying to insert session of admin %s", session.Login)
+		return nil, errors.New("db did not return object id")
+	}
+
+	session.Id = id
+
+	log.Debugf("Successfully inserted session %s of admin %s to db", session.Id, session.Login)
+	return session, nil
+}
+
+func (s *MongoStorage) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	log.Debug("Searching for session by token hash in db")
+	var session *models.Session
+
+	mongoFilter := bson.D{{Key: "tokenhash", Value: tokenHash}}
+	if err := s.sessionsCollection.FindOne(ctx, mongoFilter).Decode(&session); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Errorf("Error searching for session by token hash in db: %s", err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Successfully found session %s of admin %s in db", session.Id, session.Login)
+	return session, nil
+}
+
+func (s *MongoStorage) RevokeSession(ctx context.Context, id string, now time.Time) error {
+	log.Debugf("Revoking session with id %s", id)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while revoking session in db: %s", id, err.Error())
+		return err
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revokedat", Value: now}}}}
+	result, err := s.sessionsCollection.UpdateByID(ctx, oid, update)
+	if err != nil {
+		log.Errorf("Error revoking session with id %s in db: %s", id, err.Error())
+		return err
+	} else if result.MatchedCount < 1 {
+		log.Warningf("Tried to revoke in db non-existent session with id %s ", id)
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debugf("Successfully revoked session with id %s in db", id)
+	return nil
+}
+
+func (s *MongoStorage) RevokeAdminSessions(ctx context.Context, adminId string, now time.Time) (int64, error) {
+	log.Debugf("Revoking all sessions of admin with id %s", adminId)
+
+	mongoFilter := bson.D{
+		{Key: "adminid", Value: adminId},
+		{Key: "revokedat", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revokedat", Value: now}}}}
+
+	result, err := s.sessionsCollection.UpdateMany(ctx, mongoFilter, update)
+	if err != nil {
+		log.Errorf("Error revoking sessions of admin with id %s in db: %s", adminId, err.Error())
+		return 0, err
+	}
+
+	log.Debugf("Successfully revoked %d sessions of admin with id %s in db", result.ModifiedCount, adminId)
+	return result.ModifiedCount, nil
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (s *MongoStorage) CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	log.Debugf("Inserting api key %s of user %s to db", key.Prefix, key.UserId)
+
+	result, err := s.apiKeysCollection.InsertOne(ctx, key)
+	if err != nil {
+		log.Errorf("Error inserting api key %s of user %s to db: %s", key.Prefix, key.UserId, err.Error())
+		return nil, err
+	}
+
+	id, ok := getOid(result.InsertedID)
+	if !ok {
+		log.Errorf("Unable to get oid from interface returned by db after trying to insert api key %s", key.Prefix)
+		return nil, errors.New("db did not return object id")
+	}
+
+	key.Id = id
+
+	log.Debugf("Successfully inserted api key %s of user %s to db", key.Prefix, key.UserId)
+	return key, nil
+}
+
+func (s *MongoStorage) GetAPIKeys(ctx context.Context, userId string) ([]models.APIKey, error) {
+	log.Debugf("Getting api keys of user %s from db", userId)
+	keys := []models.APIKey{}
+
+	mongoFilter := bson.D{{Key: "userid", Value: userId}}
+	cur, err := s.apiKeysCollection.Find(ctx, mongoFilter)
+	if err != nil {
+		log.Errorf("Error finding api keys of user %s in db: %s", userId, err.Error())
+		return keys, err
+	}
+
+	if err = cur.All(ctx, &keys); err != nil {
+		log.Errorf("Error iterating and decoding api keys of user %s from db: %s", userId, err.Error())
+		return keys, err
+	}
+
+	log.Debugf("Successfully got api keys of user %s from db", userId)
+	return keys, nil
+}
+
+func (s *MongoStorage) GetAPIKey(ctx context.Context, userId string, id string) (*models.APIKey, error) {
+	log.Debugf("Searching for api key with id %s of user %s in db", id, userId)
+	var key *models.APIKey
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while searching for api key in db: %s", id, err.Error())
+		return nil, err
+	}
+	mongoFilter := bson.D{{Key: "_id", Value: oid}, {Key: "userid", Value: userId}}
+
+	if err := s.apiKeysCollection.FindOne(ctx, mongoFilter).Decode(&key); err != nil {
+		if err == mongo.ErrNoDocuments {
+			log.Warningf("Tried to find in db non-existent api key with id %s of user %s", id, userId)
+		} else {
+			log.Errorf("Error searching for api key with id %s in db: %s", id, err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Successfully found api key with id %s of user %s in db", id, userId)
+	return key, nil
+}
+
+func (s *MongoStorage) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	log.Debugf("Searching for api key with prefix %s in db", prefix)
+	var key *models.APIKey
+
+	mongoFilter := bson.D{{Key: "prefix", Value: prefix}}
+	if err := s.apiKeysCollection.FindOne(ctx, mongoFilter).Decode(&key); err != nil {
+		if err == mongo.ErrNoDocuments {
+			log.Warningf("Tried to find in db non-existent api key with prefix %s", prefix)
+		} else {
+			log.Errorf("Error searching for api key with prefix %s in db: %s", prefix, err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Successfully found api key with prefix %s in db", prefix)
+	return key, nil
+}
+
+func (s *MongoStorage) RevokeAPIKey(ctx context.Context, userId string, id string, now time.Time) error {
+	log.Debugf("Revoking api key with id %s of user %s", id, userId)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while revoking api key in db: %s", id, err.Error())
+		return err
+	}
+
+	return s.revokeAPIKey(ctx, oid, userId, now)
+}
+
+func (s *MongoStorage) revokeAPIKey(ctx context.Context, oid primitive.ObjectID, userId string, now time.Time) error {
+	mongoFilter := bson.D{
+		{Key: "_id", Value: oid},
+		{Key: "userid", Value: userId},
+		{Key: "revokedat", Value: bson.D{{Key: "$exists", Value: false}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "revokedat", Value: now}}}}
+
+	result, err := s.apiKeysCollection.UpdateOne(ctx, mongoFilter, update)
+	if err != nil {
+		log.Errorf("Error revoking api key with id %s in db: %s", oid.Hex(), err.Error())
+		return err
+	} else if result.MatchedCount < 1 {
+		log.Warningf("Tried to revoke in db non-existent or already revoked api key with id %s of user %s", oid.Hex(), userId)
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debugf("Successfully revoked api key with id %s of user %s in db", oid.Hex(), userId)
+	return nil
+}
+
+func (s *MongoStorage) RotateAPIKey(ctx context.Context, oldKey *models.APIKey, newKey *models.APIKey, now time.Time) (*models.APIKey, error) {
+	/*
+	Old key is revoked and new one is inserted in one transaction,
+	so there is never a moment without a valid key or with two of them.
+	*/
+
+	log.Debugf("Rotating api key with id %s of user %s", oldKey.Id, oldKey.UserId)
+
+	oid, err := primitive.ObjectIDFromHex(oldKey.Id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while rotating api key in db: %s", oldKey.Id, err.Error())
+		return nil, err
+	}
+
+	err = s.withTransaction(ctx, func(ctx context.Context) error {
+		if err := s.revokeAPIKey(ctx, oid, oldKey.UserId, now); err != nil {
+			return err
+		}
+
+		newKey.Id = ""
+		if _, err := s.CreateAPIKey(ctx, newKey); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully rotated api key with id %s of user %s in db", oldKey.Id, oldKey.UserId)
+	return newKey, nil
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStorage) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	log.Debugf("Inserting audit event %s on %s %s to db", event.Action, event.ResourceType, event.ResourceId)
+
+	if _, err := s.auditCollection.InsertOne(ctx, event); err != nil {
+		log.Errorf("Error inserting audit event %s on %s %s to db: %s", event.Action, event.ResourceType, event.ResourceId, err.Error())
+		return err
+	}
+
+	log.Debugf("Successfully inserted audit event %s on %s %s to db", event.Action, event.ResourceType, event.ResourceId)
+	return nil
+}
+
+func (s *MongoStorage) GetAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	log.Debugf("Getting audit events from db with query %+v", query)
+	events := []models.AuditEvent{}
+
+	mongoFilter := bson.D{}
+	if query.ResourceType != "" {
+		mongoFilter = append(mongoFilter, bson.E{Key: "resourcetype", Value: query.ResourceType})
+	}
+	if query.ResourceId != "" {
+		mongoFilter = append(mongoFilter, bson.E{Key: "resourceid", Value: query.ResourceId})
+	}
+	if query.Actor != "" {
+		mongoFilter = append(mongoFilter, bson.E{Key: "actor", Value: query.Actor})
+	}
+	timeFilter := bson.D{}
+	if !query.From.IsZero() {
+		timeFilter = append(timeFilter, bson.E{Key: "$gte", Value: query.From})
+	}
+	if !query.To.IsZero() {
+		timeFilter = append(timeFilter, bson.E{Key: "$lt", Value: query.To})
+	}
+	if len(timeFilter) > 0 {
+		mongoFilter = append(mongoFilter, bson.E{Key: "time", Value: timeFilter})
+	}
+
+	findOpts := options.Find().SetSort(bson.D{{Key: "time", Value: -1}}).SetLimit(query.Limit)
+	cur, err := s.auditCollection.Find(ctx, mongoFilter, findOpts)
+	if err != nil {
+		log.Errorf("Error finding audit events in db: %s", err.Error())
+		return events, err
+	}
+
+	if err = cur.All(ctx, &events); err != nil {
+		log.Errorf("Error iterating and decoding audit events from db: %s", err.Error())
+		return events, err
+	}
+
+	log.Debugf("Successfully got %d audit events from db", len(events))
+	return events, nil
+}
@@ -0,0 +1,468 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrTransactionsUnsupported	= errors.New("db deployment does not support transactions")
+	ErrBulkOperationSkipped		= errors.New("bulk operation was not applied")
+	errBulkWriteAborted			= errors.New("atomic bulk write aborted")
+)
+
+type bulkOperation struct {
+	op		string
+	oid		primitive.ObjectID
+	model	mongo.WriteModel
+	err		error
+}
+
+type bulkOutcome struct {
+	before	bson.Raw
+	after	bson.Raw
+	err		error
+}
+
+func (s *MongoStorage) bulkWrite(ctx context.Context, collection *mongo.Collection, operations []bulkOperation, ordered bool, atomic bool, record func(ctx context.Context, i int, before bson.Raw, after bson.Raw) error) ([]bulkOutcome, error) {
+	/*
+	Documents to update and delete are looked up beforehand to tell which
+	of them don't exist. Ordered writes stop at the first failed operation
+	and atomic ones don't write anything if any operation fails, operations
+	that were not applied are reported as skipped. Every applied operation
+	is recorded with record, atomic writes record them in the same
+	transaction as writes.
+	*/
+
+	if atomic && !s.transactions {
+		return nil, ErrTransactionsUnsupported
+	}
+
+	outcomes := make([]bulkOutcome, len(operations))
+
+	oids := []primitive.ObjectID{}
+	for _, operation := range operations {
+		if operation.op != models.BulkOperationCreate && operation.err == nil {
+			oids = append(oids, operation.oid)
+		}
+	}
+	existing, err := findRawByOids(ctx, collection, oids, true)
+	if err != nil {
+		return nil, err
+	}
+
+	skip := func(from int) {
+		for i := from; i < len(outcomes); i++ {
+			if outcomes[i].err == nil {
+				outcomes[i].err = ErrBulkOperationSkipped
+			}
+		}
+	}
+
+	writeIndexes := []int{}
+	for i, operation := range operations {
+		err := operation.err
+		if err == nil && operation.op != models.BulkOperationCreate {
+			if before, ok := existing[operation.oid]; ok {
+				outcomes[i].before = before
+			} else {
+				err = mongo.ErrNoDocuments
+			}
+		}
+		if err != nil {
+			outcomes[i].err = err
+			if atomic {
+				skip(0)
+				return outcomes, errBulkWriteAborted
+			}
+			if ordered {
+				skip(i + 1)
+				break
+			}
+			continue
+		}
+
+		writeIndexes = append(writeIndexes, i)
+	}
+
+	if atomic {
+		return outcomes, s.bulkWriteAtomic(ctx, collection, operations, outcomes, writeIndexes, record)
+	}
+
+	return outcomes, s.bulkWriteNonAtomic(ctx, collection, operations, outcomes, writeIndexes, ordered, record)
+}
+
+func (s *MongoStorage) bulkWriteNonAtomic(ctx context.Context, collection *mongo.Collection, operations []bulkOperation, outcomes []bulkOutcome, writeIndexes []int, ordered bool, record func(ctx context.Context, i int, before bson.Raw, after bson.Raw) error) error {
+	/*
+	All operations are written by a single bulk write outside of
+	transaction, so failed operations don't undo the rest. Changes
+	of applied operations are recorded in one transaction after
+	the write and may be lost if db fails in between, only atomic
+	writes record changes in the same transaction as writes.
+	*/
+
+	if len(writeIndexes) == 0 {
+		return nil
+	}
+
+	writes := []mongo.WriteModel{}
+	for _, i := range writeIndexes {
+		writes = append(writes, operations[i].model)
+	}
+
+	_, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(ordered))
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		failed := len(writeIndexes)
+		for _, writeErr := range bulkErr.WriteErrors {
+			log.Errorf("Error applying bulk operation %d in db: %s", writeIndexes[writeErr.Index], writeErr.Error())
+			outcomes[writeIndexes[writeErr.Index]].err = writeErr
+			if writeErr.Index < failed {
+				failed = writeErr.Index
+			}
+		}
+		if ordered {
+			for _, i := range writeIndexes[failed:] {
+				if outcomes[i].err == nil {
+					outcomes[i].err = ErrBulkOperationSkipped
+				}
+			}
+		}
+	} else if err != nil {
+		log.Errorf("Error executing bulk write in db: %s", err.Error())
+		return err
+	}
+
+	/*
+	Documents deleted concurrently after they were looked up
+	are not matched by updates, such operations are not applied.
+	*/
+	applied := []int{}
+	oids := []primitive.ObjectID{}
+	for _, i := range writeIndexes {
+		if outcomes[i].err == nil {
+			applied = append(applied, i)
+			oids = append(oids, operations[i].oid)
+		}
+	}
+	written, err := findRawByOids(ctx, collection, oids, false)
+	if err != nil {
+		return err
+	}
+	for _, i := range applied {
+		after, ok := written[operations[i].oid]
+		if !ok {
+			outcomes[i].err = mongo.ErrNoDocuments
+			continue
+		}
+		if _, err := after.LookupErr("deletedat"); err == nil && operations[i].op != models.BulkOperationDelete {
+			outcomes[i].err = mongo.ErrNoDocuments
+			continue
+		}
+		outcomes[i].after = after
+	}
+
+	return s.withTransaction(ctx, func(ctx context.Context) error {
+		for _, i := range applied {
+			if outcomes[i].err != nil {
+				continue
+			}
+			if err := record(ctx, i, outcomes[i].before, outcomes[i].after); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *MongoStorage) bulkWriteAtomic(ctx context.Context, collection *mongo.Collection, operations []bulkOperation, outcomes []bulkOutcome, writeIndexes []int, record func(ctx context.Context, i int, before bson.Raw, after bson.Raw) error) error {
+	/*
+	All operations are written by a single bulk write in one transaction,
+	any failed operation aborts it and the rest are reported as skipped.
+	*/
+
+	skipped := func() {
+		for i := range outcomes {
+			outcomes[i].after = nil
+			if outcomes[i].err == nil {
+				outcomes[i].err = ErrBulkOperationSkipped
+			}
+		}
+	}
+
+	return s.withTransaction(ctx, func(ctx context.Context) error {
+		for _, i := range writeIndexes {
+			outcomes[i].after = nil
+			outcomes[i].err = nil
+		}
+
+		writes := []mongo.WriteModel{}
+		for _, i := range writeIndexes {
+			writes = append(writes, operations[i].model)
+		}
+
+		if len(writes) > 0 {
+			_, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(true))
+			var bulkErr mongo.BulkWriteException
+			if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+				for _, writeErr := range bulkErr.WriteErrors {
+					outcomes[writeIndexes[writeErr.Index]].err = writeErr
+				}
+				skipped()
+				return errBulkWriteAborted
+			} else if err != nil {
+				log.Errorf("Error executing bulk write in db: %s", err.Error())
+				return err
+			}
+		}
+
+		oids := []primitive.ObjectID{}
+		for _, i := range writeIndexes {
+			oids = append(oids, operations[i].oid)
+		}
+		written, err := findRawByOids(ctx, collection, oids, false)
+		if err != nil {
+			return err
+		}
+		for _, i := range writeIndexes {
+			outcomes[i].after = written[operations[i].oid]
+			if err := record(ctx, i, outcomes[i].before, outcomes[i].after); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func findRawByOids(ctx context.Context, collection *mongo.Collection, oids []primitive.ObjectID, onlyNotDeleted bool) (map[primitive.ObjectID]bson.Raw, error) {
+	documents := map[primitive.ObjectID]bson.Raw{}
+	if len(oids) == 0 {
+		return documents, nil
+	}
+
+	mongoFilter := bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: oids}}}}
+	if onlyNotDeleted {
+		mongoFilter = append(mongoFilter, notDeleted)
+	}
+	cur, err := collection.Find(ctx, mongoFilter)
+	if err != nil {
+		log.Errorf("Error finding documents of bulk write in db: %s", err.Error())
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		oid, ok := cur.Current.Lookup("_id").ObjectIDOK()
+		if !ok {
+			continue
+		}
+		documents[oid] = bson.Raw(append([]byte{}, cur.Current...))
+	}
+	if err := cur.Err(); err != nil {
+		log.Errorf("Error iterating documents of bulk write from db: %s", err.Error())
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+func (s *MongoStorage) BulkWriteUsers(ctx context.Context, operations []models.UserBulkOperation, ordered bool, atomic bool) ([]models.UserBulkResult, error) {
+	log.Debugf("Bulk writing %d users to db, ordered: %t, atomic: %t", len(operations), ordered, atomic)
+
+	now := time.Now().UTC()
+	writes := make([]bulkOperation, len(operations))
+	for i, operation := range operations {
+		writes[i].op = operation.Op
+		if operation.Op == models.BulkOperationCreate {
+			/*
+			Bulk write doesn't return ids of inserted documents,
+			new users are upserted by ids generated here instead.
+			*/
+			user := *operation.User
+			user.Id = ""
+			user.DeletedAt = nil
+			writes[i].oid = primitive.NewObjectID()
+			writes[i].model = mongo.NewReplaceOneModel().SetFilter(bson.D{{Key: "_id", Value: writes[i].oid}}).SetReplacement(user).SetUpsert(true)
+			continue
+		}
+
+		oid, err := primitive.ObjectIDFromHex(operation.Id)
+		if err != nil {
+			log.Warningf("Error converting id string %s to object id while bulk writing users to db: %s", operation.Id, err.Error())
+			writes[i].err = err
+			continue
+		}
+		writes[i].oid = oid
+
+		mongoFilter := bson.D{{Key: "_id", Value: oid}, notDeleted}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "deletedat", Value: now}}}}
+		if operation.Op == models.BulkOperationUpdate {
+			update = bson.D{{Key: "$set", Value: bson.D{
+				{Key: "login", Value: operation.User.Login},
+				{Key: "password", Value: operation.User.Password},
+				{Key: "indexlimit", Value: operation.User.IndexLimit},
+				{Key: "indexes", Value: operation.User.Indexes},
+			}}}
+		}
+		writes[i].model = mongo.NewUpdateOneModel().SetFilter(mongoFilter).SetUpdate(update)
+	}
+
+	outcomes, err := s.bulkWrite(ctx, s.usersCollection, writes, ordered, atomic, func(ctx context.Context, i int, before bson.Raw, after bson.Raw) error {
+		var previous *models.User
+		if before != nil {
+			if err := bson.Unmarshal(before, &previous); err != nil {
+				return err
+			}
+		}
+		var user models.User
+		if err := bson.Unmarshal(after, &user); err != nil {
+			return err
+		}
+
+		return s.recordChange(ctx, "user." + writes[i].op, models.AuditResourceUser, user.Id, previous, &user)
+	})
+	aborted := errors.Is(err, errBulkWriteAborted)
+	if err != nil && !aborted {
+		log.Errorf("Error bulk writing users to db: %s", err.Error())
+		return nil, err
+	}
+
+	/*
+	Operations may already be applied here, so a document
+	that can't be decoded only fails its own result.
+	*/
+	results := make([]models.UserBulkResult, len(outcomes))
+	for i, outcome := range outcomes {
+		results[i].Err = outcome.err
+		if mongo.IsDuplicateKeyError(outcome.err) {
+			results[i].Err = ErrDuplicateLogin
+		}
+		if outcome.before != nil {
+			if err := bson.Unmarshal(outcome.before, &results[i].Before); err != nil {
+				results[i].Err = err
+			}
+		}
+		if outcome.after != nil {
+			if err := bson.Unmarshal(outcome.after, &results[i].After); err != nil {
+				results[i].Err = err
+			}
+		}
+	}
+
+	if aborted {
+		log.Warning("Atomic bulk write of users aborted, no users were written to db")
+		return results, nil
+	}
+
+	log.Debugf("Successfully bulk wrote %d users to db", len(operations))
+	return results, nil
+}
+
+func (s *MongoStorage) BulkWriteFilters(ctx context.Context, operations []models.FilterBulkOperation, ordered bool, atomic bool) ([]models.FilterBulkResult, error) {
+	log.Debugf("Bulk writing %d filters to db, ordered: %t, atomic: %t", len(operations), ordered, atomic)
+
+	now := time.Now().UTC()
+	writes := make([]bulkOperation, len(operations))
+	for i, operation := range operations {
+		writes[i].op = operation.Op
+		if operation.Op == models.BulkOperationCreate {
+			filter := *operation.Filter
+			filter.Id = ""
+			filter.ArchivedAt = nil
+			filter.DeletedAt = nil
+			writes[i].oid = primitive.NewObjectID()
+			writes[i].model = mongo.NewReplaceOneModel().SetFilter(bson.D{{Key: "_id", Value: writes[i].oid}}).SetReplacement(filter).SetUpsert(true)
+			continue
+		}
+
+		oid, err := primitive.ObjectIDFromHex(operation.Id)
+		if err != nil {
+			log.Warningf("Error converting id string %s to object id while bulk writing filters to db: %s", operation.Id, err.Error())
+			writes[i].err = err
+			continue
+		}
+		writes[i].oid = oid
+
+		mongoFilter := bson.D{{Key: "_id", Value: oid}, notDeleted}
+		update := bson.D{{Key: "$set", Value: bson.D{{Key: "deletedat", Value: now}}}}
+		if operation.Op == models.BulkOperationUpdate {
+			filter := operation.Filter
+			update = bson.D{
+				{Key: "$set", Value: bson.D{
+					{Key: "regex", Value: filter.Regex},
+					{Key: "fields", Value: filter.Fields},
+					{Key: "action", Value: filter.Action},
+					{Key: "tag", Value: filter.Tag},
+					{Key: "replacement", Value: filter.Replacement},
+					{Key: "priority", Value: filter.Priority},
+					{Key: "stopprocessing", Value: filter.StopProcessing},
+					{Key: "mode", Value: filter.Mode},
+					{Key: "rolloutpercentage", Value: filter.RolloutPercentage},
+					{Key: "activefrom", Value: filter.ActiveFrom},
+					{Key: "activeuntil", Value: filter.ActiveUntil},
+				}},
+			}
+			if !filter.IsExpired(now) {
+				update = append(update, bson.E{Key: "$unset", Value: bson.D{{Key: "archivedat", Value: ""}}})
+			}
+		}
+		writes[i].model = mongo.NewUpdateOneModel().SetFilter(mongoFilter).SetUpdate(update)
+	}
+
+	outcomes, err := s.bulkWrite(ctx, s.filtersCollection, writes, ordered, atomic, func(ctx context.Context, i int, before bson.Raw, after bson.Raw) error {
+		var previous *models.Filter
+		if before != nil {
+			if err := bson.Unmarshal(before, &previous); err != nil {
+				return err
+			}
+		}
+		var filter models.Filter
+		if err := bson.Unmarshal(after, &filter); err != nil {
+			return err
+		}
+
+		return s.recordChange(ctx, "filter." + writes[i].op, models.AuditResourceFilter, filter.Id, previous, &filter)
+	})
+	aborted := errors.Is(err, errBulkWriteAborted)
+	if err != nil && !aborted {
+		log.Errorf("Error bulk writing filters to db: %s", err.Error())
+		return nil, err
+	}
+
+	/*
+	Operations may already be applied here, so a document
+	that can't be decoded only fails its own result.
+	*/
+	results := make([]models.FilterBulkResult, len(outcomes))
+	for i, outcome := range outcomes {
+		results[i].Err = outcome.err
+		if outcome.before != nil {
+			if err := bson.Unmarshal(outcome.before, &results[i].Before); err != nil {
+				results[i].Err = err
+			}
+		}
+		if outcome.after != nil {
+			if err := bson.Unmarshal(outcome.after, &results[i].After); err != nil {
+				results[i].Err = err
+			}
+		}
+	}
+
+	if aborted {
+		log.Warning("Atomic bulk write of filters aborted, no filters were written to db")
+		return results, nil
+	}
+
+	log.Debugf("Successfully bulk wrote %d filters to db", len(operations))
+	return results, nil
+}
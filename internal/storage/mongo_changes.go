@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/audit"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const changesCounter = "changes"
+
+// changesRetention is how long changes are kept for consumers to catch up
+const changesRetention = 30 * 24 * time.Hour
+
+var ErrChangesCursorExpired = errors.New("changes after cursor are no longer retained")
+
+func (s *MongoStorage) nextSequence(ctx context.Context, name string) (int64, error) {
+	var counter struct {
+		Seq	int64	`bson:"seq"`
+	}
+
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "seq", Value: 1}}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := s.countersCollection.FindOneAndUpdate(ctx, bson.D{{Key: "_id", Value: name}}, update, opts).Decode(&counter)
+	if err != nil {
+		log.Errorf("Error incrementing %s counter in db: %s", name, err.Error())
+		return 0, err
+	}
+
+	return counter.Seq, nil
+}
+
+func (s *MongoStorage) recordChange(ctx context.Context, eventType string, resourceType string, resourceId string, before any, data any) error {
+	/*
+	Must be called with the context of the transaction making the change.
+	Concurrent transactions conflict on the counter document, so they
+	commit in sequence order and a reader never sees a gap that is
+	filled later. Standalone deployments don't give this guarantee,
+	a change with lower sequence may be inserted after a reader has
+	moved past it, NewMongoStorage warns about it at startup.
+	Changes made with audit origin in context are audited as well,
+	changes made by background jobs have none and aren't audited.
+	*/
+
+	seq, err := s.nextSequence(ctx, changesCounter)
+	if err != nil {
+		return err
+	}
+
+	_, operation, _ := strings.Cut(eventType, ".")
+	change := models.ChangeRecord{
+		Seq: 			seq,
+		ResourceType: 	resourceType,
+		ResourceId: 	resourceId,
+		Operation: 		operation,
+		State: 			audit.Redact(data),
+		Time: 			time.Now().UTC(),
+	}
+	if _, err := s.changesCollection.InsertOne(ctx, change); err != nil {
+		log.Errorf("Error inserting change %d of %s %s to db: %s", seq, resourceType, resourceId, err.Error())
+		return err
+	}
+
+	if err := s.recordOutboxEvent(ctx, eventType, resourceType, resourceId, data); err != nil {
+		return err
+	}
+
+	if origin, ok := audit.OriginFromContext(ctx); ok {
+		event := origin.Event(eventType, resourceType, resourceId, before, data)
+		return s.RecordAuditEvent(ctx, &event)
+	}
+
+	return nil
+}
+
+func (s *MongoStorage) GetChanges(ctx context.Context, since int64, limit int64) ([]models.ChangeRecord, error) {
+	/*
+	Changes older than retention are removed, consumer whose cursor
+	is before the oldest kept change would silently miss some of them.
+	*/
+
+	log.Debugf("Getting %d changes after %d from db", limit, since)
+	changes := []models.ChangeRecord{}
+
+	if since > 0 {
+		var oldest models.ChangeRecord
+		findOneOpts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: 1}})
+		err := s.changesCollection.FindOne(ctx, bson.D{}, findOneOpts).Decode(&oldest)
+		if err != nil && err != mongo.ErrNoDocuments {
+			log.Errorf("Error finding oldest change in db: %s", err.Error())
+			return changes, err
+		} else if err == nil && oldest.Seq > since + 1 {
+			log.Warningf("Changes after %d are no longer retained in db, oldest change is %d", since, oldest.Seq)
+			return changes, ErrChangesCursorExpired
+		}
+	}
+
+	mongoFilter := bson.D{{Key: "seq", Value: bson.D{{Key: "$gt", Value: since}}}}
+	findOpts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}).SetLimit(limit)
+	cur, err := s.changesCollection.Find(ctx, mongoFilter, findOpts)
+	if err != nil {
+		log.Errorf("Error finding changes in db: %s", err.Error())
+		return changes, err
+	}
+
+	if err = cur.All(ctx, &changes); err != nil {
+		log.Errorf("Error iterating and decoding changes from db: %s", err.Error())
+		return changes, err
+	}
+
+	log.Debugf("Successfully got %d changes from db", len(changes))
+	return changes, nil
+}
+
+func (s *MongoStorage) GetRecentChanges(ctx context.Context, limit int64) ([]models.ChangeRecord, error) {
+	log.Debugf("Getting %d most recent changes from db", limit)
+	changes := []models.ChangeRecord{}
+
+	findOpts := options.Find().SetSort(bson.D{{Key: "seq", Value: -1}}).SetLimit(limit)
+	cur, err := s.changesCollection.Find(ctx, bson.D{}, findOpts)
+	if err != nil {
+		log.Errorf("Error finding recent changes in db: %s", err.Error())
+		return changes, err
+	}
+
+	if err = cur.All(ctx, &changes); err != nil {
+		log.Errorf("Error iterating and decoding recent changes from db: %s", err.Error())
+		return changes, err
+	}
+
+	for i, j := 0, len(changes) - 1; i < j; i, j = i + 1, j - 1 {
+		changes[i], changes[j] = changes[j], changes[i]
+	}
+
+	log.Debugf("Successfully got %d recent changes from db", len(changes))
+	return changes, nil
+}
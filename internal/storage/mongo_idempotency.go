@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrDuplicateIdempotencyKey = errors.New("idempotency key is already used")
+
+func (s *MongoStorage) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	/*
+	Key is the id of the record, so of concurrent requests with the same key
+	only one is able to insert it, whichever server instance handles them.
+	Ttl monitor removes expired records about once a minute, expired records
+	it has not removed yet are replaced.
+	*/
+
+	log.Debug("Inserting idempotency record to db")
+
+	_, err := s.idempotencyCollection.InsertOne(ctx, record)
+	if err == nil {
+		log.Debug("Successfully inserted idempotency record to db")
+		return nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		log.Errorf("Error inserting idempotency record to db: %s", err.Error())
+		return err
+	}
+
+	mongoFilter := bson.D{
+		{Key: "_id", Value: record.Key},
+		{Key: "expiresat", Value: bson.D{{Key: "$lte", Value: record.CreatedAt}}},
+	}
+	result, err := s.idempotencyCollection.ReplaceOne(ctx, mongoFilter, record)
+	if err != nil {
+		log.Errorf("Error replacing expired idempotency record in db: %s", err.Error())
+		return err
+	} else if result.MatchedCount < 1 {
+		log.Debug("Idempotency record with such key already exists in db")
+		return ErrDuplicateIdempotencyKey
+	}
+
+	log.Debug("Successfully replaced expired idempotency record in db")
+	return nil
+}
+
+func (s *MongoStorage) GetIdempotencyRecord(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	log.Debug("Searching for idempotency record in db")
+	var record *models.IdempotencyRecord
+
+	mongoFilter := bson.D{{Key: "_id", Value: key}}
+	if err := s.idempotencyCollection.FindOne(ctx, mongoFilter).Decode(&record); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Errorf("Error searching for idempotency record in db: %s", err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debug("Successfully found idempotency record in db")
+	return record, nil
+}
+
+func (s *MongoStorage) RenewIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord, expiresAt time.Time) error {
+	log.Debug("Renewing idempotency record in db")
+
+	mongoFilter := bson.D{
+		{Key: "_id", Value: record.Key},
+		{Key: "fingerprint", Value: record.Fingerprint},
+		{Key: "status", Value: models.IdempotencyStatusProcessing},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "expiresat", Value: expiresAt}}}}
+	result, err := s.idempotencyCollection.UpdateOne(ctx, mongoFilter, update)
+	if err != nil {
+		log.Errorf("Error renewing idempotency record in db: %s", err.Error())
+		return err
+	} else if result.MatchedCount < 1 {
+		log.Warning("Tried to renew in db non-existent idempotency record")
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debug("Successfully renewed idempotency record in db")
+	return nil
+}
+
+func (s *MongoStorage) CompleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	log.Debug("Completing idempotency record in db")
+
+	mongoFilter := bson.D{
+		{Key: "_id", Value: record.Key},
+		{Key: "fingerprint", Value: record.Fingerprint},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: models.IdempotencyStatusCompleted},
+		{Key: "statuscode", Value: record.StatusCode},
+		{Key: "body", Value: record.Body},
+		{Key: "expiresat", Value: record.ExpiresAt},
+	}}}
+	result, err := s.idempotencyCollection.UpdateOne(ctx, mongoFilter, update)
+	if err != nil {
+		log.Errorf("Error completing idempotency record in db: %s", err.Error())
+		return err
+	} else if result.MatchedCount < 1 {
+		log.Warning("Tried to complete in db non-existent idempotency record")
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debug("Successfully completed idempotency record in db")
+	return nil
+}
+
+func (s *MongoStorage) DeleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	log.Debug("Deleting idempotency record from db")
+
+	mongoFilter := bson.D{
+		{Key: "_id", Value: record.Key},
+		{Key: "fingerprint", Value: record.Fingerprint},
+		{Key: "status", Value: models.IdempotencyStatusProcessing},
+	}
+	if _, err := s.idempotencyCollection.DeleteOne(ctx, mongoFilter); err != nil {
+		log.Errorf("Error deleting idempotency record from db: %s", err.Error())
+		return err
+	}
+
+	log.Debug("Successfully deleted idempotency record from db")
+	return nil
+}
@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStorage) ImportFilters(ctx context.Context, filters []models.Filter, replace bool) error {
+	/*
+	Filters with id are upserted so they keep their ids between environments,
+	filters without id are inserted. In replace mode all filters missing
+	from the import are moved to trash, and imported filters that were
+	in trash are restored. Everything is applied in one transaction,
+	standalone deployments can't run one, so import is refused there
+	instead of leaving filters half imported when it fails midway.
+	*/
+
+	log.Debugf("Importing %d filters to db, replace: %t", len(filters), replace)
+
+	if !s.transactions {
+		log.Warning("Refusing to import filters, db deployment does not support transactions")
+		return ErrTransactionsUnsupported
+	}
+
+	return s.withTransaction(ctx, func(ctx context.Context) error {
+		importedOids := []primitive.ObjectID{}
+
+		for _, filter := range filters {
+			filter.DeletedAt = nil
+			if filter.Id == "" {
+				result, err := s.filtersCollection.InsertOne(ctx, filter)
+				if err != nil {
+					log.Errorf("Error inserting imported filter %s to db: %s", &filter, err.Error())
+					return err
+				}
+				oid, ok := result.InsertedID.(primitive.ObjectID)
+				if !ok {
+					log.Errorf("Unable to get oid from interface returned by db after trying to insert imported filter %s", &filter)
+					return errors.New("db did not return object id")
+				}
+				importedOids = append(importedOids, oid)
+				filter.Id = oid.Hex()
+				if err := s.recordChange(ctx, "filter.create", models.AuditResourceFilter, filter.Id, nil, &filter); err != nil {
+					return err
+				}
+				continue
+			}
+
+			oid, err := primitive.ObjectIDFromHex(filter.Id)
+			if err != nil {
+				log.Warningf("Error converting id string %s to object id while importing filter to db: %s", filter.Id, err.Error())
+				return err
+			}
+
+			replacement := filter
+			replacement.Id = ""
+			mongoFilter := bson.D{{Key: "_id", Value: oid}}
+			replaceOpts := options.FindOneAndReplace().SetUpsert(true).SetReturnDocument(options.Before)
+			var before *models.Filter
+			err = s.filtersCollection.FindOneAndReplace(ctx, mongoFilter, replacement, replaceOpts).Decode(&before)
+			if err != nil && err != mongo.ErrNoDocuments {
+				log.Errorf("Error upserting imported filter %s to db: %s", &filter, err.Error())
+				return err
+			}
+			importedOids = append(importedOids, oid)
+			eventType := "filter.update"
+			if before == nil {
+				eventType = "filter.create"
+			}
+			if err := s.recordChange(ctx, eventType, models.AuditResourceFilter, filter.Id, before, &filter); err != nil {
+				return err
+			}
+		}
+
+		if replace {
+			mongoFilter := bson.D{{Key: "_id", Value: bson.D{{Key: "$nin", Value: importedOids}}}, notDeleted}
+			cur, err := s.filtersCollection.Find(ctx, mongoFilter)
+			if err != nil {
+				log.Errorf("Error finding filters missing from import in db: %s", err.Error())
+				return err
+			}
+			missing := []models.Filter{}
+			if err := cur.All(ctx, &missing); err != nil {
+				log.Errorf("Error iterating and decoding filters missing from import from db: %s", err.Error())
+				return err
+			}
+
+			now := time.Now().UTC()
+			missingOids := []primitive.ObjectID{}
+			for _, filter := range missing {
+				oid, _ := primitive.ObjectIDFromHex(filter.Id)
+				missingOids = append(missingOids, oid)
+			}
+			update := bson.D{{Key: "$set", Value: bson.D{{Key: "deletedat", Value: now}}}}
+			result, err := s.filtersCollection.UpdateMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: missingOids}}}}, update)
+			if err != nil {
+				log.Errorf("Error deleting filters missing from import from db: %s", err.Error())
+				return err
+			}
+			for _, filter := range missing {
+				before := filter
+				filter.DeletedAt = &now
+				if err := s.recordChange(ctx, "filter.delete", models.AuditResourceFilter, filter.Id, &before, &filter); err != nil {
+					return err
+				}
+			}
+			log.Debugf("Deleted %d filters missing from import from db", result.ModifiedCount)
+		}
+
+		log.Debugf("Successfully imported %d filters to db", len(filters))
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStorage) GetLoginFailure(ctx context.Context, key string) (*models.LoginFailure, error) {
+	log.Debug("Searching for login failure in db")
+	var failure *models.LoginFailure
+
+	mongoFilter := bson.D{{Key: "_id", Value: key}}
+	if err := s.loginFailuresCollection.FindOne(ctx, mongoFilter).Decode(&failure); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Errorf("Error searching for login failure in db: %s", err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debug("Successfully found login failure in db")
+	return failure, nil
+}
+
+func (s *MongoStorage) RecordLoginFailure(ctx context.Context, key string, now time.Time, resetAt time.Time) error {
+	/*
+	Count is incremented in a single update, so failures from all server
+	instances add up. Failure counted within expired window starts a new one,
+	ttl monitor removes expired failures about once a minute.
+	*/
+
+	log.Debug("Recording login failure in db")
+
+	windowOpen := bson.D{{Key: "$gt", Value: bson.A{"$resetat", now}}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "count", Value: bson.D{{Key: "$cond", Value: bson.A{windowOpen, bson.D{{Key: "$add", Value: bson.A{"$count", 1}}}, 1}}}},
+			{Key: "resetat", Value: bson.D{{Key: "$cond", Value: bson.A{windowOpen, "$resetat", resetAt}}}},
+		}}},
+	}
+	mongoFilter := bson.D{{Key: "_id", Value: key}}
+	if _, err := s.loginFailuresCollection.UpdateOne(ctx, mongoFilter, update, options.Update().SetUpsert(true)); err != nil {
+		log.Errorf("Error recording login failure in db: %s", err.Error())
+		return err
+	}
+
+	log.Debug("Successfully recorded login failure in db")
+	return nil
+}
+
+func (s *MongoStorage) DeleteLoginFailure(ctx context.Context, key string) error {
+	log.Debug("Deleting login failure from db")
+
+	mongoFilter := bson.D{{Key: "_id", Value: key}}
+	if _, err := s.loginFailuresCollection.DeleteOne(ctx, mongoFilter); err != nil {
+		log.Errorf("Error deleting login failure from db: %s", err.Error())
+		return err
+	}
+
+	log.Debug("Successfully deleted login failure from db")
+	return nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/audit"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// outboxRetention is how long delivered outbox events are kept
+const outboxRetention = 7 * 24 * time.Hour
+
+func (s *MongoStorage) recordOutboxEvent(ctx context.Context, eventType string, resourceType string, resourceId string, data any) error {
+	/*
+	Must be called with the context of the transaction making the change,
+	so the event is stored if and only if the change is. Standalone
+	deployments have no transactions, there a change is kept even when
+	its event fails to be stored, so the event is lost.
+	*/
+
+	now := time.Now().UTC()
+	event := models.OutboxEvent{
+		Type: 			eventType,
+		ResourceType: 	resourceType,
+		ResourceId: 	resourceId,
+		Data: 			audit.Redact(data),
+		CreatedAt: 		now,
+		Status: 		models.OutboxEventPending,
+		NextAttemptAt: 	now,
+	}
+
+	if _, err := s.outboxCollection.InsertOne(ctx, event); err != nil {
+		log.Errorf("Error inserting outbox event %s on %s %s to db: %s", eventType, resourceType, resourceId, err.Error())
+		if !s.transactions {
+			log.Errorf("Change %s on %s %s is kept without outbox event, it will not be published", eventType, resourceType, resourceId)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *MongoStorage) ClaimOutboxEvent(ctx context.Context, now time.Time, leaseUntil time.Time) (*models.OutboxEvent, error) {
+	/*
+	Same lease approach as for webhook deliveries, event claimed by
+	an instance that died is picked up again once the lease runs out.
+	*/
+
+	var event *models.OutboxEvent
+
+	mongoFilter := bson.D{
+		{Key: "status", Value: models.OutboxEventPending},
+		{Key: "nextattemptat", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "nextattemptat", Value: leaseUntil}}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextattemptat", Value: 1}, {Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	if err := s.outboxCollection.FindOneAndUpdate(ctx, mongoFilter, update, opts).Decode(&event); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Errorf("Error claiming outbox event in db: %s", err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Claimed outbox event with id %s in db", event.Id)
+	return event, nil
+}
+
+func (s *MongoStorage) UpdateOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	log.Debugf("Updating outbox event with id %s, status %s", event.Id, event.Status)
+
+	oid, err := primitive.ObjectIDFromHex(event.Id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while updating outbox event in db: %s", event.Id, err.Error())
+		return err
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: event.Status},
+		{Key: "attempts", Value: event.Attempts},
+		{Key: "nextattemptat", Value: event.NextAttemptAt},
+		{Key: "deliveredat", Value: event.DeliveredAt},
+		{Key: "lasterror", Value: event.LastError},
+	}}}
+
+	result, err := s.outboxCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: oid}}, update)
+	if err != nil {
+		log.Errorf("Error updating outbox event with id %s in db: %s", event.Id, err.Error())
+		return err
+	} else if result.MatchedCount < 1 {
+		log.Warningf("Tried to update in db non-existent outbox event with id %s ", event.Id)
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debugf("Successfully updated outbox event with id %s in db", event.Id)
+	return nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStorage) GetRoleBinding(ctx context.Context, subject string) (*models.RoleBinding, error) {
+	log.Debugf("Searching for role binding of subject %s in db", subject)
+	var binding *models.RoleBinding
+
+	mongoFilter := bson.D{{Key: "_id", Value: subject}}
+	if err := s.roleBindingsCollection.FindOne(ctx, mongoFilter).Decode(&binding); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Errorf("Error searching for role binding of subject %s in db: %s", subject, err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Successfully found role binding of subject %s in db: %s", subject, binding)
+	return binding, nil
+}
+
+func (s *MongoStorage) GetAllRoleBindings(ctx context.Context) ([]models.RoleBinding, error) {
+	log.Debug("Getting all role bindings from db")
+	bindings := []models.RoleBinding{}
+
+	cur, err := s.roleBindingsCollection.Find(ctx, bson.D{{}})
+	if err != nil {
+		log.Errorf("Error finding all role bindings in db: %s", err.Error())
+		return bindings, err
+	}
+
+	if err = cur.All(ctx, &bindings); err != nil {
+		log.Errorf("Error iterating and decoding all role bindings from db: %s", err.Error())
+		return bindings, err
+	}
+
+	log.Debug("Successfully got all role bindings from db")
+	return bindings, nil
+}
+
+func (s *MongoStorage) SetRoleBinding(ctx context.Context, binding *models.RoleBinding) error {
+	log.Debugf("Setting role binding %s in db", binding)
+
+	mongoFilter := bson.D{{Key: "_id", Value: binding.Subject}}
+	_, err := s.roleBindingsCollection.ReplaceOne(ctx, mongoFilter, binding, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Errorf("Error setting role binding %s in db: %s", binding, err.Error())
+		return err
+	}
+
+	log.Debugf("Successfully set role binding %s in db", binding)
+	return nil
+}
+
+func (s *MongoStorage) DeleteRoleBinding(ctx context.Context, subject string) error {
+	log.Debugf("Deleting role binding of subject %s", subject)
+
+	mongoFilter := bson.D{{Key: "_id", Value: subject}}
+	result, err := s.roleBindingsCollection.DeleteOne(ctx, mongoFilter)
+	if err != nil {
+		log.Errorf("Error deleting role binding of subject %s from db: %s", subject, err.Error())
+		return err
+	} else if result.DeletedCount < 1 {
+		log.Warningf("Tried to delete from db non-existent role binding of subject %s ", subject)
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debugf("Successfully deleted role binding of subject %s from db", subject)
+	return nil
+}
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func (s *MongoStorage) GetSigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	log.Debug("Getting all signing keys from db")
+	keys := []models.SigningKey{}
+
+	cur, err := s.signingKeysCollection.Find(ctx, bson.D{{}})
+	if err != nil {
+		log.Errorf("Error finding all signing keys in db: %s", err.Error())
+		return keys, err
+	}
+
+	if err = cur.All(ctx, &keys); err != nil {
+		log.Errorf("Error iterating and decoding all signing keys from db: %s", err.Error())
+		return keys, err
+	}
+
+	log.Debugf("Successfully got %d signing keys from db", len(keys))
+	return keys, nil
+}
+
+func (s *MongoStorage) CreateSigningKey(ctx context.Context, key *models.SigningKey) error {
+	log.Debugf("Inserting signing key %s to db", key.Id)
+
+	if _, err := s.signingKeysCollection.InsertOne(ctx, key); err != nil {
+		log.Errorf("Error inserting signing key %s to db: %s", key.Id, err.Error())
+		return err
+	}
+
+	log.Debugf("Successfully inserted signing key %s to db", key.Id)
+	return nil
+}
+
+func (s *MongoStorage) DeleteSigningKey(ctx context.Context, id string) error {
+	log.Debugf("Deleting signing key %s", id)
+
+	mongoFilter := bson.D{{Key: "_id", Value: id}}
+	result, err := s.signingKeysCollection.DeleteOne(ctx, mongoFilter)
+	if err != nil {
+		log.Errorf("Error deleting signing key %s from db: %s", id, err.Error())
+		return err
+	} else if result.DeletedCount < 1 {
+		log.Warningf("Tried to delete from db non-existent signing key %s", id)
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debugf("Successfully deleted signing key %s from db", id)
+	return nil
+}
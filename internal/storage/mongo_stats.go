@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Returned with ids of filters that hits were reported for but don't exist in db
+type UnknownFiltersError struct {
+	Ids	[]string
+}
+
+func (e *UnknownFiltersError) Error() string {
+	return fmt.Sprintf("no filters with ids %s", strings.Join(e.Ids, ", "))
+}
+
+func (s *MongoStorage) RecordFilterHits(ctx context.Context, hits []models.FilterHits) error {
+	/*
+	Hits of deleted filters that are still in trash are recorded,
+	consumers may report them after the filter was deleted.
+	*/
+
+	log.Debugf("Recording %d filter hit rollups to db", len(hits))
+
+	if err := s.checkFiltersExist(ctx, hits); err != nil {
+		return err
+	}
+
+	writes := []mongo.WriteModel{}
+	for _, hit := range hits {
+		mongoFilter := bson.D{
+			{Key: "filterid", Value: hit.FilterId},
+			{Key: "bucket", Value: hit.Bucket},
+		}
+		update := bson.D{
+			{Key: "$inc", Value: bson.D{{Key: "hits", Value: hit.Count}}},
+			{Key: "$max", Value: bson.D{{Key: "lasthit", Value: hit.LastHit}}},
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().SetFilter(mongoFilter).SetUpdate(update).SetUpsert(true))
+	}
+
+	/*
+	Concurrent upserts of the same new bucket race to insert it,
+	losers fail on unique index and are retried as updates of
+	the inserted bucket, so no hits are lost.
+	*/
+	const maxAttempts = 3
+	for attempt := 1; ; attempt++ {
+		_, err := s.filterStatsCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if err == nil {
+			break
+		}
+		if attempt == maxAttempts || !isOnlyDuplicateKeyError(err) {
+			log.Errorf("Error recording filter hit rollups to db: %s", err.Error())
+			return err
+		}
+
+		var bulkErr mongo.BulkWriteException
+		errors.As(err, &bulkErr)
+		retried := []mongo.WriteModel{}
+		for _, writeErr := range bulkErr.WriteErrors {
+			retried = append(retried, writes[writeErr.Index])
+		}
+		log.Debugf("Retrying %d filter hit rollups that raced with concurrent inserts", len(retried))
+		writes = retried
+	}
+
+	log.Debugf("Successfully recorded %d filter hit rollups to db", len(hits))
+	return nil
+}
+
+func (s *MongoStorage) checkFiltersExist(ctx context.Context, hits []models.FilterHits) error {
+	ids := []string{}
+	found := map[string]bool{}
+	oids := []primitive.ObjectID{}
+	for _, hit := range hits {
+		if _, ok := found[hit.FilterId]; ok {
+			continue
+		}
+		found[hit.FilterId] = false
+		ids = append(ids, hit.FilterId)
+		oid, err := primitive.ObjectIDFromHex(hit.FilterId)
+		if err != nil {
+			log.Warningf("Error converting id string %s to object id while recording filter hits to db: %s", hit.FilterId, err.Error())
+			continue
+		}
+		oids = append(oids, oid)
+	}
+
+	findOpts := options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}})
+	cur, err := s.filtersCollection.Find(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: oids}}}}, findOpts)
+	if err != nil {
+		log.Errorf("Error finding filters of reported hits in db: %s", err.Error())
+		return err
+	}
+
+	var filters []struct {
+		Id	primitive.ObjectID	`bson:"_id"`
+	}
+	if err = cur.All(ctx, &filters); err != nil {
+		log.Errorf("Error iterating and decoding filters of reported hits from db: %s", err.Error())
+		return err
+	}
+	for _, filter := range filters {
+		found[filter.Id.Hex()] = true
+	}
+
+	unknown := []string{}
+	for _, id := range ids {
+		if !found[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) > 0 {
+		log.Warningf("Tried to record hits of non-existent filters with ids %s", strings.Join(unknown, ", "))
+		return &UnknownFiltersError{Ids: unknown}
+	}
+
+	return nil
+}
+
+func (s *MongoStorage) GetFilterStats(ctx context.Context, id string, from time.Time, to time.Time) ([]models.FilterStatsBucket, error) {
+	log.Debugf("Getting hit stats of filter with id %s from db", id)
+	buckets := []models.FilterStatsBucket{}
+
+	bucketFilter := bson.D{}
+	if !from.IsZero() {
+		bucketFilter = append(bucketFilter, bson.E{Key: "$gte", Value: from})
+	}
+	if !to.IsZero() {
+		bucketFilter = append(bucketFilter, bson.E{Key: "$lt", Value: to})
+	}
+
+	mongoFilter := bson.D{{Key: "filterid", Value: id}}
+	if len(bucketFilter) > 0 {
+		mongoFilter = append(mongoFilter, bson.E{Key: "bucket", Value: bucketFilter})
+	}
+
+	findOpts := options.Find().SetSort(bson.D{{Key: "bucket", Value: 1}})
+	cur, err := s.filterStatsCollection.Find(ctx, mongoFilter, findOpts)
+	if err != nil {
+		log.Errorf("Error finding hit stats of filter with id %s in db: %s", id, err.Error())
+		return buckets, err
+	}
+
+	if err = cur.All(ctx, &buckets); err != nil {
+		log.Errorf("Error iterating and decoding hit stats of filter with id %s from db: %s", id, err.Error())
+		return buckets, err
+	}
+
+	log.Debugf("Successfully got %d hit stats buckets of filter with id %s from db", len(buckets), id)
+	return buckets, nil
+}
+
+func (s *MongoStorage) GetAllFilterStats(ctx context.Context) ([]models.FilterStats, error) {
+	log.Debug("Getting hit stats of all filters from db")
+	stats := []models.FilterStats{}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$filterid"},
+			{Key: "totalhits", Value: bson.D{{Key: "$sum", Value: "$hits"}}},
+			{Key: "lasthit", Value: bson.D{{Key: "$max", Value: "$lasthit"}}},
+		}}},
+	}
+
+	cur, err := s.filterStatsCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Errorf("Error aggregating hit stats of all filters in db: %s", err.Error())
+		return stats, err
+	}
+
+	if err = cur.All(ctx, &stats); err != nil {
+		log.Errorf("Error iterating and decoding hit stats of all filters from db: %s", err.Error())
+		return stats, err
+	}
+
+	log.Debugf("Successfully got hit stats of %d filters from db", len(stats))
+	return stats, nil
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStorage) GetDeletedUsers(ctx context.Context) ([]models.User, error) {
+	log.Debug("Getting deleted users from db")
+	users := []models.User{}
+
+	findOpts := options.Find().SetSort(bson.D{{Key: "deletedat", Value: -1}})
+	cur, err := s.usersCollection.Find(ctx, bson.D{deleted}, findOpts)
+	if err != nil {
+		log.Errorf("Error finding deleted users in db: %s", err.Error())
+		return users, err
+	}
+
+	if err = cur.All(ctx, &users); err != nil {
+		log.Errorf("Error iterating and decoding deleted users from db: %s", err.Error())
+		return users, err
+	}
+
+	log.Debugf("Successfully got %d deleted users from db", len(users))
+	return users, nil
+}
+
+func (s *MongoStorage) GetDeletedFilters(ctx context.Context) ([]models.Filter, error) {
+	log.Debug("Getting deleted filters from db")
+	filters := []models.Filter{}
+
+	findOpts := options.Find().SetSort(bson.D{{Key: "deletedat", Value: -1}})
+	cur, err := s.filtersCollection.Find(ctx, bson.D{deleted}, findOpts)
+	if err != nil {
+		log.Errorf("Error finding deleted filters in db: %s", err.Error())
+		return filters, err
+	}
+
+	if err = cur.All(ctx, &filters); err != nil {
+		log.Errorf("Error iterating and decoding deleted filters from db: %s", err.Error())
+		return filters, err
+	}
+
+	log.Debugf("Successfully got %d deleted filters from db", len(filters))
+	return filters, nil
+}
+
+const purgeBatchSize = 500
+
+func (s *MongoStorage) PurgeDeleted(ctx context.Context, before time.Time) (*models.PurgeResult, error) {
+	/*
+	Data that only makes sense together with purged documents,
+	api keys of users and stats of filters, is purged with them.
+	Documents are purged in batches, each in its own transaction,
+	so large trash doesn't exceed transaction limits, batches
+	purged before a failure stay purged.
+	*/
+
+	log.Debugf("Purging documents deleted before %s from db", before)
+	result := &models.PurgeResult{}
+	mongoFilter := bson.D{{Key: "deletedat", Value: bson.D{{Key: "$lt", Value: before}}}}
+
+	var err error
+	result.Users, err = s.purgeInBatches(ctx, s.usersCollection, mongoFilter, func(ctx context.Context, oids []primitive.ObjectID, ids []string) (int64, error) {
+		if _, err := s.apiKeysCollection.DeleteMany(ctx, bson.D{{Key: "userid", Value: bson.D{{Key: "$in", Value: ids}}}}); err != nil {
+			log.Errorf("Error purging api keys of deleted users from db: %s", err.Error())
+			return 0, err
+		}
+		deleteResult, err := s.usersCollection.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: oids}}}})
+		if err != nil {
+			log.Errorf("Error purging deleted users from db: %s", err.Error())
+			return 0, err
+		}
+		for _, id := range ids {
+			if err := s.recordChange(ctx, "user.purge", models.AuditResourceUser, id, nil, nil); err != nil {
+				return 0, err
+			}
+		}
+
+		return deleteResult.DeletedCount, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.Filters, err = s.purgeInBatches(ctx, s.filtersCollection, mongoFilter, func(ctx context.Context, oids []primitive.ObjectID, ids []string) (int64, error) {
+		if _, err := s.filterStatsCollection.DeleteMany(ctx, bson.D{{Key: "filterid", Value: bson.D{{Key: "$in", Value: ids}}}}); err != nil {
+			log.Errorf("Error purging stats of deleted filters from db: %s", err.Error())
+			return 0, err
+		}
+		deleteResult, err := s.filtersCollection.DeleteMany(ctx, bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: oids}}}})
+		if err != nil {
+			log.Errorf("Error purging deleted filters from db: %s", err.Error())
+			return 0, err
+		}
+		for _, id := range ids {
+			if err := s.recordChange(ctx, "filter.purge", models.AuditResourceFilter, id, nil, nil); err != nil {
+				return 0, err
+			}
+		}
+
+		return deleteResult.DeletedCount, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("Successfully purged %d users and %d filters from db", result.Users, result.Filters)
+	return result, nil
+}
+
+func (s *MongoStorage) purgeInBatches(ctx context.Context, collection *mongo.Collection, mongoFilter bson.D, purge func(ctx context.Context, oids []primitive.ObjectID, ids []string) (int64, error)) (int64, error) {
+	var purged int64
+	for {
+		var batchSize int
+		var batchPurged int64
+		err := s.withTransaction(ctx, func(ctx context.Context) error {
+			findOpts := options.Find().SetProjection(bson.D{{Key: "_id", Value: 1}}).SetLimit(purgeBatchSize)
+			cur, err := collection.Find(ctx, mongoFilter, findOpts)
+			if err != nil {
+				log.Errorf("Error finding documents to purge in db: %s", err.Error())
+				return err
+			}
+
+			var documents []struct {
+				Id	primitive.ObjectID	`bson:"_id"`
+			}
+			if err = cur.All(ctx, &documents); err != nil {
+				log.Errorf("Error iterating and decoding documents to purge from db: %s", err.Error())
+				return err
+			}
+
+			batchSize = len(documents)
+			if batchSize == 0 {
+				return nil
+			}
+
+			oids := []primitive.ObjectID{}
+			ids := []string{}
+			for _, document := range documents {
+				oids = append(oids, document.Id)
+				ids = append(ids, document.Id.Hex())
+			}
+			batchPurged, err = purge(ctx, oids, ids)
+			return err
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += batchPurged
+		if batchSize < purgeBatchSize {
+			return purged, nil
+		}
+	}
+}
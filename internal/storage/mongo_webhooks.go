@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (s *MongoStorage) CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	log.Debugf("Inserting webhook for %s to db", webhook.URL)
+
+	result, err := s.webhooksCollection.InsertOne(ctx, webhook)
+	if err != nil {
+		log.Errorf("Error inserting webhook for %s to db: %s", webhook.URL, err.Error())
+		return nil, err
+	}
+
+	id, ok := getOid(result.InsertedID)
+	if !ok {
+		log.Errorf("Unable to get oid from interface returned by db after trying to insert webhook for %s", webhook.URL)
+		return nil, errors.New("db did not return object id")
+	}
+
+	webhook.Id = id
+
+	log.Debugf("Successfully inserted webhook for %s to db", webhook.URL)
+	return webhook, nil
+}
+
+func (s *MongoStorage) GetAllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	log.Debug("Getting all webhooks from db")
+	webhooks := []models.Webhook{}
+
+	cur, err := s.webhooksCollection.Find(ctx, bson.D{})
+	if err != nil {
+		log.Errorf("Error finding all webhooks in db: %s", err.Error())
+		return webhooks, err
+	}
+
+	if err = cur.All(ctx, &webhooks); err != nil {
+		log.Errorf("Error iterating and decoding all webhooks from db: %s", err.Error())
+		return webhooks, err
+	}
+
+	log.Debug("Successfully got all webhooks from db")
+	return webhooks, nil
+}
+
+func (s *MongoStorage) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	log.Debugf("Searching for webhook with id %s in db", id)
+	var webhook *models.Webhook
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while searching for webhook in db: %s", id, err.Error())
+		return nil, err
+	}
+	mongoFilter := bson.D{{Key: "_id", Value: oid}}
+
+	if err := s.webhooksCollection.FindOne(ctx, mongoFilter).Decode(&webhook); err != nil {
+		if err == mongo.ErrNoDocuments {
+			log.Warningf("Tried to find in db non-existent webhook with id %s", id)
+		} else {
+			log.Errorf("Error searching for webhook with id %s in db: %s", id, err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Successfully found webhook with id %s in db", id)
+	return webhook, nil
+}
+
+func (s *MongoStorage) DeleteWebhook(ctx context.Context, id string) error {
+	/*
+	Deliveries are removed together with the webhook,
+	they can't be redelivered without it anyway.
+	*/
+
+	log.Debugf("Deleting webhook with id %s", id)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while deleting webhook from db: %s", id, err.Error())
+		return err
+	}
+
+	return s.withTransaction(ctx, func(ctx context.Context) error {
+		result, err := s.webhooksCollection.DeleteOne(ctx, bson.D{{Key: "_id", Value: oid}})
+		if err != nil {
+			log.Errorf("Error deleting webhook with id %s from db: %s", id, err.Error())
+			return err
+		} else if result.DeletedCount < 1 {
+			log.Warningf("Tried to delete from db non-existent webhook with id %s ", id)
+			return mongo.ErrNoDocuments
+		}
+
+		if _, err := s.webhookDeliveriesCollection.DeleteMany(ctx, bson.D{{Key: "webhookid", Value: id}}); err != nil {
+			log.Errorf("Error deleting deliveries of webhook with id %s from db: %s", id, err.Error())
+			return err
+		}
+
+		log.Debugf("Successfully deleted webhook with id %s from db", id)
+		return nil
+	})
+}
+
+func (s *MongoStorage) CreateWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	log.Debugf("Inserting %d webhook deliveries to db", len(deliveries))
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		documents = append(documents, delivery)
+	}
+
+	/*
+	Unordered insert goes on past duplicates, deliveries of an event
+	that was already queued for a webhook are skipped.
+	*/
+	_, err := s.webhookDeliveriesCollection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err != nil && !isOnlyDuplicateKeyError(err) {
+		log.Errorf("Error inserting webhook deliveries to db: %s", err.Error())
+		return err
+	}
+
+	log.Debugf("Successfully inserted %d webhook deliveries to db", len(deliveries))
+	return nil
+}
+
+func (s *MongoStorage) GetWebhookDeliveries(ctx context.Context, webhookId string, limit int64) ([]models.WebhookDelivery, error) {
+	log.Debugf("Getting deliveries of webhook %s from db", webhookId)
+	deliveries := []models.WebhookDelivery{}
+
+	mongoFilter := bson.D{{Key: "webhookid", Value: webhookId}}
+	findOpts := options.Find().SetSort(bson.D{{Key: "createdat", Value: -1}}).SetLimit(limit)
+	cur, err := s.webhookDeliveriesCollection.Find(ctx, mongoFilter, findOpts)
+	if err != nil {
+		log.Errorf("Error finding deliveries of webhook %s in db: %s", webhookId, err.Error())
+		return deliveries, err
+	}
+
+	if err = cur.All(ctx, &deliveries); err != nil {
+		log.Errorf("Error iterating and decoding deliveries of webhook %s from db: %s", webhookId, err.Error())
+		return deliveries, err
+	}
+
+	log.Debugf("Successfully got %d deliveries of webhook %s from db", len(deliveries), webhookId)
+	return deliveries, nil
+}
+
+func (s *MongoStorage) ClaimWebhookDelivery(ctx context.Context, now time.Time, leaseUntil time.Time) (*models.WebhookDelivery, error) {
+	/*
+	Claimed delivery is pushed forward to the end of the lease,
+	so another instance doesn't pick it up while it is being sent,
+	and it is picked up again if this instance dies mid delivery.
+	*/
+
+	var delivery *models.WebhookDelivery
+
+	mongoFilter := bson.D{
+		{Key: "status", Value: models.WebhookDeliveryPending},
+		{Key: "nextattemptat", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{{Key: "nextattemptat", Value: leaseUntil}}}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "nextattemptat", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	if err := s.webhookDeliveriesCollection.FindOneAndUpdate(ctx, mongoFilter, update, opts).Decode(&delivery); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Errorf("Error claiming due webhook delivery in db: %s", err.Error())
+		}
+		return nil, err
+	}
+
+	log.Debugf("Claimed webhook delivery with id %s in db", delivery.Id)
+	return delivery, nil
+}
+
+func (s *MongoStorage) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	log.Debugf("Updating webhook delivery with id %s, status %s", delivery.Id, delivery.Status)
+
+	oid, err := primitive.ObjectIDFromHex(delivery.Id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while updating webhook delivery in db: %s", delivery.Id, err.Error())
+		return err
+	}
+
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: delivery.Status},
+		{Key: "attempts", Value: delivery.Attempts},
+		{Key: "nextattemptat", Value: delivery.NextAttemptAt},
+		{Key: "lastattemptat", Value: delivery.LastAttemptAt},
+		{Key: "laststatuscode", Value: delivery.LastStatusCode},
+		{Key: "lasterror", Value: delivery.LastError},
+	}}}
+
+	result, err := s.webhookDeliveriesCollection.UpdateOne(ctx, bson.D{{Key: "_id", Value: oid}}, update)
+	if err != nil {
+		log.Errorf("Error updating webhook delivery with id %s in db: %s", delivery.Id, err.Error())
+		return err
+	} else if result.MatchedCount < 1 {
+		log.Warningf("Tried to update in db non-existent webhook delivery with id %s ", delivery.Id)
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debugf("Successfully updated webhook delivery with id %s in db", delivery.Id)
+	return nil
+}
+
+func (s *MongoStorage) RedeliverWebhookDelivery(ctx context.Context, webhookId string, id string, now time.Time) error {
+	log.Debugf("Scheduling redelivery of webhook delivery with id %s", id)
+
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Warningf("Error converting id string %s to object id while scheduling webhook redelivery in db: %s", id, err.Error())
+		return err
+	}
+	mongoFilter := bson.D{{Key: "_id", Value: oid}, {Key: "webhookid", Value: webhookId}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		{Key: "status", Value: models.WebhookDeliveryPending},
+		{Key: "attempts", Value: 0},
+		{Key: "nextattemptat", Value: now},
+	}}}
+
+	result, err := s.webhookDeliveriesCollection.UpdateOne(ctx, mongoFilter, update)
+	if err != nil {
+		log.Errorf("Error scheduling redelivery of webhook delivery with id %s in db: %s", id, err.Error())
+		return err
+	} else if result.MatchedCount < 1 {
+		log.Warningf("Tried to redeliver non-existent delivery with id %s of webhook %s", id, webhookId)
+		return mongo.ErrNoDocuments
+	}
+
+	log.Debugf("Successfully scheduled redelivery of webhook delivery with id %s in db", id)
+	return nil
+}
+
+func isOnlyDuplicateKeyError(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return false
+	}
+
+	for _, writeErr := range bulkErr.WriteErrors {
+		if !mongo.IsDuplicateKeyError(writeErr) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/xavesen/search-admin/internal/models"
 )
@@ -10,10 +11,69 @@ type Storage interface{
 	CreateUser(ctx context.Context, user *models.User) (*models.User, error)
 	GetAllUsers(ctx context.Context) ([]models.User, error)
 	GetUser(ctx context.Context, id string) (*models.User, error)
+	GetUserByLogin(ctx context.Context, login string) (*models.User, error)
 	DeleteUser(ctx context.Context, id string) error
+	RestoreUser(ctx context.Context, id string) error
+	GetDeletedUsers(ctx context.Context) ([]models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
 	CreateFilter(ctx context.Context, filter *models.Filter) (*models.Filter, error)
 	GetAllFilters(ctx context.Context) ([]models.Filter, error)
 	DeleteFilter(ctx context.Context, id string) error
+	RestoreFilter(ctx context.Context, id string) error
+	GetDeletedFilters(ctx context.Context) ([]models.Filter, error)
 	GetFilter(ctx context.Context, id string) (*models.Filter, error)
+	UpdateFilter(ctx context.Context, filter *models.Filter) error
+	ImportFilters(ctx context.Context, filters []models.Filter, replace bool) error
+	BulkWriteUsers(ctx context.Context, operations []models.UserBulkOperation, ordered bool, atomic bool) ([]models.UserBulkResult, error)
+	BulkWriteFilters(ctx context.Context, operations []models.FilterBulkOperation, ordered bool, atomic bool) ([]models.FilterBulkResult, error)
+	ArchiveExpiredFilters(ctx context.Context, now time.Time) ([]models.Filter, error)
+	RecordFilterHits(ctx context.Context, hits []models.FilterHits) error
+	GetFilterStats(ctx context.Context, id string, from time.Time, to time.Time) ([]models.FilterStatsBucket, error)
+	GetAllFilterStats(ctx context.Context) ([]models.FilterStats, error)
+	GetRoleBinding(ctx context.Context, subject string) (*models.RoleBinding, error)
+	GetAllRoleBindings(ctx context.Context) ([]models.RoleBinding, error)
+	SetRoleBinding(ctx context.Context, binding *models.RoleBinding) error
+	DeleteRoleBinding(ctx context.Context, subject string) error
+	CreateAdmin(ctx context.Context, admin *models.Admin) (*models.Admin, error)
+	GetAllAdmins(ctx context.Context) ([]models.Admin, error)
+	GetAdmin(ctx context.Context, id string) (*models.Admin, error)
+	GetAdminByLogin(ctx context.Context, login string) (*models.Admin, error)
+	DeleteAdmin(ctx context.Context, id string) error
+	CreateSession(ctx context.Context, session *models.Session) (*models.Session, error)
+	GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error)
+	RevokeSession(ctx context.Context, id string, now time.Time) error
+	RevokeAdminSessions(ctx context.Context, adminId string, now time.Time) (int64, error)
+	CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error)
+	GetAPIKeys(ctx context.Context, userId string) ([]models.APIKey, error)
+	GetAPIKey(ctx context.Context, userId string, id string) (*models.APIKey, error)
+	GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userId string, id string, now time.Time) error
+	RotateAPIKey(ctx context.Context, oldKey *models.APIKey, newKey *models.APIKey, now time.Time) (*models.APIKey, error)
+	GetSigningKeys(ctx context.Context) ([]models.SigningKey, error)
+	CreateSigningKey(ctx context.Context, key *models.SigningKey) error
+	DeleteSigningKey(ctx context.Context, id string) error
+	RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	GetAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (*models.PurgeResult, error)
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error)
+	GetAllWebhooks(ctx context.Context) ([]models.Webhook, error)
+	GetWebhook(ctx context.Context, id string) (*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, id string) error
+	CreateWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error
+	GetWebhookDeliveries(ctx context.Context, webhookId string, limit int64) ([]models.WebhookDelivery, error)
+	ClaimWebhookDelivery(ctx context.Context, now time.Time, leaseUntil time.Time) (*models.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error
+	RedeliverWebhookDelivery(ctx context.Context, webhookId string, id string, now time.Time) error
+	ClaimOutboxEvent(ctx context.Context, now time.Time, leaseUntil time.Time) (*models.OutboxEvent, error)
+	UpdateOutboxEvent(ctx context.Context, event *models.OutboxEvent) error
+	GetChanges(ctx context.Context, since int64, limit int64) ([]models.ChangeRecord, error)
+	GetRecentChanges(ctx context.Context, limit int64) ([]models.ChangeRecord, error)
+	CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error
+	GetIdempotencyRecord(ctx context.Context, key string) (*models.IdempotencyRecord, error)
+	RenewIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord, expiresAt time.Time) error
+	CompleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error
+	DeleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error
+	GetLoginFailure(ctx context.Context, key string) (*models.LoginFailure, error)
+	RecordLoginFailure(ctx context.Context, key string, now time.Time, resetAt time.Time) error
+	DeleteLoginFailure(ctx context.Context, key string) error
 }
\ No newline at end of file
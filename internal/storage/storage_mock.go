@@ -2,24 +2,71 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"time"
 
+	"github.com/xavesen/search-admin/internal/audit"
 	"github.com/xavesen/search-admin/internal/models"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type StorageMock struct {
-	Error	error
-	Users	[]models.User
-	User 	models.User
-	Filters	[]models.Filter
-	Filter 	models.Filter
+	Error				error
+	Users				[]models.User
+	User				models.User
+	Filters				[]models.Filter
+	Filter				models.Filter
+	FilterStats			[]models.FilterStats
+	FilterStatsBuckets	[]models.FilterStatsBucket
+	RoleBindings		[]models.RoleBinding
+	Admins				[]models.Admin
+	Admin				models.Admin
+	Sessions			[]models.Session
+	APIKeys				[]models.APIKey
+	SigningKeys			[]models.SigningKey
+	AuditEvents			[]models.AuditEvent
+	DeletedUsers		[]models.User
+	DeletedFilters		[]models.Filter
+	Webhooks			[]models.Webhook
+	WebhookDeliveries	[]models.WebhookDelivery
+	OutboxEvents		[]models.OutboxEvent
+	Changes				[]models.ChangeRecord
+	IdempotencyRecords	[]models.IdempotencyRecord
+	LoginFailures		[]models.LoginFailure
+	NoTransactions		bool
+}
+
+// loginTaken tells if any of users other than the one with id has login
+func loginTaken(login string, id string, users ...[]models.User) bool {
+	for _, list := range users {
+		for _, user := range list {
+			if user.Login == login && user.Id != id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// recordChange audits change made with audit origin in ctx, as mongo storage does
+func (s *StorageMock) recordChange(ctx context.Context, eventType string, resourceType string, resourceId string, before any, data any) {
+	if origin, ok := audit.OriginFromContext(ctx); ok {
+		s.AuditEvents = append(s.AuditEvents, origin.Event(eventType, resourceType, resourceId, before, data))
+	}
 }
 
 func (s *StorageMock) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
 	if s.Error != nil {
 		return nil, s.Error
 	}
+	if loginTaken(user.Login, "", s.Users, s.DeletedUsers) {
+		return nil, ErrDuplicateLogin
+	}
 
 	user.Id = "1"
+	s.recordChange(ctx, "user.create", models.AuditResourceUser, user.Id, nil, user)
 
 	return user, nil
 }
@@ -41,11 +88,31 @@ func (s *StorageMock) GetUser(ctx context.Context, id string) (*models.User, err
 }
 
 func (s *StorageMock) DeleteUser(ctx context.Context, id string) error {
-	return s.Error
+	if s.Error != nil {
+		return s.Error
+	}
+
+	before := s.User
+	user := before
+	now := time.Now().UTC()
+	user.DeletedAt = &now
+	s.recordChange(ctx, "user.delete", models.AuditResourceUser, id, &before, &user)
+
+	return nil
 }
 
 func (s *StorageMock) UpdateUser(ctx context.Context, user *models.User) error{
-	return s.Error
+	if s.Error != nil {
+		return s.Error
+	}
+	if loginTaken(user.Login, user.Id, s.Users, s.DeletedUsers) {
+		return ErrDuplicateLogin
+	}
+
+	before := s.User
+	s.recordChange(ctx, "user.update", models.AuditResourceUser, user.Id, &before, user)
+
+	return nil
 }
 
 func (s *StorageMock) CreateFilter(ctx context.Context, filter *models.Filter) (*models.Filter, error) {
@@ -54,6 +121,7 @@ func (s *StorageMock) CreateFilter(ctx context.Context, filter *models.Filter) (
 	}
 
 	filter.Id = "1"
+	s.recordChange(ctx, "filter.create", models.AuditResourceFilter, filter.Id, nil, filter)
 
 	return filter, nil
 }
@@ -67,7 +135,17 @@ func (s *StorageMock) GetAllFilters(ctx context.Context) ([]models.Filter, error
 }
 
 func (s *StorageMock) DeleteFilter(ctx context.Context, id string) error {
-	return s.Error
+	if s.Error != nil {
+		return s.Error
+	}
+
+	before := s.Filter
+	filter := before
+	now := time.Now().UTC()
+	filter.DeletedAt = &now
+	s.recordChange(ctx, "filter.delete", models.AuditResourceFilter, id, &before, &filter)
+
+	return nil
 }
 
 func (s *StorageMock) GetFilter(ctx context.Context, id string) (*models.Filter, error) {
@@ -76,4 +154,889 @@ func (s *StorageMock) GetFilter(ctx context.Context, id string) (*models.Filter,
 	}
 
 	return &s.Filter, nil
-}
\ No newline at end of file
+}
+
+func (s *StorageMock) UpdateFilter(ctx context.Context, filter *models.Filter) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	if filter.IsExpired(time.Now()) {
+		filter.ArchivedAt = s.Filter.ArchivedAt
+	}
+	before := s.Filter
+	s.recordChange(ctx, "filter.update", models.AuditResourceFilter, filter.Id, &before, filter)
+
+	return nil
+}
+
+func (s *StorageMock) ImportFilters(ctx context.Context, filters []models.Filter, replace bool) error {
+	if s.Error != nil {
+		return s.Error
+	}
+	if s.NoTransactions {
+		return ErrTransactionsUnsupported
+	}
+
+	for i := range filters {
+		eventType := "filter.create"
+		for _, existing := range s.Filters {
+			if existing.Id == filters[i].Id {
+				eventType = "filter.update"
+			}
+		}
+		s.recordChange(ctx, eventType, models.AuditResourceFilter, filters[i].Id, nil, &filters[i])
+	}
+
+	return nil
+}
+
+func (s *StorageMock) BulkWriteUsers(ctx context.Context, operations []models.UserBulkOperation, ordered bool, atomic bool) ([]models.UserBulkResult, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	if atomic && s.NoTransactions {
+		return nil, ErrTransactionsUnsupported
+	}
+
+	users := append([]models.User{}, s.Users...)
+	deletedUsers := append([]models.User{}, s.DeletedUsers...)
+	results := make([]models.UserBulkResult, len(operations))
+	failed := false
+	for i, operation := range operations {
+		if failed && ordered {
+			results[i].Err = ErrBulkOperationSkipped
+			continue
+		}
+
+		index := -1
+		for j, user := range users {
+			if user.Id == operation.Id {
+				index = j
+			}
+		}
+
+		switch {
+		case operation.Op != models.BulkOperationDelete && loginTaken(operation.User.Login, operation.Id, users, deletedUsers):
+			results[i].Err = ErrDuplicateLogin
+			failed = true
+		case operation.Op == models.BulkOperationCreate:
+			user := *operation.User
+			user.Id = fmt.Sprintf("%024x", len(users) + len(deletedUsers) + 1)
+			users = append(users, user)
+			results[i].After = &user
+		case index < 0:
+			results[i].Err = mongo.ErrNoDocuments
+			failed = true
+		case operation.Op == models.BulkOperationUpdate:
+			before := users[index]
+			user := *operation.User
+			user.Id = operation.Id
+			users[index] = user
+			results[i].Before = &before
+			results[i].After = &user
+		default:
+			before := users[index]
+			user := before
+			now := time.Now().UTC()
+			user.DeletedAt = &now
+			users = append(users[:index], users[index+1:]...)
+			deletedUsers = append(deletedUsers, user)
+			results[i].Before = &before
+			results[i].After = &user
+		}
+	}
+
+	if atomic && failed {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = models.UserBulkResult{Err: ErrBulkOperationSkipped}
+			}
+		}
+		return results, nil
+	}
+
+	s.Users = users
+	s.DeletedUsers = deletedUsers
+	for i, result := range results {
+		if result.Err == nil {
+			s.recordChange(ctx, "user." + operations[i].Op, models.AuditResourceUser, result.After.Id, result.Before, result.After)
+		}
+	}
+
+	return results, nil
+}
+
+func (s *StorageMock) BulkWriteFilters(ctx context.Context, operations []models.FilterBulkOperation, ordered bool, atomic bool) ([]models.FilterBulkResult, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+	if atomic && s.NoTransactions {
+		return nil, ErrTransactionsUnsupported
+	}
+
+	filters := append([]models.Filter{}, s.Filters...)
+	deletedFilters := append([]models.Filter{}, s.DeletedFilters...)
+	results := make([]models.FilterBulkResult, len(operations))
+	failed := false
+	for i, operation := range operations {
+		if failed && ordered {
+			results[i].Err = ErrBulkOperationSkipped
+			continue
+		}
+
+		index := -1
+		for j, filter := range filters {
+			if filter.Id == operation.Id {
+				index = j
+			}
+		}
+
+		switch {
+		case operation.Op == models.BulkOperationCreate:
+			filter := *operation.Filter
+			filter.Id = fmt.Sprintf("%024x", len(filters) + len(deletedFilters) + 1)
+			filters = append(filters, filter)
+			results[i].After = &filter
+		case index < 0:
+			results[i].Err = mongo.ErrNoDocuments
+			failed = true
+		case operation.Op == models.BulkOperationUpdate:
+			before := filters[index]
+			filter := *operation.Filter
+			filter.Id = operation.Id
+			filter.ArchivedAt = nil
+			if filter.IsExpired(time.Now()) {
+				filter.ArchivedAt = before.ArchivedAt
+			}
+			filters[index] = filter
+			results[i].Before = &before
+			results[i].After = &filter
+		default:
+			before := filters[index]
+			filter := before
+			now := time.Now().UTC()
+			filter.DeletedAt = &now
+			filters = append(filters[:index], filters[index+1:]...)
+			deletedFilters = append(deletedFilters, filter)
+			results[i].Before = &before
+			results[i].After = &filter
+		}
+	}
+
+	if atomic && failed {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i] = models.FilterBulkResult{Err: ErrBulkOperationSkipped}
+			}
+		}
+		return results, nil
+	}
+
+	s.Filters = filters
+	s.DeletedFilters = deletedFilters
+	for i, result := range results {
+		if result.Err == nil {
+			s.recordChange(ctx, "filter." + operations[i].Op, models.AuditResourceFilter, result.After.Id, result.Before, result.After)
+		}
+	}
+
+	return results, nil
+}
+
+func (s *StorageMock) ArchiveExpiredFilters(ctx context.Context, now time.Time) ([]models.Filter, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.Filters, nil
+}
+
+func (s *StorageMock) RecordFilterHits(ctx context.Context, hits []models.FilterHits) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	unknown := []string{}
+	for _, hit := range hits {
+		known := false
+		for _, filter := range s.Filters {
+			known = known || filter.Id == hit.FilterId
+		}
+		for _, id := range unknown {
+			known = known || id == hit.FilterId
+		}
+		if !known {
+			unknown = append(unknown, hit.FilterId)
+		}
+	}
+	if len(unknown) > 0 {
+		return &UnknownFiltersError{Ids: unknown}
+	}
+
+	return nil
+}
+
+func (s *StorageMock) GetFilterStats(ctx context.Context, id string, from time.Time, to time.Time) ([]models.FilterStatsBucket, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.FilterStatsBuckets, nil
+}
+
+func (s *StorageMock) GetAllFilterStats(ctx context.Context) ([]models.FilterStats, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.FilterStats, nil
+}
+
+func (s *StorageMock) GetRoleBinding(ctx context.Context, subject string) (*models.RoleBinding, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for _, binding := range s.RoleBindings {
+		if binding.Subject == subject {
+			return &binding, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) GetAllRoleBindings(ctx context.Context) ([]models.RoleBinding, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.RoleBindings, nil
+}
+
+func (s *StorageMock) SetRoleBinding(ctx context.Context, binding *models.RoleBinding) error {
+	return s.Error
+}
+
+func (s *StorageMock) DeleteRoleBinding(ctx context.Context, subject string) error {
+	return s.Error
+}
+
+func (s *StorageMock) CreateAdmin(ctx context.Context, admin *models.Admin) (*models.Admin, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	admin.Id = "1"
+
+	return admin, nil
+}
+
+func (s *StorageMock) GetAllAdmins(ctx context.Context) ([]models.Admin, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.Admins, nil
+}
+
+func (s *StorageMock) GetAdmin(ctx context.Context, id string) (*models.Admin, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return &s.Admin, nil
+}
+
+func (s *StorageMock) GetAdminByLogin(ctx context.Context, login string) (*models.Admin, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for _, admin := range s.Admins {
+		if admin.Login == login {
+			return &admin, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) DeleteAdmin(ctx context.Context, id string) error {
+	return s.Error
+}
+
+func (s *StorageMock) CreateSession(ctx context.Context, session *models.Session) (*models.Session, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	session.Id = "1"
+
+	return session, nil
+}
+
+func (s *StorageMock) GetSessionByTokenHash(ctx context.Context, tokenHash string) (*models.Session, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for _, session := range s.Sessions {
+		if session.TokenHash == tokenHash {
+			return &session, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) RevokeSession(ctx context.Context, id string, now time.Time) error {
+	return s.Error
+}
+
+func (s *StorageMock) RevokeAdminSessions(ctx context.Context, adminId string, now time.Time) (int64, error) {
+	if s.Error != nil {
+		return 0, s.Error
+	}
+
+	return int64(len(s.Sessions)), nil
+}
+
+func (s *StorageMock) CreateAPIKey(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	key.Id = "1"
+
+	return key, nil
+}
+
+func (s *StorageMock) GetAPIKeys(ctx context.Context, userId string) ([]models.APIKey, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	keys := []models.APIKey{}
+	for _, key := range s.APIKeys {
+		if key.UserId == userId {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *StorageMock) GetAPIKey(ctx context.Context, userId string, id string) (*models.APIKey, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for _, key := range s.APIKeys {
+		if key.UserId == userId && key.Id == id {
+			return &key, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) GetAPIKeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for _, key := range s.APIKeys {
+		if key.Prefix == prefix {
+			return &key, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) RevokeAPIKey(ctx context.Context, userId string, id string, now time.Time) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	_, err := s.GetAPIKey(ctx, userId, id)
+	return err
+}
+
+func (s *StorageMock) RotateAPIKey(ctx context.Context, oldKey *models.APIKey, newKey *models.APIKey, now time.Time) (*models.APIKey, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	newKey.Id = "2"
+
+	return newKey, nil
+}
+
+func (s *StorageMock) GetUserByLogin(ctx context.Context, login string) (*models.User, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for _, user := range s.Users {
+		if user.Login == login {
+			return &user, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) GetSigningKeys(ctx context.Context) ([]models.SigningKey, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.SigningKeys, nil
+}
+
+func (s *StorageMock) CreateSigningKey(ctx context.Context, key *models.SigningKey) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	s.SigningKeys = append(s.SigningKeys, *key)
+
+	return nil
+}
+
+func (s *StorageMock) DeleteSigningKey(ctx context.Context, id string) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i, key := range s.SigningKeys {
+		if key.Id == id {
+			s.SigningKeys = append(s.SigningKeys[:i], s.SigningKeys[i+1:]...)
+			return nil
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) RecordAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	s.AuditEvents = append(s.AuditEvents, *event)
+
+	return nil
+}
+
+func (s *StorageMock) GetAuditEvents(ctx context.Context, query models.AuditQuery) ([]models.AuditEvent, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.AuditEvents, nil
+}
+func (s *StorageMock) RestoreUser(ctx context.Context, id string) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i, user := range s.DeletedUsers {
+		if user.Id == id {
+			s.DeletedUsers = append(s.DeletedUsers[:i], s.DeletedUsers[i+1:]...)
+			restored := user
+			restored.DeletedAt = nil
+			s.recordChange(ctx, "user.restore", models.AuditResourceUser, id, &user, &restored)
+			return nil
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) GetDeletedUsers(ctx context.Context) ([]models.User, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.DeletedUsers, nil
+}
+
+func (s *StorageMock) RestoreFilter(ctx context.Context, id string) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i, filter := range s.DeletedFilters {
+		if filter.Id == id {
+			s.DeletedFilters = append(s.DeletedFilters[:i], s.DeletedFilters[i+1:]...)
+			restored := filter
+			restored.DeletedAt = nil
+			s.recordChange(ctx, "filter.restore", models.AuditResourceFilter, id, &filter, &restored)
+			return nil
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) GetDeletedFilters(ctx context.Context) ([]models.Filter, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.DeletedFilters, nil
+}
+
+func (s *StorageMock) PurgeDeleted(ctx context.Context, before time.Time) (*models.PurgeResult, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	result := &models.PurgeResult{}
+
+	users := []models.User{}
+	for _, user := range s.DeletedUsers {
+		if user.DeletedAt != nil && user.DeletedAt.Before(before) {
+			result.Users++
+			continue
+		}
+		users = append(users, user)
+	}
+	s.DeletedUsers = users
+
+	filters := []models.Filter{}
+	for _, filter := range s.DeletedFilters {
+		if filter.DeletedAt != nil && filter.DeletedAt.Before(before) {
+			result.Filters++
+			continue
+		}
+		filters = append(filters, filter)
+	}
+	s.DeletedFilters = filters
+
+	return result, nil
+}
+
+func (s *StorageMock) CreateWebhook(ctx context.Context, webhook *models.Webhook) (*models.Webhook, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	webhook.Id = "1"
+	s.Webhooks = append(s.Webhooks, *webhook)
+
+	return webhook, nil
+}
+
+func (s *StorageMock) GetAllWebhooks(ctx context.Context) ([]models.Webhook, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	return s.Webhooks, nil
+}
+
+func (s *StorageMock) GetWebhook(ctx context.Context, id string) (*models.Webhook, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for _, webhook := range s.Webhooks {
+		if webhook.Id == id {
+			return &webhook, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) DeleteWebhook(ctx context.Context, id string) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i, webhook := range s.Webhooks {
+		if webhook.Id == id {
+			s.Webhooks = append(s.Webhooks[:i], s.Webhooks[i+1:]...)
+			return nil
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) CreateWebhookDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for _, delivery := range deliveries {
+		if delivery.Id == "" {
+			delivery.Id = strconv.Itoa(len(s.WebhookDeliveries) + 1)
+		}
+		s.WebhookDeliveries = append(s.WebhookDeliveries, delivery)
+	}
+
+	return nil
+}
+
+func (s *StorageMock) GetWebhookDeliveries(ctx context.Context, webhookId string, limit int64) ([]models.WebhookDelivery, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	for _, delivery := range s.WebhookDeliveries {
+		if delivery.WebhookId == webhookId {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (s *StorageMock) ClaimWebhookDelivery(ctx context.Context, now time.Time, leaseUntil time.Time) (*models.WebhookDelivery, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for i, delivery := range s.WebhookDeliveries {
+		if delivery.Status == models.WebhookDeliveryPending && !delivery.NextAttemptAt.After(now) {
+			s.WebhookDeliveries[i].NextAttemptAt = leaseUntil
+			claimed := s.WebhookDeliveries[i]
+			return &claimed, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) UpdateWebhookDelivery(ctx context.Context, delivery *models.WebhookDelivery) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i := range s.WebhookDeliveries {
+		if s.WebhookDeliveries[i].Id == delivery.Id {
+			s.WebhookDeliveries[i] = *delivery
+			return nil
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) RedeliverWebhookDelivery(ctx context.Context, webhookId string, id string, now time.Time) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i, delivery := range s.WebhookDeliveries {
+		if delivery.Id == id && delivery.WebhookId == webhookId {
+			s.WebhookDeliveries[i].Status = models.WebhookDeliveryPending
+			s.WebhookDeliveries[i].Attempts = 0
+			s.WebhookDeliveries[i].NextAttemptAt = now
+			return nil
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) ClaimOutboxEvent(ctx context.Context, now time.Time, leaseUntil time.Time) (*models.OutboxEvent, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for i, event := range s.OutboxEvents {
+		if event.Status == models.OutboxEventPending && !event.NextAttemptAt.After(now) {
+			s.OutboxEvents[i].NextAttemptAt = leaseUntil
+			claimed := s.OutboxEvents[i]
+			return &claimed, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) UpdateOutboxEvent(ctx context.Context, event *models.OutboxEvent) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i := range s.OutboxEvents {
+		if s.OutboxEvents[i].Id == event.Id {
+			s.OutboxEvents[i] = *event
+			return nil
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) GetChanges(ctx context.Context, since int64, limit int64) ([]models.ChangeRecord, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	changes := []models.ChangeRecord{}
+	if since > 0 && len(s.Changes) > 0 && s.Changes[0].Seq > since + 1 {
+		return changes, ErrChangesCursorExpired
+	}
+	for _, change := range s.Changes {
+		if change.Seq > since && int64(len(changes)) < limit {
+			changes = append(changes, change)
+		}
+	}
+
+	return changes, nil
+}
+
+func (s *StorageMock) GetRecentChanges(ctx context.Context, limit int64) ([]models.ChangeRecord, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	if int64(len(s.Changes)) > limit {
+		return s.Changes[int64(len(s.Changes)) - limit:], nil
+	}
+
+	return s.Changes, nil
+}
+
+func (s *StorageMock) CreateIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i, existing := range s.IdempotencyRecords {
+		if existing.Key == record.Key {
+			if existing.ExpiresAt.After(record.CreatedAt) {
+				return ErrDuplicateIdempotencyKey
+			}
+			s.IdempotencyRecords[i] = *record
+			return nil
+		}
+	}
+
+	s.IdempotencyRecords = append(s.IdempotencyRecords, *record)
+
+	return nil
+}
+
+func (s *StorageMock) GetIdempotencyRecord(ctx context.Context, key string) (*models.IdempotencyRecord, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for _, record := range s.IdempotencyRecords {
+		if record.Key == key {
+			return &record, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) RenewIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord, expiresAt time.Time) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i, existing := range s.IdempotencyRecords {
+		if existing.Key == record.Key && existing.Fingerprint == record.Fingerprint && existing.Status == models.IdempotencyStatusProcessing {
+			s.IdempotencyRecords[i].ExpiresAt = expiresAt
+			return nil
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) CompleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i, existing := range s.IdempotencyRecords {
+		if existing.Key == record.Key && existing.Fingerprint == record.Fingerprint {
+			s.IdempotencyRecords[i].Status = models.IdempotencyStatusCompleted
+			s.IdempotencyRecords[i].StatusCode = record.StatusCode
+			s.IdempotencyRecords[i].Body = record.Body
+			s.IdempotencyRecords[i].ExpiresAt = record.ExpiresAt
+			return nil
+		}
+	}
+
+	return mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) DeleteIdempotencyRecord(ctx context.Context, record *models.IdempotencyRecord) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	records := []models.IdempotencyRecord{}
+	for _, existing := range s.IdempotencyRecords {
+		if existing.Key != record.Key || existing.Fingerprint != record.Fingerprint || existing.Status != models.IdempotencyStatusProcessing {
+			records = append(records, existing)
+		}
+	}
+	s.IdempotencyRecords = records
+
+	return nil
+}
+
+func (s *StorageMock) GetLoginFailure(ctx context.Context, key string) (*models.LoginFailure, error) {
+	if s.Error != nil {
+		return nil, s.Error
+	}
+
+	for _, failure := range s.LoginFailures {
+		if failure.Key == key {
+			return &failure, nil
+		}
+	}
+
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *StorageMock) RecordLoginFailure(ctx context.Context, key string, now time.Time, resetAt time.Time) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	for i, failure := range s.LoginFailures {
+		if failure.Key == key {
+			if failure.ResetAt.After(now) {
+				s.LoginFailures[i].Count++
+			} else {
+				s.LoginFailures[i] = models.LoginFailure{Key: key, Count: 1, ResetAt: resetAt}
+			}
+			return nil
+		}
+	}
+	s.LoginFailures = append(s.LoginFailures, models.LoginFailure{Key: key, Count: 1, ResetAt: resetAt})
+
+	return nil
+}
+
+func (s *StorageMock) DeleteLoginFailure(ctx context.Context, key string) error {
+	if s.Error != nil {
+		return s.Error
+	}
+
+	failures := []models.LoginFailure{}
+	for _, failure := range s.LoginFailures {
+		if failure.Key != key {
+			failures = append(failures, failure)
+		}
+	}
+	s.LoginFailures = failures
+
+	return nil
+}
@@ -0,0 +1,411 @@
+package tokens
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	log "github.com/sirupsen/logrus"
+	"github.com/xavesen/search-admin/internal/auth"
+	cfg "github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+)
+
+const (
+	AlgorithmEdDSA		= "EdDSA"
+	AlgorithmRS256		= "RS256"
+	rsaKeyBits			= 2048
+	keyIdBytes			= 12
+	keyReloadInterval	= time.Minute
+	// JWKSMaxAge is how long token consumers may cache the key set
+	JWKSMaxAge			= 5 * time.Minute
+	// keys stay published this long after tokens signed by them expire,
+	// to cover clock skew and jwks caching of token consumers
+	keyRetirementLeeway	= 5 * time.Minute
+	// new keys are published this long before they sign tokens, so that
+	// every instance and every consumer's cached key set knows them first
+	keyActivationDelay	= JWKSMaxAge + keyReloadInterval
+)
+
+var ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+
+type Config struct {
+	Algorithm			string
+	Issuer				string
+	Audience			string
+	TTL					time.Duration
+	RotationInterval	time.Duration
+	EncryptionKey		string
+}
+
+type AccessTokenClaims struct {
+	Login	string		`json:"login"`
+	Indexes	[]string	`json:"indexes"`
+	KeyId	string		`json:"key_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+type signingKey struct {
+	id			string
+	algorithm	string
+	createdAt	time.Time
+	private		crypto.Signer
+}
+
+type Manager struct {
+	storage	storage.Storage
+	cipher	*KeyCipher
+	config	Config
+
+	mu			sync.Mutex
+	keys		[]signingKey
+	loadedAt	time.Time
+}
+
+func NewManager(storage storage.Storage, config Config) (*Manager, error) {
+	if config.Algorithm != AlgorithmEdDSA && config.Algorithm != AlgorithmRS256 {
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if config.TTL <= 0 || config.RotationInterval <= 0 {
+		return nil, errors.New("token ttl and key rotation interval must be positive")
+	}
+
+	keyCipher, err := NewKeyCipher(config.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manager{
+		storage: 	storage,
+		cipher: 	keyCipher,
+		config: 	config,
+	}, nil
+}
+
+func (m *Manager) load(ctx context.Context, force bool) error {
+	/*
+	Keys are reloaded periodically, so keys rotated
+	by other instances are picked up without restart.
+	*/
+
+	if !force && !m.loadedAt.IsZero() && time.Since(m.loadedAt) < keyReloadInterval {
+		return nil
+	}
+
+	storedKeys, err := m.storage.GetSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := []signingKey{}
+	for _, storedKey := range storedKeys {
+		der, err := m.cipher.Decrypt(storedKey.EncryptedPrivateKey, storedKey.Id)
+		if err != nil {
+			log.Errorf("Error decrypting signing key %s, is encryption key the same on all instances: %s", storedKey.Id, err)
+			continue
+		}
+		private, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			log.Errorf("Error parsing signing key %s: %s", storedKey.Id, err)
+			continue
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			log.Errorf("Signing key %s is not a signer", storedKey.Id)
+			continue
+		}
+		keys = append(keys, signingKey{
+			id: 		storedKey.Id,
+			algorithm: 	storedKey.Algorithm,
+			createdAt: 	storedKey.CreatedAt,
+			private: 	signer,
+		})
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].createdAt.Equal(keys[j].createdAt) {
+			return keys[i].id > keys[j].id
+		}
+		return keys[i].createdAt.After(keys[j].createdAt)
+	})
+
+	m.keys = keys
+	m.loadedAt = time.Now()
+	return nil
+}
+
+func (m *Manager) generate(ctx context.Context, now time.Time) error {
+	log.Infof("Generating new %s token signing key", m.config.Algorithm)
+
+	var private crypto.Signer
+	var err error
+	switch m.config.Algorithm {
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+
+	id, err := auth.RandomToken(keyIdBytes)
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := m.cipher.Encrypt(der, id)
+	if err != nil {
+		return err
+	}
+
+	return m.storage.CreateSigningKey(ctx, &models.SigningKey{
+		Id: 					id,
+		Algorithm: 				m.config.Algorithm,
+		EncryptedPrivateKey: 	encrypted,
+		CreatedAt: 				now.UTC(),
+	})
+}
+
+func (key *signingKey) activeAt() time.Time {
+	return key.createdAt.Add(keyActivationDelay)
+}
+
+func (m *Manager) published(now time.Time) []signingKey {
+	/*
+	Key is published until every token it could have signed is expired,
+	which is token ttl after a newer key has started signing instead of it.
+	*/
+
+	published := []signingKey{}
+	for i, key := range m.keys {
+		if i > 0 && now.After(m.keys[i-1].activeAt().Add(m.config.TTL + keyRetirementLeeway)) {
+			break
+		}
+		published = append(published, key)
+	}
+
+	return published
+}
+
+func (m *Manager) Rotate(ctx context.Context, now time.Time) error {
+	/*
+	Instances may race and both create a key, that's harmless:
+	all of them sign with the newest one after reload.
+	*/
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(ctx, true); err != nil {
+		return err
+	}
+
+	if m.needsRotation(now) {
+		if err := m.generate(ctx, now); err != nil {
+			log.Errorf("Error generating token signing key: %s", err)
+			return err
+		}
+		if err := m.load(ctx, true); err != nil {
+			return err
+		}
+	}
+
+	published := m.published(now)
+	for _, key := range m.keys[len(published):] {
+		log.Infof("Deleting retired token signing key %s", key.id)
+		if err := m.storage.DeleteSigningKey(ctx, key.id); err != nil {
+			log.Errorf("Error deleting retired token signing key %s: %s", key.id, err)
+			return err
+		}
+	}
+	m.keys = published
+
+	return nil
+}
+
+func (m *Manager) signing(now time.Time) signingKey {
+	/*
+	Tokens are signed with the newest key that has been published
+	for activation delay. The only key is used right away, there is
+	no older key any consumer could know instead.
+	*/
+
+	for _, key := range m.keys {
+		if !now.Before(key.activeAt()) {
+			return key
+		}
+	}
+
+	return m.keys[len(m.keys)-1]
+}
+
+func (m *Manager) needsRotation(now time.Time) bool {
+	return len(m.keys) == 0 || m.keys[0].algorithm != m.config.Algorithm || !now.Before(m.keys[0].createdAt.Add(m.config.RotationInterval))
+}
+
+func (m *Manager) current(ctx context.Context) (*signingKey, error) {
+	/*
+	Keys are rotated lazily when token is issued
+	and the newest key is older than rotation interval.
+	*/
+
+	now := time.Now()
+
+	m.mu.Lock()
+	if err := m.load(ctx, false); err != nil {
+		m.mu.Unlock()
+		return nil, err
+	}
+	rotate := m.needsRotation(now)
+	m.mu.Unlock()
+
+	if rotate {
+		if err := m.Rotate(ctx, now); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.keys) == 0 {
+		return nil, errors.New("no token signing key available")
+	}
+	key := m.signing(now)
+	return &key, nil
+}
+
+func (m *Manager) Issue(ctx context.Context, user *models.User, indexes []string, apiKeyId string) (string, time.Time, error) {
+	key, err := m.current(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	jti, err := auth.RandomToken(keyIdBytes)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(m.config.TTL)
+	claims := AccessTokenClaims{
+		Login: 		user.Login,
+		Indexes: 	indexes,
+		KeyId: 		apiKeyId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer: 	m.config.Issuer,
+			Subject: 	user.Id,
+			IssuedAt: 	jwt.NewNumericDate(now),
+			NotBefore: 	jwt.NewNumericDate(now),
+			ExpiresAt: 	jwt.NewNumericDate(expiresAt),
+			ID: 		jti,
+		},
+	}
+	if m.config.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{m.config.Audience}
+	}
+
+	var method jwt.SigningMethod
+	switch key.algorithm {
+	case AlgorithmEdDSA:
+		method = jwt.SigningMethodEdDSA
+	case AlgorithmRS256:
+		method = jwt.SigningMethodRS256
+	default:
+		return "", time.Time{}, ErrUnsupportedAlgorithm
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.id
+
+	signed, err := token.SignedString(key.private)
+	if err != nil {
+		log.Errorf("Error signing access token with key %s: %s", key.id, err)
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
+}
+
+type JSONWebKey struct {
+	Kid	string	`json:"kid"`
+	Kty	string	`json:"kty"`
+	Alg	string	`json:"alg"`
+	Use	string	`json:"use"`
+	Crv	string	`json:"crv,omitempty"`
+	X	string	`json:"x,omitempty"`
+	N	string	`json:"n,omitempty"`
+	E	string	`json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys	[]JSONWebKey	`json:"keys"`
+}
+
+func (m *Manager) JWKS(ctx context.Context) (*JSONWebKeySet, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(ctx, false); err != nil {
+		return nil, err
+	}
+
+	keySet := &JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range m.published(time.Now()) {
+		jwk := JSONWebKey{Kid: key.id, Alg: key.algorithm, Use: "sig"}
+		switch public := key.private.Public().(type) {
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			return nil, fmt.Errorf("signing key %s has unsupported public key type", key.id)
+		}
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+
+	return keySet, nil
+}
+
+func NewManagerFromConfig(storage storage.Storage, config *cfg.Config) (*Manager, error) {
+	/*
+	Returns nil manager when no encryption key is configured,
+	signing keys are never stored unencrypted.
+	*/
+
+	if config.TokenEncryptionKey == "" {
+		log.Info("TOKEN_ENCRYPTION_KEY is not set, access token issuing is disabled")
+		return nil, nil
+	}
+
+	log.Debugf("Enabling access token issuing with %s keys", config.TokenSigningAlgorithm)
+	return NewManager(storage, Config{
+		Algorithm: 			config.TokenSigningAlgorithm,
+		Issuer: 			config.TokenIssuer,
+		Audience: 			config.TokenAudience,
+		TTL: 				config.TokenTTL,
+		RotationInterval: 	config.TokenKeyRotationInterval,
+		EncryptionKey: 		config.TokenEncryptionKey,
+	})
+}
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"net/http"
+	"time"
+)
+
+func ParseTimeQuery(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
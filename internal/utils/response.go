@@ -3,32 +3,95 @@ package utils
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
 
 type ContextKey string
 
-const ContextKeyReqId ContextKey = "requestId"
+const (
+	ContextKeyReqId			ContextKey = "requestId"
+	ContextKeyPrincipal		ContextKey = "principal"
+	ContextKeyTranslator	ContextKey = "translator"
+)
+
+const (
+	ErrorCodeInvalidPayload		= "invalid_payload"
+	ErrorCodeValidationFailed	= "validation_failed"
+)
+
+type FieldError struct {
+	Field	string	`json:"field"`
+	Rule	string	`json:"rule"`
+	Message	string	`json:"message"`
+}
 
 type Response struct {
-	Success			bool	`json:"success"`
-	ErrorMessage	string	`json:"errorMessage"`
-	Data			any		`json:"data"`
+	Success			bool			`json:"success"`
+	ErrorCode		string			`json:"errorCode,omitempty"`
+	ErrorMessage	string			`json:"errorMessage"`
+	FieldErrors		[]FieldError	`json:"fieldErrors,omitempty"`
+	Data			any				`json:"data"`
 }
 
 func WriteJSON(w http.ResponseWriter, r *http.Request, statusCode int, success bool, errorMessage string, data any) error {
-	log.WithFields(log.Fields{
-		"request_id": r.Context().Value(ContextKeyReqId).(string),
-		"status_code": statusCode,
-		"error_message": errorMessage,
-	}).Info("Responding to request")
-	
 	resp := Response{
 		Success: success,
 		ErrorMessage: errorMessage,
 		Data: data,
 	}
+	if !success {
+		resp.ErrorCode = StatusErrorCode(statusCode)
+	}
+
+	return writeResponse(w, r, statusCode, resp)
+}
+
+func WriteError(w http.ResponseWriter, r *http.Request, statusCode int, errorCode string, errorMessage string, fieldErrors []FieldError) error {
+	return writeResponse(w, r, statusCode, Response{
+		Success: false,
+		ErrorCode: errorCode,
+		ErrorMessage: errorMessage,
+		FieldErrors: fieldErrors,
+	})
+}
+
+func WriteValidationError(w http.ResponseWriter, r *http.Request, fieldErrors []FieldError) error {
+	/*
+	Error message joins messages of all field errors,
+	it is kept for clients written before field errors were added.
+	*/
+
+	messages := []string{}
+	for _, fieldError := range fieldErrors {
+		messages = append(messages, fieldError.Message)
+	}
+
+	return WriteError(w, r, http.StatusBadRequest, ErrorCodeValidationFailed, badRequestPrefix + strings.Join(messages, ", "), fieldErrors)
+}
+
+func StatusErrorCode(statusCode int) string {
+	/*
+	Errors without more specific code are identified by their status,
+	codes are derived from standard status texts so they never change:
+	404 is not_found, 500 is internal_server_error.
+	*/
+
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_")
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, statusCode int, resp Response) error {
+	log.WithFields(log.Fields{
+		"request_id": r.Context().Value(ContextKeyReqId).(string),
+		"status_code": statusCode,
+		"error_code": resp.ErrorCode,
+		"error_message": resp.ErrorMessage,
+	}).Info("Responding to request")
+
+	if resp.ErrorMessage != "" {
+		resp.ErrorMessage = translateMessage(RequestTranslator(r), resp.ErrorMessage)
+	}
 
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/ru"
+	ut "github.com/go-playground/universal-translator"
+	log "github.com/sirupsen/logrus"
+)
+
+const badRequestPrefix = "Bad request: "
+
+/*
+Messages are keyed by their english text, so english needs
+no catalog and messages missing from a catalog stay english.
+Parameters are referenced as {0}, {1} in both key and text.
+*/
+var messageCatalogs = map[string]map[string]string{
+	"ru": {
+		"Bad request":										"Неверный запрос",
+		"Invalid request payload":							"Некорректное тело запроса",
+		"Internal server error":							"Внутренняя ошибка сервера",
+		"Authentication required":							"Требуется аутентификация",
+		"Invalid credentials":								"Неверные учетные данные",
+		"Invalid login or password":						"Неверный логин или пароль",
+		"Forbidden":										"Доступ запрещен",
+		"Admin with such login already exists":				"Администратор с таким логином уже существует",
+		"User with such login already exists":				"Пользователь с таким логином уже существует",
+		"Idempotency key is already used for a different request":	"Ключ идемпотентности уже использован для другого запроса",
+		"Request with this idempotency key is still being processed":	"Запрос с этим ключом идемпотентности еще обрабатывается",
+		"Changes after cursor are no longer retained, start over without since":	"Изменения после курсора больше не хранятся, начните заново без since",
+		"Some operations failed":							"Некоторые операции не выполнены",
+		"No operations were applied because some of them failed":	"Ни одна операция не применена, так как некоторые из них не выполнены",
+		"Operation was not applied because another operation failed":	"Операция не применена, так как другая операция не выполнена",
+		"Atomic bulk operations are not supported by db deployment":	"Атомарные пакетные операции не поддерживаются развертыванием бд",
+		"Too many failed attempts, try again later":	"Слишком много неудачных попыток, попробуйте позже",
+		"Filter import is not supported by db deployment":	"Импорт фильтров не поддерживается развертыванием бд",
+		"Request is not authenticated with a session token":	"Запрос аутентифицирован не токеном сессии",
+		"User no longer has any of the key's indexes":		"У пользователя больше нет ни одного из индексов ключа",
+		"Identity provider is unavailable":					"Провайдер идентификации недоступен",
+		"Identity provider rejected login":					"Провайдер идентификации отклонил вход",
+		"No oidc login in progress":						"Нет начатого входа через oidc",
+		"Invalid oidc login state":							"Некорректное состояние входа через oidc",
+		"No authorization code provided":					"Не передан код авторизации",
+		"No user id provided":								"Не передан id пользователя",
+		"No filter id provided":							"Не передан id фильтра",
+		"No webhook id provided":							"Не передан id вебхука",
+		"No admin id provided":								"Не передан id администратора",
+		"No delivery id provided":							"Не передан id доставки",
+		"No subject provided":								"Не передан субъект",
+		"No user with such id":								"Нет пользователя с таким id",
+		"No filter with such id":							"Нет фильтра с таким id",
+		"No webhook with such id":							"Нет вебхука с таким id",
+		"No admin with such id":							"Нет администратора с таким id",
+		"No delivery with such id":							"Нет доставки с таким id",
+		"No deleted user with such id":						"Нет удаленного пользователя с таким id",
+		"No deleted filter with such id":					"Нет удаленного фильтра с таким id",
+		"No active api key with such id":					"Нет активного api ключа с таким id",
+		"No role binding for such subject":					"Нет привязки ролей для такого субъекта",
+		"either api_key or login and password are required":	"необходимо передать api_key или login и password",
+		"from must be a RFC3339 timestamp":					"from должен быть временем в формате RFC3339",
+		"to must be a RFC3339 timestamp":					"to должен быть временем в формате RFC3339",
+		"expires_at must be in the future":					"expires_at должен быть в будущем",
+		"url must be an http or https url":					"url должен быть http или https адресом",
+		"format must be one of [json yaml]":				"format должен быть одним из [json yaml]",
+		"mode must be one of [merge replace]":				"mode должен быть одним из [merge replace]",
+		"bundle contains invalid filters":					"набор содержит некорректные фильтры",
+		"since must be a cursor returned by previous request":	"since должен быть курсором из предыдущего ответа",
+		"Last-Event-ID must be an id of previously received event":	"Last-Event-ID должен быть id ранее полученного события",
+		"scope {0} is not an index of the user":			"область {0} не является индексом пользователя",
+		"unknown event type {0}":							"неизвестный тип события {0}",
+		"limit must be between 1 and {0}":					"limit должен быть от 1 до {0}",
+		"unsupported bundle version {0}":					"неподдерживаемая версия набора {0}",
+		"{0} is duplicated in bundle":						"{0} повторяется в наборе",
+		"{0} must be an id of an existing filter":			"{0} должен быть идентификатором существующего фильтра",
+		"{0} is duplicated in request":						"{0} повторяется в запросе",
+		"at most {0} operations are allowed in one request":	"в одном запросе допускается не больше {0} операций",
+		"{0} is required":									"{0} обязательное поле",
+		"{0} is invalid":									"{0} имеет некорректное значение",
+		"{0} must be a string":								"{0} должен быть строкой",
+		"{0} must be a number":								"{0} должен быть числом",
+		"{0} must be an integer":							"{0} должен быть целым числом",
+		"{0} must be a boolean":							"{0} должен быть логическим значением",
+		"{0} must be an array":								"{0} должен быть массивом",
+		"{0} must be an object":							"{0} должен быть объектом",
+		"{0} must be one of [{1}]":							"{0} должен быть одним из [{1}]",
+		"{0} must be between {1} and {2}":					"{0} должен быть от {1} до {2}",
+		"{0} must be {1} or greater":						"{0} должен быть не меньше {1}",
+		"{0} must be {1} or less":							"{0} должен быть не больше {1}",
+		"{0} must contain at least 1 item":					"{0} должен содержать хотя бы один элемент",
+		"{0} must contain at least {1} items":				"количество элементов {0} должно быть не меньше {1}",
+		"{0} must be at least {1} characters in length":	"длина {0} должна быть не меньше {1}",
+		"{0} must be at most {1} characters in length":		"длина {0} должна быть не больше {1}",
+		"{0} must match {1}":								"{0} должен соответствовать {1}",
+		"{0} must be a RFC3339 timestamp":					"{0} должен быть временем в формате RFC3339",
+		"{0} must be a regular expression accepted by RE2":	"{0} должен быть регулярным выражением, поддерживаемым RE2",
+		"{0} must be a valid {1}":							"{0} должен быть корректным значением формата {1}",
+	},
+}
+
+type Translators struct {
+	universal	*ut.UniversalTranslator
+}
+
+func newTranslators() *Translators {
+	log.Debug("Initializing translators")
+
+	supported := []locales.Translator{en.New(), ru.New()}
+
+	return &Translators{
+		universal: ut.New(supported[0], supported...),
+	}
+}
+
+func (t *Translators) Get(locale string) ut.Translator {
+	translator, _ := t.universal.GetTranslator(locale)
+
+	return translator
+}
+
+func (t *Translators) Negotiate(acceptLanguage string) ut.Translator {
+	/*
+	Falls back to english when none of the accepted
+	languages is supported or header is missing.
+	*/
+
+	translator, _ := t.universal.FindTranslator(acceptedLocales(acceptLanguage)...)
+
+	return translator
+}
+
+func registerMessageCatalogs(translators *Translators) {
+	for locale, catalog := range messageCatalogs {
+		translator := translators.Get(locale)
+		for message, translation := range catalog {
+			if err := translator.Add(message, translation, true); err != nil {
+				log.Errorf("Error registering %s translation of %q: %s", locale, message, err)
+			}
+		}
+	}
+}
+
+func acceptedLocales(acceptLanguage string) []string {
+	/*
+	Accept-Language lists language tags with optional q weights,
+	region specific tags are followed by their base language so
+	ru-RU is served in russian. Tags with q=0 are not acceptable.
+	*/
+
+	type accepted struct {
+		tag		string
+		weight	float64
+	}
+
+	languages := []accepted{}
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		weight := 1.0
+		if params = strings.TrimSpace(params); strings.HasPrefix(params, "q=") {
+			parsed, err := strconv.ParseFloat(strings.TrimPrefix(params, "q="), 64)
+			if err != nil {
+				continue
+			}
+			weight = parsed
+		}
+		if weight <= 0 {
+			continue
+		}
+
+		languages = append(languages, accepted{tag: tag, weight: weight})
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].weight > languages[j].weight
+	})
+
+	localeNames := []string{}
+	for _, language := range languages {
+		localeNames = append(localeNames, strings.ReplaceAll(language.tag, "-", "_"))
+		if base, _, found := strings.Cut(language.tag, "-"); found {
+			localeNames = append(localeNames, base)
+		}
+	}
+
+	return localeNames
+}
+
+func RequestTranslator(r *http.Request) ut.Translator {
+	translator, _ := r.Context().Value(ContextKeyTranslator).(ut.Translator)
+
+	return translator
+}
+
+func Translate(translator ut.Translator, message string, params ...string) string {
+	/*
+	Messages referencing more parameters than given are not
+	looked up, translator panics on missing parameters.
+	*/
+
+	if translator != nil && !strings.Contains(message, "{" + strconv.Itoa(len(params)) + "}") {
+		if translated, err := translator.T(message, params...); err == nil {
+			return translated
+		}
+	}
+
+	for i, param := range params {
+		message = strings.ReplaceAll(message, "{" + strconv.Itoa(i) + "}", param)
+	}
+
+	return message
+}
+
+func translateMessage(translator ut.Translator, message string) string {
+	/*
+	Bad request messages are translated in two parts, so messages
+	with parameters already translated by handlers get translated
+	prefix as well.
+	*/
+
+	if strings.HasPrefix(message, badRequestPrefix) {
+		details := strings.TrimPrefix(message, badRequestPrefix)
+		return Translate(translator, "Bad request") + ": " + Translate(translator, details)
+	}
+
+	return Translate(translator, message)
+}
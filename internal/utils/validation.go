@@ -1,34 +1,135 @@
 package utils
 
 import (
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 
-	"github.com/go-playground/locales/en"
 	ut "github.com/go-playground/universal-translator"
 	log "github.com/sirupsen/logrus"
 	"github.com/go-playground/validator/v10"
 	en_translations "github.com/go-playground/validator/v10/translations/en"
+	ru_translations "github.com/go-playground/validator/v10/translations/ru"
+	cfg "github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
 )
 
-func NewValidator() (*validator.Validate, *ut.Translator) {
+var (
+	loginRegexp		= regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+	indexNameRegexp	= regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+)
+
+type DomainRules struct {
+	LoginMinLength		int
+	LoginMaxLength		int
+	IndexNameMaxLength	int
+	IndexLimitMax		int
+}
+
+func NewValidator(config *cfg.Config) (*validator.Validate, *Translators) {
 	log.Debug("Initializing validator")
 	validate := validator.New(validator.WithRequiredStructEnabled())
+	validate.RegisterTagNameFunc(jsonFieldName)
+	validate.RegisterStructValidation(filterStructValidation, models.Filter{})
+
+	rules := NewDomainRules(config)
+	registerDomainValidations(validate, rules)
 
-	translator := newTranslator(validate)
+	translators := newTranslators()
+	registerEnglishTranslations(validate, translators.Get("en"), rules)
+	registerRussianTranslations(validate, translators.Get("ru"), rules)
+	registerMessageCatalogs(translators)
 
-	return validate, translator
+	return validate, translators
 }
 
-func newTranslator(validate *validator.Validate) *ut.Translator {
-	log.Debug("Initializing validator error translations")
+func NewDomainRules(config *cfg.Config) DomainRules {
+	rules := DomainRules{
+		LoginMinLength:		config.LoginMinLength,
+		LoginMaxLength:		config.LoginMaxLength,
+		IndexNameMaxLength:	config.IndexNameMaxLength,
+		IndexLimitMax:		config.IndexLimitMax,
+	}
+
+	if rules.LoginMinLength <= 0 {
+		rules.LoginMinLength = cfg.DefaultLoginMinLength
+	}
+	if rules.LoginMaxLength <= 0 {
+		rules.LoginMaxLength = cfg.DefaultLoginMaxLength
+	}
+	if rules.IndexNameMaxLength <= 0 {
+		rules.IndexNameMaxLength = cfg.DefaultIndexNameMaxLength
+	}
+	if rules.IndexLimitMax <= 0 {
+		rules.IndexLimitMax = cfg.DefaultIndexLimitMax
+	}
+
+	return rules
+}
+
+func registerDomainValidations(validate *validator.Validate, rules DomainRules) {
+	/*
+	Regexes are matched by RE2 when filters are applied, so only
+	expressions it accepts are valid. Index names follow rules of
+	search engine: lowercase, not starting with a symbol.
+	*/
+
+	validate.RegisterValidation("re2", func(fl validator.FieldLevel) bool {
+		_, err := regexp.Compile(fl.Field().String())
+		return err == nil
+	})
+
+	validate.RegisterValidation("login", func(fl validator.FieldLevel) bool {
+		login := fl.Field().String()
+		return len(login) >= rules.LoginMinLength && len(login) <= rules.LoginMaxLength && loginRegexp.MatchString(login)
+	})
+
+	validate.RegisterValidation("index_name", func(fl validator.FieldLevel) bool {
+		name := fl.Field().String()
+		return len(name) <= rules.IndexNameMaxLength && indexNameRegexp.MatchString(name)
+	})
+
+	validate.RegisterValidation("index_limit", func(fl validator.FieldLevel) bool {
+		limit := fl.Field().Int()
+		return limit >= 1 && limit <= int64(rules.IndexLimitMax)
+	})
+}
+
+func registerTranslation(validate *validator.Validate, translator ut.Translator, tag string, text string, params ...string) {
+	validate.RegisterTranslation(tag, translator, func(ut ut.Translator) error {
+		return ut.Add(tag, text, true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T(tag, append([]string{fe.Field()}, params...)...)
+
+		return t
+	})
+}
+
+func jsonFieldName(field reflect.StructField) string {
+	/*
+	Errors name fields the way clients send them,
+	fields not present in json are left unnamed.
+	*/
+
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+func registerEnglishTranslations(validate *validator.Validate, translator ut.Translator, rules DomainRules) {
+	log.Debug("Initializing english validator error translations")
 
 	fieldNameExceptions := map[string]string{
 		"indexlimit": "index_limit",
 	}
 
-	en := en.New()
-	utTranslation := ut.New(en, en)
-	translator, _ := utTranslation.GetTranslator("en")
 	en_translations.RegisterDefaultTranslations(validate, translator)
 
 	validate.RegisterTranslation("required", translator, func(ut ut.Translator) error {
@@ -53,19 +154,130 @@ func newTranslator(validate *validator.Validate) *ut.Translator {
 		return t
 	})
 
-	return &translator
+	validate.RegisterTranslation("after_active_from", translator, func(ut ut.Translator) error {
+		return ut.Add("after_active_from", "{0} must be after active_from", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("after_active_from", fe.Field())
+
+		return t
+	})
+
+	registerTranslation(validate, translator, "required_unless", "{0} is required")
+	registerTranslation(validate, translator, "mongodb", "{0} must be a mongodb ObjectId")
+	registerTranslation(validate, translator, "re2", "{0} must be a regular expression accepted by RE2")
+	registerTranslation(validate, translator, "login", "{0} must be {1} to {2} characters long and contain only latin letters, digits, dots, underscores and dashes",
+		strconv.Itoa(rules.LoginMinLength), strconv.Itoa(rules.LoginMaxLength))
+	registerTranslation(validate, translator, "index_name", "{0} must be at most {1} characters long, start with a lowercase letter or digit and contain only lowercase letters, digits, dots, underscores and dashes",
+		strconv.Itoa(rules.IndexNameMaxLength))
+	registerTranslation(validate, translator, "index_limit", "{0} must be between 1 and {1}", strconv.Itoa(rules.IndexLimitMax))
 }
 
-func FormatErrorString(err error, translator *ut.Translator) (string, string) {
+func registerRussianTranslations(validate *validator.Validate, translator ut.Translator, rules DomainRules) {
+	log.Debug("Initializing russian validator error translations")
+
+	ru_translations.RegisterDefaultTranslations(validate, translator)
+
+	validate.RegisterTranslation("after_active_from", translator, func(ut ut.Translator) error {
+		return ut.Add("after_active_from", "{0} должен быть позже active_from", true)
+	}, func(ut ut.Translator, fe validator.FieldError) string {
+		t, _ := ut.T("after_active_from", fe.Field())
+
+		return t
+	})
+
+	registerTranslation(validate, translator, "required_unless", "{0} обязательное поле")
+	registerTranslation(validate, translator, "mongodb", "{0} должен быть mongodb ObjectId")
+	registerTranslation(validate, translator, "re2", "{0} должен быть регулярным выражением, поддерживаемым RE2")
+	registerTranslation(validate, translator, "login", "{0} должен содержать от {1} до {2} символов: латинские буквы, цифры, точки, подчеркивания и дефисы",
+		strconv.Itoa(rules.LoginMinLength), strconv.Itoa(rules.LoginMaxLength))
+	registerTranslation(validate, translator, "index_name", "{0} должен содержать не больше {1} символов, начинаться со строчной буквы или цифры и содержать только строчные латинские буквы, цифры, точки, подчеркивания и дефисы",
+		strconv.Itoa(rules.IndexNameMaxLength))
+	registerTranslation(validate, translator, "index_limit", "{0} должен быть от 1 до {1}", strconv.Itoa(rules.IndexLimitMax))
+}
+
+func filterStructValidation(sl validator.StructLevel) {
+	filter := sl.Current().Interface().(models.Filter)
+
+	if filter.ActiveFrom != nil && filter.ActiveUntil != nil && !filter.ActiveUntil.After(*filter.ActiveFrom) {
+		sl.ReportError(filter.ActiveUntil, "active_until", "ActiveUntil", "after_active_from", "")
+	}
+}
+
+func FormatErrorString(err error) string {
 	logErrorString := "User input validation error: "
-	errorString := ""
 	for i, err := range err.(validator.ValidationErrors) {
 		if i != 0 {
-			errorString = errorString + ", "
 			logErrorString = logErrorString + "; "
 		}
-		errorString = errorString + err.Translate(*translator)
 		logErrorString = logErrorString + err.Error()
 	}
-	return logErrorString, errorString
+	return logErrorString
+}
+
+func FieldErrors(err error, translator ut.Translator) []FieldError {
+	fieldErrors := []FieldError{}
+	for _, err := range err.(validator.ValidationErrors) {
+		/*
+		Namespace starts with name of validated struct, path of
+		the field inside request body is what follows it.
+		*/
+		_, field, _ := strings.Cut(err.Namespace(), ".")
+		fieldErrors = append(fieldErrors, FieldError{
+			Field: 		field,
+			Rule: 		err.Tag(),
+			Message: 	err.Translate(translator),
+		})
+	}
+	return fieldErrors
+}
+
+func ExemptStoredUser(err error, stored *models.User) error {
+	/*
+	Users created before domain rules were introduced may have
+	logins, limits and index names the rules reject. Values that
+	are already stored are kept valid on update, only new ones
+	have to follow the rules. Returns nil when no errors remain.
+	*/
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok || stored == nil {
+		return err
+	}
+
+	remaining := validator.ValidationErrors{}
+	for _, fieldError := range validationErrors {
+		if !isStoredUserValue(fieldError, stored) {
+			remaining = append(remaining, fieldError)
+		}
+	}
+	if len(remaining) == 0 {
+		return nil
+	}
+
+	return remaining
+}
+
+func isStoredUserValue(fieldError validator.FieldError, stored *models.User) bool {
+	switch fieldError.Tag() {
+	case "login":
+		return fieldError.Value() == stored.Login
+	case "index_limit":
+		return fieldError.Value() == stored.IndexLimit
+	case "index_name":
+		for _, index := range stored.Indexes {
+			if fieldError.Value() == index {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func TranslateErrors(err error, translator ut.Translator) []string {
+	errorStrings := []string{}
+	for _, err := range err.(validator.ValidationErrors) {
+		errorStrings = append(errorStrings, err.Translate(translator))
+	}
+	return errorStrings
 }
\ No newline at end of file
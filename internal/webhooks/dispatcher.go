@@ -0,0 +1,218 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	cfg "github.com/xavesen/search-admin/internal/config"
+	"github.com/xavesen/search-admin/internal/models"
+	"github.com/xavesen/search-admin/internal/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	SignatureHeader	= "X-Webhook-Signature"
+	TimestampHeader	= "X-Webhook-Timestamp"
+	EventHeader		= "X-Webhook-Event"
+	DeliveryHeader	= "X-Webhook-Delivery"
+
+	maxBackoff			= time.Hour
+	maxErrorLength		= 512
+	deliveriesPerRun	= 100
+)
+
+type Config struct {
+	MaxAttempts	int
+	Backoff		time.Duration
+	Timeout		time.Duration
+}
+
+type Dispatcher struct {
+	storage		storage.Storage
+	httpClient	*http.Client
+	config		Config
+}
+
+func NewDispatcher(storage storage.Storage, config Config) *Dispatcher {
+	return &Dispatcher{
+		storage:	storage,
+		httpClient:	&http.Client{Timeout: config.Timeout},
+		config:		config,
+	}
+}
+
+func NewDispatcherFromConfig(storage storage.Storage, config *cfg.Config) *Dispatcher {
+	return NewDispatcher(storage, Config{
+		MaxAttempts:	config.WebhookMaxAttempts,
+		Backoff:		config.WebhookRetryBackoff,
+		Timeout:		config.WebhookTimeout,
+	})
+}
+
+func (d *Dispatcher) Name() string {
+	return "webhooks"
+}
+
+func (d *Dispatcher) Publish(ctx context.Context, event *models.OutboxEvent) error {
+	/*
+	Dispatcher is fed by the outbox relay, publishing only persists
+	a pending delivery per subscribed webhook and sending is left
+	to the delivery job. Outbox event id is used as webhook event id,
+	so an event relayed twice is only delivered once per webhook.
+	*/
+
+	webhooks, err := d.storage.GetAllWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	subscribed := []models.Webhook{}
+	for _, webhook := range webhooks {
+		if Matches(webhook.Events, event.Type) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+	if len(subscribed) == 0 {
+		return nil
+	}
+
+	webhookEvent := models.WebhookEvent{
+		Id: 			event.Id,
+		Type: 			event.Type,
+		Time: 			event.CreatedAt,
+		ResourceType: 	event.ResourceType,
+		ResourceId: 	event.ResourceId,
+		Data: 			event.Data,
+	}
+	payload, err := json.Marshal(webhookEvent)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	deliveries := []models.WebhookDelivery{}
+	for _, webhook := range subscribed {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			WebhookId: 		webhook.Id,
+			EventId: 		event.Id,
+			EventType: 		event.Type,
+			Payload: 		string(payload),
+			Status: 		models.WebhookDeliveryPending,
+			NextAttemptAt: 	now,
+			CreatedAt: 		now,
+		})
+	}
+
+	return d.storage.CreateWebhookDeliveries(ctx, deliveries)
+}
+
+func (d *Dispatcher) DeliverDue(ctx context.Context) error {
+	for i := 0; i < deliveriesPerRun; i++ {
+		now := time.Now().UTC()
+		delivery, err := d.storage.ClaimWebhookDelivery(ctx, now, now.Add(d.config.Timeout + time.Minute))
+		if err == mongo.ErrNoDocuments {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		d.deliver(ctx, delivery)
+		if err := d.storage.UpdateWebhookDelivery(ctx, delivery); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+
+	webhook, err := d.storage.GetWebhook(ctx, delivery.WebhookId)
+	if err != nil {
+		delivery.LastError = fmt.Sprintf("error getting webhook: %s", err)
+		d.scheduleRetry(delivery, now)
+		return
+	}
+
+	statusCode, err := d.send(ctx, webhook, delivery, now)
+	delivery.LastStatusCode = statusCode
+	if err != nil {
+		delivery.LastError = truncate(err.Error(), maxErrorLength)
+		d.scheduleRetry(delivery, now)
+		return
+	}
+
+	log.Debugf("Delivered event %s to webhook %s", delivery.EventId, delivery.WebhookId)
+	delivery.Status = models.WebhookDeliverySucceeded
+}
+
+func (d *Dispatcher) send(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewBufferString(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.Id)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, []byte(delivery.Payload)))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorLength))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) scheduleRetry(delivery *models.WebhookDelivery, now time.Time) {
+	if delivery.Attempts >= d.config.MaxAttempts {
+		log.Warningf("Giving up delivering event %s to webhook %s after %d attempts: %s", delivery.EventId, delivery.WebhookId, delivery.Attempts, delivery.LastError)
+		delivery.Status = models.WebhookDeliveryFailed
+		return
+	}
+
+	log.Infof("Delivering event %s to webhook %s failed, retrying: %s", delivery.EventId, delivery.WebhookId, delivery.LastError)
+	delivery.Status = models.WebhookDeliveryPending
+	delivery.NextAttemptAt = now.Add(Backoff(d.config.Backoff, delivery.Attempts))
+}
+
+// Backoff doubles base delay with every failed attempt up to an hour
+func Backoff(base time.Duration, attempts int) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+	return delay
+}
+
+func truncate(value string, length int) string {
+	if len(value) <= length {
+		return value
+	}
+
+	return value[:length]
+}
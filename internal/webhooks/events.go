@@ -0,0 +1,50 @@
+package webhooks
+
+import "strings"
+
+const selectorWildcard = "*"
+
+var EventTypes = []string{
+	"user.create",
+	"user.update",
+	"user.delete",
+	"user.restore",
+	"user.purge",
+	"filter.create",
+	"filter.update",
+	"filter.delete",
+	"filter.restore",
+	"filter.archive",
+	"filter.purge",
+}
+
+// ValidSelector reports if selector is an event type,
+// resource wildcard like user.* or * for all events
+func ValidSelector(selector string) bool {
+	if selector == selectorWildcard {
+		return true
+	}
+
+	for _, eventType := range EventTypes {
+		if selector == eventType || selector == resourceOf(eventType) + "." + selectorWildcard {
+			return true
+		}
+	}
+
+	return false
+}
+
+func Matches(selectors []string, eventType string) bool {
+	for _, selector := range selectors {
+		if selector == selectorWildcard || selector == eventType || selector == resourceOf(eventType) + "." + selectorWildcard {
+			return true
+		}
+	}
+
+	return false
+}
+
+func resourceOf(eventType string) string {
+	resource, _, _ := strings.Cut(eventType, ".")
+	return resource
+}
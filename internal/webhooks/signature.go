@@ -0,0 +1,39 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+
+	"github.com/xavesen/search-admin/internal/auth"
+)
+
+const (
+	secretPrefix	= "whsec_"
+	secretBytes		= 32
+	signaturePrefix	= "sha256="
+)
+
+func NewSecret() (string, error) {
+	secret, err := auth.RandomToken(secretBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return secretPrefix + secret, nil
+}
+
+func Sign(secret string, timestamp int64, payload []byte) string {
+	/*
+	Timestamp is signed together with the payload, so receivers
+	can reject replayed requests by checking how old it is.
+	*/
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}